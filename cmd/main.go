@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+	"veo/internal/api/common"
 	v1 "veo/internal/api/v1"
 	"veo/internal/configs"
 	"veo/internal/database"
@@ -20,6 +22,15 @@ func main() {
 		logger.Errorf("Failed to load config: %v", err)
 	}
 
+	// Load the JWT signing keyring, without it no token can be issued or verified
+	if err := common.InitJWT(cfg.JWT); err != nil {
+		logger.Errorf("Failed to load JWT keys: %v", err)
+		os.Exit(1)
+	}
+
+	// Configure the optional browser cookie mode
+	common.InitCookies(cfg.Cookie)
+
 	// Initialize the database connection
 	if err := database.Init(cfg.Database); err != nil {
 		logger.Errorf("Failed to initialize database: %v", err)
@@ -28,13 +39,133 @@ func main() {
 
 	// Initialize the repository layer (Data Access Layer)
 	userRepo := repository.NewUserRepository(database.GetDB())
+	refreshTokenRepo := repository.NewRefreshTokenRepository(database.GetDB())
+	sessionRepo := repository.NewSessionRepository(database.GetDB())
+	apiKeyRepo := repository.NewAPIKeyRepository(database.GetDB())
+	oauthClientRepo := repository.NewOAuthClientRepository(database.GetDB())
+	oauthCodeRepo := repository.NewOAuthCodeRepository(database.GetDB())
+	identityRepo := repository.NewIdentityRepository(database.GetDB())
+	mfaRepo := repository.NewMFARepository(database.GetDB())
+	passkeyRepo := repository.NewPasskeyRepository(database.GetDB())
+	rateLimitRepo := repository.NewRateLimitRepository(database.GetDB())
+	magicLinkRepo := repository.NewMagicLinkRepository(database.GetDB())
+	phoneCodeRepo := repository.NewPhoneCodeRepository(database.GetDB())
+	passwordResetRepo := repository.NewPasswordResetRepository(database.GetDB())
+	loginFailureRepo := repository.NewLoginFailureRepository(database.GetDB())
+
+	// Keep revoked tokens in the database when several instances share the load
+	if cfg.JWT.Denylist == "database" {
+		common.UseDenylist(repository.NewRevokedTokenRepository(database.GetDB()))
+	}
+
+	// Issue opaque server-side sessions instead of JWTs when configured. JWT sessions live as long
+	// as their refresh tokens, opaque sessions expire after the idle timeout.
+	sessionTTL := cfg.JWT.RefreshTokenTTL
+	if cfg.Session.Strategy == "session" {
+		common.UseSessionStrategy(common.NewOpaqueSessionStrategy(sessionRepo, cfg.Session.TTL))
+		sessionTTL = cfg.Session.TTL
+	} else {
+		common.UseSessionStrategy(common.NewJWTStrategy(sessionRepo))
+	}
+
+	// Accept API keys next to access tokens
+	common.UseAPIKeys(apiKeyRepo)
+
+	// Let users sign in with the configured OpenID Connect providers
+	identityProviders := make(map[string]service.IdentityProvider, len(cfg.OIDC.Providers))
+	for _, provider := range cfg.OIDC.Providers {
+		identityProviders[provider.Name] = service.NewOIDCProvider(provider, nil)
+	}
+
+	// Identities being linked are signed with a secret shared by every instance, without one
+	// linking only completes on the instance that started it, and not across a restart
+	identityLinkSecret := []byte(cfg.OIDC.LinkSecret)
+	if len(identityLinkSecret) == 0 {
+		secret, err := utils.RandomToken(32)
+		if err != nil {
+			logger.Errorf("Failed to generate identity link secret: %v", err)
+		}
+		identityLinkSecret = []byte(secret)
+		logger.Warn("oidc.link_secret is not set, identities can only be linked on the instance the user started from")
+	}
+
+	// Send mail with the configured driver. Links in mail are signed with a secret shared by every instance,
+	// without one they stop working when the server restarts.
+	mailer, err := service.NewMailer(cfg.Mail)
+	if err != nil {
+		logger.Errorf("Failed to initialize mailer: %v", err)
+	}
+	linkSecret := []byte(cfg.Mail.LinkSecret)
+	if len(linkSecret) == 0 {
+		secret, err := utils.RandomToken(32)
+		if err != nil {
+			logger.Errorf("Failed to generate link secret: %v", err)
+		}
+		linkSecret = []byte(secret)
+		logger.Warn("mail.link_secret is not set, links sent by email only work until the server restarts")
+	}
+
+	// Send text messages with the configured provider
+	smsProvider, err := service.NewSMSProvider(cfg.Phone)
+	if err != nil {
+		logger.Errorf("Failed to initialize SMS provider: %v", err)
+	}
+
+	// Check every new password against the configured policy. A policy that cannot be enforced as configured
+	// would refuse every password or skip the list of common passwords, so do not start.
+	passwordPolicy, err := service.NewPasswordPolicy(cfg.PasswordPolicy)
+	if err != nil {
+		logger.Errorf("Failed to load password policy: %v", err)
+		os.Exit(1)
+	}
+	service.UsePasswordPolicy(passwordPolicy)
+
+	// Hash new passwords with the configured algorithm and pepper, older hashes are replaced as their users sign in.
+	// Without the configured peppers no peppered hash verifies and new ones would be stored unpeppered, so do not start.
+	passwordHashers, err := utils.NewPasswordHashers(cfg.PasswordHash)
+	if err != nil {
+		logger.Errorf("Failed to initialize password hashing: %v", err)
+		os.Exit(1)
+	}
+	utils.UsePasswordHashers(passwordHashers)
 
 	// Initialize the service layer (Business Logic Layer)
 	userService := service.NewUserService(userRepo)
+	tokenService := service.NewTokenService(refreshTokenRepo, sessionRepo, cfg.JWT.RefreshTokenTTL)
+	sessionService := service.NewSessionService(sessionRepo, refreshTokenRepo, sessionTTL, cfg.Session.MaxPerUser)
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo)
+	oauthService := service.NewOAuthService(oauthClientRepo, oauthCodeRepo, sessionRepo, refreshTokenRepo)
+	federationService := service.NewFederationService(identityProviders, identityRepo, userRepo, identityLinkSecret)
+	identityService := service.NewIdentityService(identityRepo, userRepo)
+	mfaService := service.NewMFAService(mfaRepo, cfg.MFA.Issuer)
+	passkeyService := service.NewPasskeyService(passkeyRepo, identityRepo, cfg.WebAuthn)
+	rateLimiter := service.NewRateLimiter(rateLimitRepo)
+	magicLinkService := service.NewMagicLinkService(magicLinkRepo, identityRepo, userRepo, rateLimiter, mailer, cfg.MagicLink, linkSecret)
+	phoneService := service.NewPhoneService(phoneCodeRepo, identityRepo, userRepo, rateLimiter, smsProvider, cfg.Phone)
+	emailService := service.NewEmailService(userRepo, rateLimiter, mailer, cfg.Email, linkSecret)
+	passwordResetService := service.NewPasswordResetService(passwordResetRepo, userRepo, sessionService, rateLimiter, mailer, cfg.PasswordReset)
+	lockoutService := service.NewLockoutService(loginFailureRepo, cfg.Lockout)
+
+	// Reject tokens issued before a password change, account deletion or sign out everywhere
+	common.UseTokenVersionSource(&userService)
 
 	// Initialize the API layer (Controller Layer)
-	accountAPI := v1.NewAccountAPI(userService)
+	issuer := v1.NewTokenIssuer(tokenService, sessionService)
+	accountAPI := v1.NewAccountAPI(userService, mfaService, emailService, lockoutService, issuer)
 	userAPI := v1.NewUserAPI(userService)
+	tokenAPI := v1.NewTokenAPI(issuer)
+	sessionAPI := v1.NewSessionAPI(sessionService)
+	apiKeyAPI := v1.NewAPIKeyAPI(apiKeyService, sessionService)
+	oauthAPI := v1.NewOAuthAPI(userService, oauthService, apiKeyService, mfaService, emailService, lockoutService, issuer)
+	adminAPI := v1.NewAdminAPI(userService, oauthService, mfaService, lockoutService)
+	federationAPI := v1.NewFederationAPI(federationService, mfaService, issuer)
+	identityAPI := v1.NewIdentityAPI(identityService, federationService, userService, sessionService, lockoutService)
+	mfaAPI := v1.NewMFAAPI(mfaService, userService, sessionService)
+	passkeyAPI := v1.NewPasskeyAPI(passkeyService, userService, sessionService, issuer)
+	magicLinkAPI := v1.NewMagicLinkAPI(magicLinkService, mfaService, issuer)
+	phoneAPI := v1.NewPhoneAPI(phoneService, mfaService, issuer)
+	emailAPI := v1.NewEmailAPI(emailService, userService, sessionService)
+	passwordResetAPI := v1.NewPasswordResetAPI(passwordResetService)
 
 	// Start the HTTP server using the Gin framework
 	router := gin.Default()
@@ -42,6 +173,20 @@ func main() {
 	// Set up API routes
 	v1.SetupAccountRouter(router, accountAPI)
 	v1.SetupUserRouter(router, userAPI)
+	v1.SetupTokenRouter(router, tokenAPI)
+	v1.SetupSessionRouter(router, sessionAPI)
+	v1.SetupAPIKeyRouter(router, apiKeyAPI)
+	v1.SetupAdminRouter(router, adminAPI)
+	v1.SetupOAuthRouter(router, oauthAPI)
+	v1.SetupFederationRouter(router, federationAPI)
+	v1.SetupIdentityRouter(router, identityAPI)
+	v1.SetupMFARouter(router, mfaAPI)
+	v1.SetupPasskeyRouter(router, passkeyAPI)
+	v1.SetupMagicLinkRouter(router, magicLinkAPI)
+	v1.SetupPhoneRouter(router, phoneAPI)
+	v1.SetupEmailRouter(router, emailAPI)
+	v1.SetupPasswordResetRouter(router, passwordResetAPI)
+	v1.SetupWellKnownRouter(router)
 
 	// Run the server on port 8080
 	if err := router.Run(":8080"); err != nil {
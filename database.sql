@@ -25,7 +25,18 @@ CREATE TABLE `users` (
   `id` int NOT NULL AUTO_INCREMENT,
   `username` varchar(255) DEFAULT NULL,
   `password` varchar(255) DEFAULT NULL,
-  PRIMARY KEY (`id`)
+  `email` varchar(254) DEFAULT NULL,
+  `email_verified_at` datetime(3) DEFAULT NULL,
+  `pending_email` varchar(254) NOT NULL DEFAULT '',
+  `phone` varchar(16) DEFAULT NULL,
+  `phone_verified_at` datetime(3) DEFAULT NULL,
+  `token_version` int NOT NULL DEFAULT '0',
+  `is_admin` tinyint(1) NOT NULL DEFAULT '0',
+  `password_changed_at` datetime(3) DEFAULT NULL,
+  `must_change_password` tinyint(1) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_users_email` (`email`),
+  UNIQUE KEY `idx_users_phone` (`phone`)
 ) ENGINE=InnoDB AUTO_INCREMENT=9 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
 
 -- ----------------------------
@@ -37,4 +48,313 @@ INSERT INTO `users` (`id`, `username`, `password`) VALUES (2, 'test1', '$2a$10$N
 INSERT INTO `users` (`id`, `username`, `password`) VALUES (4, 'test2', '$2a$10$fZUCik7H7ZUQjpHvMvcQ6eD/qjbUAobCeR2KiEiXYG7.vtyXb1oQW');
 COMMIT;
 
+-- ----------------------------
+-- Table structure for refresh_tokens
+-- ----------------------------
+DROP TABLE IF EXISTS `refresh_tokens`;
+CREATE TABLE `refresh_tokens` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `session_id` int NOT NULL DEFAULT '0',
+  `family_id` varchar(64) NOT NULL,
+  `token_hash` char(64) NOT NULL,
+  `token_version` int NOT NULL DEFAULT '0',
+  `expires_at` datetime(3) NOT NULL,
+  `rotated_at` datetime(3) DEFAULT NULL,
+  `revoked_at` datetime(3) DEFAULT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_refresh_tokens_token_hash` (`token_hash`),
+  KEY `idx_refresh_tokens_user_id` (`user_id`),
+  KEY `idx_refresh_tokens_session_id` (`session_id`),
+  KEY `idx_refresh_tokens_family_id` (`family_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- ----------------------------
+-- Table structure for revoked_tokens
+-- ----------------------------
+DROP TABLE IF EXISTS `revoked_tokens`;
+CREATE TABLE `revoked_tokens` (
+  `jti` varchar(64) NOT NULL,
+  `expires_at` datetime(3) NOT NULL,
+  PRIMARY KEY (`jti`),
+  KEY `idx_revoked_tokens_expires_at` (`expires_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- ----------------------------
+-- Table structure for sessions
+-- ----------------------------
+DROP TABLE IF EXISTS `sessions`;
+CREATE TABLE `sessions` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `token_hash` char(64) DEFAULT NULL,
+  `token_version` int NOT NULL DEFAULT '0',
+  `client_id` varchar(64) NOT NULL DEFAULT '',
+  `scope` varchar(255) NOT NULL DEFAULT '',
+  `device` varchar(255) NOT NULL DEFAULT '',
+  `user_agent` varchar(512) NOT NULL DEFAULT '',
+  `ip` varchar(45) NOT NULL DEFAULT '',
+  `expires_at` datetime(3) NOT NULL,
+  `last_seen_at` datetime(3) NOT NULL,
+  `authenticated_at` datetime(3) NOT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_sessions_token_hash` (`token_hash`),
+  KEY `idx_sessions_user_id` (`user_id`),
+  KEY `idx_sessions_client_id` (`client_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- ----------------------------
+-- Table structure for api_keys
+-- ----------------------------
+DROP TABLE IF EXISTS `api_keys`;
+CREATE TABLE `api_keys` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `prefix` varchar(16) NOT NULL,
+  `key_hash` char(64) NOT NULL,
+  `scopes` varchar(255) NOT NULL DEFAULT '',
+  `expires_at` datetime(3) DEFAULT NULL,
+  `last_used_at` datetime(3) DEFAULT NULL,
+  `last_used_ip` varchar(45) NOT NULL DEFAULT '',
+  `revoked_at` datetime(3) DEFAULT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_api_keys_key_hash` (`key_hash`),
+  KEY `idx_api_keys_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- ----------------------------
+-- Table structure for o_auth_clients
+-- ----------------------------
+DROP TABLE IF EXISTS `o_auth_clients`;
+CREATE TABLE `o_auth_clients` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `client_id` varchar(64) NOT NULL,
+  `secret_hash` char(64) NOT NULL DEFAULT '',
+  `name` varchar(100) NOT NULL,
+  `redirect_uris` text NOT NULL,
+  `scopes` varchar(255) NOT NULL,
+  `grant_types` varchar(255) NOT NULL,
+  `public` tinyint(1) NOT NULL DEFAULT '0',
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_o_auth_clients_client_id` (`client_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- ----------------------------
+-- Table structure for o_auth_authorization_codes
+-- ----------------------------
+DROP TABLE IF EXISTS `o_auth_authorization_codes`;
+CREATE TABLE `o_auth_authorization_codes` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `code_hash` char(64) NOT NULL,
+  `client_id` varchar(64) NOT NULL,
+  `user_id` int NOT NULL,
+  `redirect_uri` varchar(2048) NOT NULL,
+  `scope` varchar(255) NOT NULL DEFAULT '',
+  `code_challenge` varchar(128) NOT NULL,
+  `expires_at` datetime(3) NOT NULL,
+  `used_at` datetime(3) DEFAULT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_o_auth_authorization_codes_code_hash` (`code_hash`),
+  KEY `idx_o_auth_authorization_codes_client_id` (`client_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- ----------------------------
+-- Table structure for identities
+-- ----------------------------
+DROP TABLE IF EXISTS `identities`;
+CREATE TABLE `identities` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `type` varchar(16) NOT NULL,
+  `provider` varchar(64) NOT NULL DEFAULT '',
+  `subject` varchar(255) NOT NULL,
+  `email` varchar(255) NOT NULL DEFAULT '',
+  `last_login_at` datetime(3) DEFAULT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_identity_subject` (`type`,`provider`,`subject`),
+  KEY `idx_identities_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- ----------------------------
+-- Records of identities
+-- ----------------------------
+BEGIN;
+INSERT INTO `identities` (`user_id`, `type`, `subject`, `created_at`) SELECT `id`, 'password', `id`, NOW(3) FROM `users` WHERE `password` <> '';
+COMMIT;
+
+-- ----------------------------
+-- Table structure for totp_credentials
+-- ----------------------------
+DROP TABLE IF EXISTS `totp_credentials`;
+CREATE TABLE `totp_credentials` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `secret` varchar(64) NOT NULL,
+  `confirmed_at` datetime(3) DEFAULT NULL,
+  `last_used_step` bigint NOT NULL DEFAULT '0',
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_totp_credentials_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- ----------------------------
+-- Table structure for recovery_codes
+-- ----------------------------
+DROP TABLE IF EXISTS `recovery_codes`;
+CREATE TABLE `recovery_codes` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `code_hash` char(64) NOT NULL,
+  `used_at` datetime(3) DEFAULT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_recovery_codes_code_hash` (`code_hash`),
+  KEY `idx_recovery_codes_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- ----------------------------
+-- Table structure for mfa_challenges
+-- ----------------------------
+DROP TABLE IF EXISTS `mfa_challenges`;
+CREATE TABLE `mfa_challenges` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `token_hash` char(64) NOT NULL,
+  `user_id` int NOT NULL,
+  `attempts` int NOT NULL DEFAULT '0',
+  `expires_at` datetime(3) NOT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_mfa_challenges_token_hash` (`token_hash`),
+  KEY `idx_mfa_challenges_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- ----------------------------
+-- Table structure for passkeys
+-- ----------------------------
+DROP TABLE IF EXISTS `passkeys`;
+CREATE TABLE `passkeys` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `name` varchar(100) NOT NULL DEFAULT '',
+  `credential_id` varchar(1400) NOT NULL,
+  `credential_hash` char(64) NOT NULL,
+  `public_key` blob NOT NULL,
+  `sign_count` int unsigned NOT NULL DEFAULT '0',
+  `transports` varchar(255) NOT NULL DEFAULT '',
+  `last_used_at` datetime(3) DEFAULT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_passkeys_credential_hash` (`credential_hash`),
+  KEY `idx_passkeys_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- ----------------------------
+-- Table structure for passkey_challenges
+-- ----------------------------
+DROP TABLE IF EXISTS `passkey_challenges`;
+CREATE TABLE `passkey_challenges` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `challenge_hash` char(64) NOT NULL,
+  `purpose` varchar(16) NOT NULL,
+  `user_id` int NOT NULL DEFAULT '0',
+  `expires_at` datetime(3) NOT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_passkey_challenges_challenge_hash` (`challenge_hash`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- ----------------------------
+-- Table structure for rate_limits
+-- ----------------------------
+DROP TABLE IF EXISTS `rate_limits`;
+CREATE TABLE `rate_limits` (
+  `key` varchar(191) NOT NULL,
+  `count` int NOT NULL DEFAULT '0',
+  `expires_at` datetime(3) NOT NULL,
+  PRIMARY KEY (`key`),
+  KEY `idx_rate_limits_expires_at` (`expires_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- ----------------------------
+-- Table structure for magic_links
+-- ----------------------------
+DROP TABLE IF EXISTS `magic_links`;
+CREATE TABLE `magic_links` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `token_hash` char(64) NOT NULL,
+  `email` varchar(254) NOT NULL,
+  `expires_at` datetime(3) NOT NULL,
+  `used_at` datetime(3) DEFAULT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_magic_links_token_hash` (`token_hash`),
+  KEY `idx_magic_links_expires_at` (`expires_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- ----------------------------
+-- Table structure for phone_codes
+-- ----------------------------
+DROP TABLE IF EXISTS `phone_codes`;
+CREATE TABLE `phone_codes` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `phone` varchar(16) NOT NULL,
+  `code_hash` char(64) NOT NULL,
+  `attempts` int NOT NULL DEFAULT '0',
+  `expires_at` datetime(3) NOT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_phone_codes_phone` (`phone`),
+  KEY `idx_phone_codes_expires_at` (`expires_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- ----------------------------
+-- Table structure for password_resets
+-- ----------------------------
+DROP TABLE IF EXISTS `password_resets`;
+CREATE TABLE `password_resets` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `token_hash` char(64) NOT NULL,
+  `user_id` int NOT NULL,
+  `expires_at` datetime(3) NOT NULL,
+  `used_at` datetime(3) DEFAULT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_password_resets_token_hash` (`token_hash`),
+  KEY `idx_password_resets_user_id` (`user_id`),
+  KEY `idx_password_resets_expires_at` (`expires_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- ----------------------------
+-- Table structure for login_failures
+-- ----------------------------
+DROP TABLE IF EXISTS `login_failures`;
+CREATE TABLE `login_failures` (
+  `key` varchar(191) NOT NULL,
+  `failures` int NOT NULL DEFAULT '0',
+  `last_failed_at` datetime(3) NOT NULL,
+  `locked_until` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`key`),
+  KEY `idx_login_failures_last_failed_at` (`last_failed_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- ----------------------------
+-- Table structure for password_histories
+-- ----------------------------
+DROP TABLE IF EXISTS `password_histories`;
+CREATE TABLE `password_histories` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int DEFAULT NULL,
+  `password` varchar(255) DEFAULT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_password_histories_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
 SET FOREIGN_KEY_CHECKS = 1;
@@ -0,0 +1,81 @@
+package common
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"veo/internal/models"
+	"veo/internal/utils"
+	"veo/pkg/errors"
+)
+
+// APIKeyStore looks up API keys and records their use.
+type APIKeyStore interface {
+	GetByHash(keyHash string) (*models.APIKey, error) // Returns nil if the key does not exist
+	Touch(id int, lastUsedAt time.Time, ip string) error
+}
+
+var (
+	apiKeys   APIKeyStore // Store checked by AuthMiddleware for API keys, nil disables them
+	apiKeysMu sync.RWMutex
+)
+
+// UseAPIKeys makes AuthMiddleware accept the API keys found in store next to access tokens.
+func UseAPIKeys(store APIKeyStore) {
+	apiKeysMu.Lock()
+	apiKeys = store
+	apiKeysMu.Unlock()
+}
+
+// currentAPIKeys returns the store installed by UseAPIKeys.
+func currentAPIKeys() APIKeyStore {
+	apiKeysMu.RLock()
+	defer apiKeysMu.RUnlock()
+	return apiKeys
+}
+
+// isAPIKey tells API keys apart from access tokens.
+func isAPIKey(token string) bool {
+	return strings.HasPrefix(token, models.APIKeyPrefix) && currentAPIKeys() != nil
+}
+
+// authenticateAPIKey checks an API key and records its use from ip, unless ip is empty.
+// The claims carry the scopes of the key and the current token version of its owner:
+// A password change leaves API keys working, a password reset or signing out everywhere revokes them.
+func authenticateAPIKey(key, ip string) (*UserClaims, error) {
+	store := currentAPIKeys()
+	apiKey, err := store.GetByHash(utils.HashToken(key))
+	if err != nil {
+		return nil, err
+	}
+	if apiKey == nil || apiKey.RevokedAt != nil || apiKey.User.ID == 0 {
+		return nil, errors.NewAuthFailed("Invalid API key")
+	}
+	if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+		return nil, errors.NewTokenExpired("API key expired")
+	}
+
+	// Record the use, without writing on every single request
+	now := time.Now()
+	if ip != "" && (apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= sessionTouchInterval || apiKey.LastUsedIP != ip) {
+		if err := store.Touch(apiKey.ID, now, ip); err != nil {
+			return nil, err
+		}
+	}
+
+	claims := &UserClaims{
+		ID:           apiKey.UserID,
+		Username:     apiKey.User.Username,
+		TokenVersion: apiKey.User.TokenVersion,
+		Scope:        apiKey.Scopes,
+		RegisteredClaims: RegisteredClaims{
+			Subject:  strconv.Itoa(apiKey.UserID),
+			IssuedAt: apiKey.CreatedAt.Unix(),
+		},
+	}
+	if apiKey.ExpiresAt != nil {
+		claims.ExpiresAt = apiKey.ExpiresAt.Unix()
+	}
+	return claims, nil
+}
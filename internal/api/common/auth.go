@@ -1,44 +1,175 @@
 package common
 
 import (
+	"strconv"
 	"time"
+	"veo/internal/models"
+	"veo/internal/utils"
 	"veo/pkg/errors"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 )
 
-// Secret key used for signing JWT tokens
-var jwtKey = []byte("com.hanson.test.jwt.secret.key")
-
-// Define the JWT expiration duration as 5 hours
+// DefaultAccessTokenTTL is used when no access token lifetime is configured.
+// Access tokens are short-lived, clients renew them with a refresh token.
 const (
-	JWTExpirationDuration = 5 * time.Hour
+	DefaultAccessTokenTTL = 15 * time.Minute
 )
 
 // UserClaims defines the JWT claims structure
 type UserClaims struct {
-	ID       int    `json:"userId"`   // User ID
-	Username string `json:"username"` // Username
-	jwt.StandardClaims
+	ID           int    `json:"userId"`              // User ID
+	Username     string `json:"username"`            // Username
+	TokenVersion int    `json:"tokenVersion"`        // Token version of the user when the token was issued
+	SessionID    int    `json:"sid,omitempty"`       // Login session the token belongs to
+	Scope        string `json:"scope,omitempty"`     // Space separated scopes, empty for interactive sign-ins
+	ClientID     string `json:"client_id,omitempty"` // OAuth client the token was issued to
+	RegisteredClaims
+}
+
+// TokenVersionSource looks up the current token version of a user.
+type TokenVersionSource interface {
+	TokenVersion(userID int) (int, error)
+}
+
+var tokenVersions TokenVersionSource // Checked by AuthMiddleware when set
+
+// UseTokenVersionSource makes AuthMiddleware reject tokens whose version is not the user's current one.
+func UseTokenVersionSource(source TokenVersionSource) {
+	tokenVersions = source
+}
+
+// JWTStrategy is the SessionStrategy issuing signed JWTs, revocation goes through the jti denylist.
+// With a SessionStore, tokens also stop working as soon as their login session is revoked.
+type JWTStrategy struct {
+	Sessions SessionStore // Optional, checked for the session named by the sid claim
+}
+
+// NewJWTStrategy creates a JWT strategy that checks the login session of every token.
+func NewJWTStrategy(sessions SessionStore) JWTStrategy {
+	return JWTStrategy{Sessions: sessions}
+}
+
+// Issue generates a JWT for the user's session, carrying the OAuth client and scope of the session.
+func (JWTStrategy) Issue(user *models.User, session *models.Session) (string, error) {
+	return generateJWT(user, session)
+}
+
+// Authenticate verifies the signature and the registered claims, then checks the denylist
+// and the login session.
+func (s JWTStrategy) Authenticate(token string, audiences []string) (*UserClaims, error) {
+	k, err := currentKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the token and verify it against the key named by its kid,
+	// the claims are validated below so the configured clock skew applies
+	claims := &UserClaims{}
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	parsed, err := parser.ParseWithClaims(token, claims, k.verifyKeyFor)
+	if err != nil || !parsed.Valid {
+		return nil, errors.NewTokenExpired("Authorization fail")
+	}
+
+	// Check the issuer, audience and validity window
+	if len(audiences) == 0 {
+		audiences = k.audiences
+	}
+	if err := claims.Validate(k.issuer, audiences, k.clockSkew); err != nil {
+		return nil, err
+	}
+
+	// Reject tokens that were revoked before they expired
+	if claims.Id == "" {
+		return nil, errors.NewAuthFailed("Authorization fail")
+	}
+	revoked, err := currentDenylist().IsRevoked(claims.Id)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, errors.NewTokenExpired("Token has been revoked")
+	}
+
+	if s.Sessions != nil {
+		session, err := s.Sessions.GetByID(claims.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if session == nil || time.Now().After(session.ExpiresAt) {
+			return nil, errors.NewTokenExpired("Session has been revoked")
+		}
+		if _, err := touchSession(s.Sessions, session, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return claims, nil
+}
+
+// Revoke puts the token on the denylist until it expires, and ends its login session.
+func (s JWTStrategy) Revoke(claims *UserClaims) error {
+	if err := RevokeJWT(claims); err != nil {
+		return err
+	}
+	if s.Sessions != nil && claims.SessionID != 0 {
+		return s.Sessions.Delete(claims.SessionID)
+	}
+	return nil
+}
+
+// TTL returns the lifetime of the JWTs signed by the current keyring.
+func (JWTStrategy) TTL() time.Duration {
+	k, err := currentKeyring()
+	if err != nil {
+		return DefaultAccessTokenTTL
+	}
+	return k.accessTTL
+}
+
+// GenerateJWT generates a JWT token for the given user and login session.
+func GenerateJWT(user *models.User, sessionID int) (string, error) {
+	return generateJWT(user, &models.Session{ID: sessionID})
 }
 
-// GenerateJWT generates a JWT token for a given user ID and username.
-func GenerateJWT(ID int, username string) (string, error) {
-	expirationTime := time.Now().Add(JWTExpirationDuration) // Set expiration time
+// generateJWT generates a JWT token for the user and session. Tokens of the client credentials
+// grant have no user, their subject is the client.
+func generateJWT(user *models.User, session *models.Session) (string, error) {
+	k, err := currentKeyring()
+	if err != nil {
+		return "", err
+	}
+
+	// A unique token ID lets a single token be revoked
+	jti, err := utils.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	expirationTime := now.Add(k.accessTTL) // Set expiration time
 	claims := &UserClaims{
-		ID:       ID,
-		Username: username,
-		StandardClaims: jwt.StandardClaims{
+		ID:           user.ID,
+		Username:     user.Username,
+		TokenVersion: user.TokenVersion,
+		SessionID:    session.ID,
+		Scope:        session.Scope,
+		ClientID:     session.ClientID,
+		RegisteredClaims: RegisteredClaims{
+			Issuer:    k.issuer,
+			Subject:   subject(user.ID, session.ClientID),
+			Audience:  k.audiences,
 			ExpiresAt: expirationTime.Unix(), // Token expiration timestamp
+			NotBefore: now.Unix(),
+			IssuedAt:  now.Unix(),
+			Id:        jti, // Token ID checked against the denylist
 		},
 	}
 
-	// Create a new JWT token with claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Sign the token using the secret key
-	tokenString, err := token.SignedString(jwtKey)
+	// Sign the token with the active key
+	tokenString, err := k.sign(claims)
 	if err != nil {
 		return "", err
 	}
@@ -46,37 +177,100 @@ func GenerateJWT(ID int, username string) (string, error) {
 	return tokenString, nil
 }
 
-// AuthMiddleware is a JWT authentication middleware.
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware authenticates the request with the configured session strategy, or with an API key.
+// Routes may name the audiences they accept, otherwise the configured audiences are accepted.
+func AuthMiddleware(audiences ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Retrieve the JWT token from the Authorization header
-		tokenString := c.GetHeader("Authorization")
-		if tokenString == "" {
-			// Return an error if no token is provided
-			RespondError(c, errors.NewAuthFailed("Authorization fail"))
-			c.Abort()
-			return
-		}
-
-		// Parse the token and extract claims
-		claims := &UserClaims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
-
-		// Check if the token is valid
-		if err != nil || !token.Valid {
-			// Return an error if the token is expired or invalid
-			RespondError(c, errors.NewTokenExpired("Authorization fail"))
-			c.Abort()
+		claims, err := Authenticate(c, audiences...)
+		if AbortIfError(c, err) {
 			return
 		}
 
 		// Store user information in the request context
 		c.Set("userId", claims.ID)
 		c.Set("username", claims.Username)
+		c.Set("claims", claims)
 
 		// Continue with the request
 		c.Next()
 	}
 }
+
+// Authenticate checks the access token of a request like AuthMiddleware does and returns its claims,
+// for handlers of public routes that also act on a signed in user.
+func Authenticate(c *gin.Context, audiences ...string) (*UserClaims, error) {
+	// Retrieve the access token from the Authorization header or, in browser mode, the cookie
+	tokenString, fromCookie := tokenFromRequest(c)
+	if tokenString == "" {
+		// Return an error if no token is provided
+		return nil, errors.NewAuthFailed("Authorization fail")
+	}
+
+	// Cookies are attached by the browser automatically, so state-changing requests must prove
+	// they come from our frontend. Header tokens are not exposed to cross-site requests.
+	if fromCookie {
+		if err := VerifyCSRF(c); err != nil {
+			return nil, err
+		}
+	}
+
+	// Check that the token is valid, has not expired and was not revoked
+	claims, err := verifyToken(tokenString, !fromCookie, audiences, c.ClientIP())
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens of the client credentials grant are meant for other resource servers, our endpoints act for a user
+	if claims.ID == 0 {
+		return nil, errors.NewPermissionDenied("Token does not belong to a user")
+	}
+	return claims, nil
+}
+
+// IntrospectToken checks an access token or API key on behalf of another resource server
+// and returns its claims. Like at our own endpoints the token must be meant for one of the configured
+// audiences, the response lists its audiences so the caller can check it is one of them.
+func IntrospectToken(token string) (*UserClaims, error) {
+	k, err := currentKeyring()
+	if err != nil {
+		return nil, err
+	}
+	return verifyToken(token, true, k.audiences, "")
+}
+
+// verifyToken authenticates an access token with the configured session strategy or, when allowed,
+// an API key used from ip, then checks that the token was not revoked by a token version change.
+// API keys are only allowed from headers, the use of a key is not recorded when ip is empty.
+func verifyToken(token string, allowAPIKey bool, audiences []string, ip string) (*UserClaims, error) {
+	var claims *UserClaims
+	var err error
+	if allowAPIKey && isAPIKey(token) {
+		claims, err = authenticateAPIKey(token, ip)
+	} else {
+		claims, err = currentStrategy().Authenticate(token, audiences)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Reject tokens issued before a password change, account deletion or sign out everywhere
+	if tokenVersions != nil && claims.ID != 0 {
+		version, err := tokenVersions.TokenVersion(claims.ID)
+		if _, ok := err.(*errors.Error); ok || (err == nil && version != claims.TokenVersion) {
+			return nil, errors.NewTokenExpired("Token has been revoked")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return claims, nil
+}
+
+// subject returns the sub claim: the user, or the client for tokens without a user.
+func subject(userID int, clientID string) string {
+	if userID == 0 && clientID != "" {
+		return clientID
+	}
+	return strconv.Itoa(userID)
+}
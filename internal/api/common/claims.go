@@ -0,0 +1,94 @@
+package common
+
+import (
+	"encoding/json"
+	"time"
+	"veo/pkg/errors"
+)
+
+// Audience is the aud claim. It accepts a single string or an array of strings,
+// and is encoded as a plain string when it holds one value so single-audience verifiers keep working.
+type Audience []string
+
+// UnmarshalJSON decodes either form of the aud claim.
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+// MarshalJSON encodes the aud claim.
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// Contains reports whether any of the given audiences is in the claim.
+func (a Audience) Contains(audiences ...string) bool {
+	for _, want := range audiences {
+		for _, have := range a {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RegisteredClaims holds the registered JWT claims (RFC 7519).
+// Unlike jwt.StandardClaims it supports tokens meant for several audiences.
+type RegisteredClaims struct {
+	Issuer    string   `json:"iss,omitempty"` // Service that issued the token
+	Subject   string   `json:"sub,omitempty"` // User the token was issued to
+	Audience  Audience `json:"aud,omitempty"` // Services the token is meant for
+	ExpiresAt int64    `json:"exp,omitempty"` // Expiration timestamp
+	NotBefore int64    `json:"nbf,omitempty"` // Timestamp before which the token must be rejected
+	IssuedAt  int64    `json:"iat,omitempty"` // Issue timestamp
+	Id        string   `json:"jti,omitempty"` // Unique token ID
+}
+
+// Valid checks the time based claims without any clock skew. It satisfies jwt.Claims,
+// which lets other services parse our tokens with jwt-go directly.
+func (c RegisteredClaims) Valid() error {
+	return c.validateTimes(time.Now(), 0)
+}
+
+// Validate checks every registered claim: the token must come from issuer, be meant for
+// one of the accepted audiences and be within its validity window, allowing for skew.
+func (c RegisteredClaims) Validate(issuer string, audiences []string, skew time.Duration) error {
+	if err := c.validateTimes(time.Now(), skew); err != nil {
+		return err
+	}
+	if c.Issuer != issuer {
+		return errors.NewAuthFailed("Token issuer is not accepted")
+	}
+	if !c.Audience.Contains(audiences...) {
+		return errors.NewAuthFailed("Token audience is not accepted")
+	}
+	return nil
+}
+
+// validateTimes checks exp, nbf and iat against now.
+func (c RegisteredClaims) validateTimes(now time.Time, skew time.Duration) error {
+	if c.ExpiresAt == 0 || now.Add(-skew).Unix() > c.ExpiresAt {
+		return errors.NewTokenExpired("Token expired")
+	}
+	if c.NotBefore != 0 && now.Add(skew).Unix() < c.NotBefore {
+		return errors.NewAuthFailed("Token is not valid yet")
+	}
+	if c.IssuedAt != 0 && now.Add(skew).Unix() < c.IssuedAt {
+		return errors.NewAuthFailed("Token was issued in the future")
+	}
+	return nil
+}
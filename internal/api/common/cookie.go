@@ -0,0 +1,164 @@
+package common
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"veo/internal/configs"
+	"veo/internal/utils"
+	"veo/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Names of the cookies and headers used by the browser mode
+const (
+	AccessTokenCookie  = "access_token"  // HttpOnly cookie carrying the JWT
+	RefreshTokenCookie = "refresh_token" // HttpOnly cookie carrying the refresh token, only sent to /api/token
+	CSRFCookie         = "csrf_token"    // Cookie readable by JavaScript, echoed back in CSRFHeader
+	CSRFHeader         = "X-CSRF-Token"  // Header carrying the double-submit CSRF token
+	AuthModeHeader     = "X-Auth-Mode"   // Set to "cookie" by browser clients that want cookies
+	refreshCookiePath  = "/api/token"
+)
+
+var (
+	cookieConfig   configs.CookieConfig // Browser mode settings installed by InitCookies
+	cookieConfigMu sync.RWMutex
+)
+
+// InitCookies configures the browser cookie mode.
+func InitCookies(config configs.CookieConfig) {
+	cookieConfigMu.Lock()
+	cookieConfig = config
+	cookieConfigMu.Unlock()
+}
+
+// currentCookieConfig returns the settings installed by InitCookies.
+func currentCookieConfig() configs.CookieConfig {
+	cookieConfigMu.RLock()
+	defer cookieConfigMu.RUnlock()
+	return cookieConfig
+}
+
+// WantsCookies reports whether the client asked for the browser cookie mode and it is enabled.
+func WantsCookies(c *gin.Context) bool {
+	return currentCookieConfig().Enabled && strings.EqualFold(c.GetHeader(AuthModeHeader), "cookie")
+}
+
+// SetAuthCookies stores the tokens in HttpOnly cookies and issues a fresh CSRF token,
+// which is returned so the client can read it without parsing cookies.
+func SetAuthCookies(c *gin.Context, accessToken string, accessTTL time.Duration, refreshToken string, refreshTTL time.Duration) (string, error) {
+	csrfToken, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	setCookie(c, AccessTokenCookie, accessToken, "/", accessTTL, true)
+	if refreshToken != "" {
+		setCookie(c, RefreshTokenCookie, refreshToken, refreshCookiePath, refreshTTL, true)
+	}
+	// The CSRF cookie must outlive the access token, it is needed to call the refresh endpoint
+	setCookie(c, CSRFCookie, csrfToken, "/", refreshTTL, false)
+	return csrfToken, nil
+}
+
+// ClearAuthCookies removes every cookie set by SetAuthCookies.
+func ClearAuthCookies(c *gin.Context) {
+	if !currentCookieConfig().Enabled {
+		return
+	}
+
+	setCookie(c, AccessTokenCookie, "", "/", -1, true)
+	setCookie(c, RefreshTokenCookie, "", refreshCookiePath, -1, true)
+	setCookie(c, CSRFCookie, "", "/", -1, false)
+}
+
+// RefreshTokenFromCookie returns the refresh token sent as a cookie, if the browser mode is enabled.
+func RefreshTokenFromCookie(c *gin.Context) string {
+	if !currentCookieConfig().Enabled {
+		return ""
+	}
+	token, _ := c.Cookie(RefreshTokenCookie)
+	return token
+}
+
+// VerifyCSRF checks the double-submit token: the CSRF header must match the CSRF cookie.
+// Safe methods are exempt since they must not change state.
+func VerifyCSRF(c *gin.Context) error {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+
+	cookie, err := c.Cookie(CSRFCookie)
+	header := c.GetHeader(CSRFHeader)
+	if err != nil || cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) != 1 {
+		return errors.NewPermissionDenied("Invalid CSRF token")
+	}
+	return nil
+}
+
+// tokenFromRequest extracts the access token from the Authorization header, falling back to
+// the access token cookie in browser mode. fromCookie tells whether CSRF protection applies.
+func tokenFromRequest(c *gin.Context) (token string, fromCookie bool) {
+	if header := c.GetHeader("Authorization"); header != "" {
+		scheme, credentials, found := strings.Cut(header, " ")
+		if !found {
+			// Bare tokens are still accepted from clients written before the Bearer scheme
+			return header, false
+		}
+		if !strings.EqualFold(scheme, "Bearer") {
+			return "", false
+		}
+		return strings.TrimSpace(credentials), false
+	}
+
+	if currentCookieConfig().Enabled {
+		if cookie, err := c.Cookie(AccessTokenCookie); err == nil && cookie != "" {
+			return cookie, true
+		}
+	}
+	return "", false
+}
+
+// SetStateCookie keeps the state of a sign-in at an external site, such as an identity provider, until the
+// user comes back. It is HttpOnly and always lax, the strict mode would drop it on the redirect back to us.
+// A negative ttl removes the cookie. It works whether or not the browser cookie mode is enabled.
+func SetStateCookie(c *gin.Context, name, value, path string, ttl time.Duration) {
+	writeCookie(c, name, value, path, ttl, true, http.SameSiteLaxMode)
+}
+
+// setCookie writes a cookie with the configured domain, Secure and SameSite attributes.
+func setCookie(c *gin.Context, name, value, path string, ttl time.Duration, httpOnly bool) {
+	sameSite := http.SameSiteLaxMode
+	switch strings.ToLower(currentCookieConfig().SameSite) {
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+	writeCookie(c, name, value, path, ttl, httpOnly, sameSite)
+}
+
+// writeCookie writes a cookie with the configured domain and Secure attribute.
+func writeCookie(c *gin.Context, name, value, path string, ttl time.Duration, httpOnly bool, sameSite http.SameSite) {
+	config := currentCookieConfig()
+
+	maxAge := int(ttl.Seconds())
+	if ttl < 0 {
+		maxAge = -1
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   config.Domain,
+		MaxAge:   maxAge,
+		Secure:   !config.AllowInsecure,
+		HttpOnly: httpOnly,
+		SameSite: sameSite,
+	})
+}
@@ -0,0 +1,78 @@
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenDenylist records the IDs (jti) of revoked tokens. Entries only need to be
+// kept until the token would have expired on its own.
+type TokenDenylist interface {
+	Revoke(jti string, expiresAt time.Time) error // Revoke rejects the token until expiresAt
+	IsRevoked(jti string) (bool, error)           // IsRevoked reports whether the token was revoked
+}
+
+// MemoryDenylist is an in-process TokenDenylist, suitable for a single instance.
+type MemoryDenylist struct {
+	mutex   sync.Mutex
+	entries map[string]time.Time
+}
+
+// NewMemoryDenylist creates an empty in-memory denylist.
+func NewMemoryDenylist() *MemoryDenylist {
+	return &MemoryDenylist{entries: make(map[string]time.Time)}
+}
+
+// Revoke adds the token to the denylist and drops entries that have expired.
+func (d *MemoryDenylist) Revoke(jti string, expiresAt time.Time) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := time.Now()
+	for id, exp := range d.entries {
+		if now.After(exp) {
+			delete(d.entries, id)
+		}
+	}
+
+	d.entries[jti] = expiresAt
+	return nil
+}
+
+// IsRevoked reports whether the token is on the denylist and has not expired yet.
+func (d *MemoryDenylist) IsRevoked(jti string) (bool, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	exp, ok := d.entries[jti]
+	return ok && time.Now().Before(exp), nil
+}
+
+var (
+	denylist   TokenDenylist = NewMemoryDenylist() // Denylist consulted by AuthMiddleware
+	denylistMu sync.RWMutex
+)
+
+// UseDenylist replaces the denylist used to revoke tokens.
+func UseDenylist(d TokenDenylist) {
+	denylistMu.Lock()
+	denylist = d
+	denylistMu.Unlock()
+}
+
+// currentDenylist returns the denylist installed by UseDenylist.
+func currentDenylist() TokenDenylist {
+	denylistMu.RLock()
+	defer denylistMu.RUnlock()
+	return denylist
+}
+
+// RevokeJWT revokes a token by its claims, it stays rejected until it expires. Tokens are accepted
+// for the clock skew past their exp, compared in whole seconds, so the entry is kept as long.
+func RevokeJWT(claims *UserClaims) error {
+	expiresAt := time.Unix(claims.ExpiresAt, 0)
+	if k, err := currentKeyring(); err == nil {
+		expiresAt = expiresAt.Add(k.clockSkew + time.Second)
+	}
+	return currentDenylist().Revoke(claims.Id, expiresAt)
+}
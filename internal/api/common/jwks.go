@@ -0,0 +1,87 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWK is the JSON Web Key representation of a public verification key (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`           // Key type: RSA, EC or OKP
+	Kid string `json:"kid"`           // Key ID matching the token header
+	Use string `json:"use"`           // Always "sig"
+	Alg string `json:"alg"`           // Signing algorithm
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA public exponent
+	Crv string `json:"crv,omitempty"` // Curve name for EC and OKP keys
+	X   string `json:"x,omitempty"`   // EC x coordinate or Ed25519 public key
+	Y   string `json:"y,omitempty"`   // EC y coordinate
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys that verifiers should trust: the active and retiring keys. HMAC keys
+// are never published, pending keys are left out until they sign tokens, and retired keys so downstream
+// services stop accepting their tokens.
+func (k *Keyring) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+
+	for _, key := range k.keys {
+		if key.status != KeyActive && key.status != KeyRetiring {
+			continue
+		}
+
+		jwk := JWK{Kid: key.kid, Use: "sig", Alg: key.method.Alg()}
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = encodeJWKBytes(pub.N.Bytes())
+			jwk.E = encodeJWKBytes(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = pub.Curve.Params().Name
+			jwk.X = encodeJWKBytes(pub.X.FillBytes(make([]byte, size)))
+			jwk.Y = encodeJWKBytes(pub.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = encodeJWKBytes(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	// Keep the output stable between requests
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+// encodeJWKBytes encodes key material as unpadded base64url.
+func encodeJWKBytes(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// JWKSHandler serves the current key set in the standard JWKS format.
+func JWKSHandler(c *gin.Context) {
+	k, err := currentKeyring()
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+
+	// Let verifiers cache the set, but not across a rotation step
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, k.JWKS())
+}
@@ -0,0 +1,242 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"veo/internal/configs"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// KeyStatus describes where a signing key is in its rotation lifecycle.
+type KeyStatus string
+
+const (
+	KeyPending  KeyStatus = "pending"  // Verifies tokens, not yet used for signing
+	KeyActive   KeyStatus = "active"   // Signs new tokens and verifies them
+	KeyRetiring KeyStatus = "retiring" // Verifies tokens it signed earlier
+	KeyRetired  KeyStatus = "retired"  // Rejected, tokens signed with it are no longer valid
+)
+
+// signingKey is a single entry in the keyring.
+type signingKey struct {
+	kid       string
+	status    KeyStatus
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// Keyring holds the keys used to sign and verify JWT tokens, indexed by key ID,
+// along with the claims every token signed by them carries.
+type Keyring struct {
+	keys      map[string]*signingKey
+	active    *signingKey
+	accessTTL time.Duration // Lifetime of the access tokens signed by this keyring
+	issuer    string        // iss claim
+	audiences []string      // Default aud claim
+	clockSkew time.Duration // Tolerance when checking exp, nbf and iat
+}
+
+var (
+	keyring   *Keyring     // Keyring used by GenerateJWT and AuthMiddleware
+	keyringMu sync.RWMutex // Guards keyring so it can be swapped while serving requests
+)
+
+// NewKeyring builds a keyring from the configured keys.
+func NewKeyring(config configs.JWTConfig) (*Keyring, error) {
+	k := &Keyring{
+		keys:      make(map[string]*signingKey),
+		accessTTL: config.AccessTokenTTL,
+		issuer:    config.Issuer,
+		audiences: config.Audiences,
+		clockSkew: config.ClockSkew,
+	}
+	if k.accessTTL <= 0 {
+		k.accessTTL = DefaultAccessTokenTTL
+	}
+	if k.issuer == "" {
+		return nil, fmt.Errorf("no jwt issuer configured")
+	}
+	if len(k.audiences) == 0 {
+		return nil, fmt.Errorf("no jwt audience configured")
+	}
+
+	for _, kc := range config.Keys {
+		if kc.KID == "" {
+			return nil, fmt.Errorf("jwt key is missing a kid")
+		}
+		if _, exists := k.keys[kc.KID]; exists {
+			return nil, fmt.Errorf("duplicate jwt kid '%s'", kc.KID)
+		}
+
+		status := KeyStatus(kc.Status)
+		switch status {
+		case KeyPending, KeyActive, KeyRetiring, KeyRetired:
+		default:
+			return nil, fmt.Errorf("jwt key '%s' has unknown status '%s'", kc.KID, kc.Status)
+		}
+
+		key, err := loadSigningKey(kc)
+		if err != nil {
+			return nil, err
+		}
+		key.status = status
+
+		if status == KeyActive {
+			if k.active != nil {
+				return nil, fmt.Errorf("jwt keys '%s' and '%s' are both active", k.active.kid, kc.KID)
+			}
+			k.active = key
+		}
+		k.keys[kc.KID] = key
+	}
+
+	if k.active == nil {
+		return nil, fmt.Errorf("no active jwt key configured")
+	}
+
+	return k, nil
+}
+
+// InitJWT loads the keyring from configuration. It may be called again to rotate keys at runtime.
+func InitJWT(config configs.JWTConfig) error {
+	k, err := NewKeyring(config)
+	if err != nil {
+		return err
+	}
+
+	keyringMu.Lock()
+	keyring = k
+	keyringMu.Unlock()
+	return nil
+}
+
+// currentKeyring returns the keyring installed by InitJWT.
+func currentKeyring() (*Keyring, error) {
+	keyringMu.RLock()
+	defer keyringMu.RUnlock()
+
+	if keyring == nil {
+		return nil, fmt.Errorf("jwt keyring is not initialized")
+	}
+	return keyring, nil
+}
+
+// loadSigningKey resolves the signing method and key material for a configured key.
+func loadSigningKey(kc configs.JWTKeyConfig) (*signingKey, error) {
+	key := &signingKey{kid: kc.KID}
+
+	switch kc.Algorithm {
+	case "", jwt.SigningMethodHS256.Alg():
+		if kc.Secret == "" {
+			return nil, fmt.Errorf("jwt key '%s' has an empty secret", kc.KID)
+		}
+		key.method = jwt.SigningMethodHS256
+		key.signKey = []byte(kc.Secret)
+		key.verifyKey = []byte(kc.Secret)
+		return key, nil
+	case jwt.SigningMethodRS256.Alg():
+		key.method = jwt.SigningMethodRS256
+	case jwt.SigningMethodES256.Alg():
+		key.method = jwt.SigningMethodES256
+	case SigningMethodEdDSA.Alg():
+		key.method = SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("jwt key '%s' has unsupported algorithm '%s'", kc.KID, kc.Algorithm)
+	}
+
+	privateKey, err := readPrivateKey(kc.PrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("jwt key '%s': %v", kc.KID, err)
+	}
+
+	// Make sure the key type matches the algorithm, ES256 additionally requires the P-256 curve
+	switch pk := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if key.method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("jwt key '%s' holds an RSA key but uses %s", kc.KID, kc.Algorithm)
+		}
+		key.signKey, key.verifyKey = pk, &pk.PublicKey
+	case *ecdsa.PrivateKey:
+		if key.method != jwt.SigningMethodES256 || pk.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("jwt key '%s' holds a %s key but uses %s", kc.KID, pk.Curve.Params().Name, kc.Algorithm)
+		}
+		key.signKey, key.verifyKey = pk, &pk.PublicKey
+	case ed25519.PrivateKey:
+		if key.method != SigningMethodEdDSA {
+			return nil, fmt.Errorf("jwt key '%s' holds an Ed25519 key but uses %s", kc.KID, kc.Algorithm)
+		}
+		key.signKey, key.verifyKey = pk, pk.Public()
+	default:
+		return nil, fmt.Errorf("jwt key '%s' has unsupported key type %T", kc.KID, privateKey)
+	}
+
+	return key, nil
+}
+
+// readPrivateKey reads a PEM encoded PKCS#8, PKCS#1 or SEC 1 private key from disk.
+func readPrivateKey(path string) (interface{}, error) {
+	if path == "" {
+		return nil, fmt.Errorf("no private key file configured")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block '%s' in %s", block.Type, path)
+	}
+}
+
+// sign signs the token with the active key and stamps its kid into the header.
+func (k *Keyring) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.active.method, claims)
+	token.Header["kid"] = k.active.kid
+	return token.SignedString(k.active.signKey)
+}
+
+// verifyKeyFor is a jwt.Keyfunc that resolves the verification key from the token's kid.
+func (k *Keyring) verifyKeyFor(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("token has no kid")
+	}
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid '%s'", kid)
+	}
+	if key.status == KeyRetired {
+		return nil, fmt.Errorf("kid '%s' is retired", kid)
+	}
+
+	// Refuse tokens whose alg does not match the key, e.g. an HS256 token forged with a public key
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for kid '%s'", token.Method.Alg(), kid)
+	}
+
+	return key.verifyKey, nil
+}
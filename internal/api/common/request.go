@@ -35,3 +35,13 @@ func ParseForm(c *gin.Context, out interface{}) bool {
 	}
 	return true
 }
+
+// ParseURI parses the path parameters into the specified struct.
+// Returns true if binding is successful, otherwise sends an error response and returns false.
+func ParseURI(c *gin.Context, out interface{}) bool {
+	if err := c.ShouldBindUri(out); err != nil {
+		RespondError(c, errors.NewInvalidParams("Invalid path parameters"))
+		return false
+	}
+	return true
+}
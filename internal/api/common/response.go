@@ -2,6 +2,7 @@ package common
 
 import (
 	"net/http"
+	"veo/pkg/errors"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,10 +12,19 @@ type Response struct {
 	Code    int         `json:"code"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
+	Errors  interface{} `json:"errors,omitempty"` // Fields of the request that were refused
 }
 
 // RespondError sends an error response
 func RespondError(c *gin.Context, err error) {
+	if customErr, ok := err.(*errors.Error); ok && len(customErr.Fields) > 0 {
+		c.JSON(http.StatusOK, Response{
+			Code:    customErr.GetCode(),
+			Message: err.Error(),
+			Errors:  customErr.Fields,
+		})
+		return
+	}
 	if customErr, ok := err.(interface{ GetCode() int }); ok {
 		c.JSON(http.StatusOK, Response{
 			Code:    customErr.GetCode(),
@@ -0,0 +1,44 @@
+package common
+
+import (
+	"strings"
+	"veo/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Scopes returns the scopes the credential was limited to, none for interactive sign-ins.
+func (c *UserClaims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// HasScope reports whether the credential may be used for scope.
+// Credentials without any scope come from an interactive sign-in and may do everything.
+func (c *UserClaims) HasScope(scope string) bool {
+	scopes := c.Scopes()
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope aborts the request unless the credential checked by AuthMiddleware grants one of the scopes.
+// It must be used after AuthMiddleware.
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := c.MustGet("claims").(*UserClaims)
+		for _, scope := range scopes {
+			if claims.HasScope(scope) {
+				c.Next()
+				return
+			}
+		}
+		RespondError(c, errors.NewPermissionDenied("Missing scope "+strings.Join(scopes, " or ")))
+		c.Abort()
+	}
+}
@@ -0,0 +1,156 @@
+package common
+
+import (
+	"sync"
+	"time"
+	"veo/internal/models"
+	"veo/internal/utils"
+	"veo/pkg/errors"
+)
+
+// SessionStrategy issues the access tokens handed to clients and turns them back into
+// the claims AuthMiddleware stores in the request context. Every access token is bound
+// to a login session, which is created before the token is issued.
+type SessionStrategy interface {
+	Issue(user *models.User, session *models.Session) (string, error)   // Issue creates an access token for the session
+	Authenticate(token string, audiences []string) (*UserClaims, error) // Authenticate validates an access token
+	Revoke(claims *UserClaims) error                                    // Revoke invalidates the access token the claims came from
+	TTL() time.Duration                                                 // TTL returns the lifetime of new access tokens
+}
+
+var (
+	strategy   SessionStrategy = JWTStrategy{} // Strategy used by IssueAccessToken and AuthMiddleware
+	strategyMu sync.RWMutex
+)
+
+// UseSessionStrategy replaces the strategy used to issue and authenticate access tokens.
+func UseSessionStrategy(s SessionStrategy) {
+	strategyMu.Lock()
+	strategy = s
+	strategyMu.Unlock()
+}
+
+// currentStrategy returns the strategy installed by UseSessionStrategy.
+func currentStrategy() SessionStrategy {
+	strategyMu.RLock()
+	defer strategyMu.RUnlock()
+	return strategy
+}
+
+// IssueAccessToken creates an access token for the user's session with the configured strategy.
+func IssueAccessToken(user *models.User, session *models.Session) (string, error) {
+	return currentStrategy().Issue(user, session)
+}
+
+// RevokeAccessToken invalidates the access token the claims were read from.
+func RevokeAccessToken(claims *UserClaims) error {
+	return currentStrategy().Revoke(claims)
+}
+
+// AccessTokenTTL returns the lifetime of newly issued access tokens.
+func AccessTokenTTL() time.Duration {
+	return currentStrategy().TTL()
+}
+
+// DefaultSessionTTL is used when no session lifetime is configured
+const DefaultSessionTTL = 24 * time.Hour
+
+// sessionTouchInterval limits how often the sliding expiry of a session is written back
+const sessionTouchInterval = time.Minute
+
+// SessionStore looks up and updates login sessions.
+type SessionStore interface {
+	GetByID(id int) (*models.Session, error)                  // Returns nil if the session does not exist
+	GetByTokenHash(tokenHash string) (*models.Session, error) // Returns nil if the session does not exist
+	SetToken(id int, tokenHash string, expiresAt time.Time) error
+	Touch(id int, lastSeenAt, expiresAt time.Time) error
+	Delete(id int) error
+}
+
+// touchSession records activity on a session, without writing on every single request.
+// With slide set the expiry is pushed back by slide as well.
+func touchSession(store SessionStore, session *models.Session, slide time.Duration) (time.Time, error) {
+	now := time.Now()
+	expiresAt := session.ExpiresAt
+	if now.Sub(session.LastSeenAt) < sessionTouchInterval {
+		return expiresAt, nil
+	}
+
+	if slide > 0 {
+		expiresAt = now.Add(slide)
+	}
+	return expiresAt, store.Touch(session.ID, now, expiresAt)
+}
+
+// OpaqueSessionStrategy issues random session tokens backed by a SessionStore.
+// Sessions can be revoked instantly and expire after ttl without activity.
+type OpaqueSessionStrategy struct {
+	store SessionStore
+	ttl   time.Duration
+}
+
+// NewOpaqueSessionStrategy creates a session strategy with a sliding expiry of ttl.
+func NewOpaqueSessionStrategy(store SessionStore, ttl time.Duration) *OpaqueSessionStrategy {
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	return &OpaqueSessionStrategy{store: store, ttl: ttl}
+}
+
+// Issue sets a new random token on the session, only its hash is stored.
+// Issuing again for the same session, on refresh, replaces the previous token.
+func (s *OpaqueSessionStrategy) Issue(user *models.User, session *models.Session) (string, error) {
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.store.SetToken(session.ID, utils.HashToken(token), time.Now().Add(s.ttl)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Authenticate looks the session up and extends its expiry. Sessions belong to this
+// deployment only, so audiences do not apply.
+func (s *OpaqueSessionStrategy) Authenticate(token string, audiences []string) (*UserClaims, error) {
+	session, err := s.store.GetByTokenHash(utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, errors.NewTokenExpired("Authorization fail")
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, errors.NewTokenExpired("Session expired")
+	}
+
+	expiresAt, err := touchSession(s.store, session, s.ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserClaims{
+		ID:           session.UserID,
+		Username:     session.User.Username,
+		TokenVersion: session.TokenVersion,
+		SessionID:    session.ID,
+		Scope:        session.Scope,
+		ClientID:     session.ClientID,
+		RegisteredClaims: RegisteredClaims{
+			Subject:   subject(session.UserID, session.ClientID),
+			ExpiresAt: expiresAt.Unix(),
+			IssuedAt:  session.CreatedAt.Unix(),
+		},
+	}, nil
+}
+
+// Revoke deletes the session.
+func (s *OpaqueSessionStrategy) Revoke(claims *UserClaims) error {
+	return s.store.Delete(claims.SessionID)
+}
+
+// TTL returns the idle timeout of sessions.
+func (s *OpaqueSessionStrategy) TTL() time.Duration {
+	return s.ttl
+}
@@ -0,0 +1,89 @@
+package common_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"veo/internal/api/common"
+	"veo/internal/models"
+	"veo/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryAPIKeys is an APIKeyStore backed by a map of key hashes.
+type memoryAPIKeys map[string]*models.APIKey
+
+func (m memoryAPIKeys) GetByHash(keyHash string) (*models.APIKey, error) {
+	key, ok := m[keyHash]
+	if !ok {
+		return nil, nil
+	}
+	found := *key
+	return &found, nil
+}
+
+func (m memoryAPIKeys) Touch(id int, lastUsedAt time.Time, ip string) error {
+	for _, key := range m {
+		if key.ID == id {
+			key.LastUsedAt = &lastUsedAt
+			key.LastUsedIP = ip
+		}
+	}
+	return nil
+}
+
+// TestAPIKeys verifies that API keys authenticate next to JWTs, record their use and are limited to their scopes.
+func TestAPIKeys(t *testing.T) {
+	assert.NoError(t, common.InitJWT(keys("k1", "active")))
+	alice := models.User{ID: 1, Username: "alice", TokenVersion: 3}
+	expired := time.Now().Add(-time.Minute)
+	store := memoryAPIKeys{
+		utils.HashToken("veo_profile"): {ID: 1, UserID: 1, User: alice, Scopes: models.ScopeProfile},
+		utils.HashToken("veo_expired"): {ID: 2, UserID: 1, User: alice, Scopes: models.ScopeProfile, ExpiresAt: &expired},
+		utils.HashToken("veo_revoked"): {ID: 3, UserID: 1, User: alice, Scopes: models.ScopeProfile, RevokedAt: &expired},
+	}
+	common.UseAPIKeys(store)
+	defer common.UseAPIKeys(nil)
+
+	router := gin.New()
+	router.Use(common.AuthMiddleware())
+	router.GET("/profile", common.RequireScope(models.ScopeProfile), func(c *gin.Context) { common.RespondMessage(c, "ok") })
+	router.GET("/account", common.RequireScope(models.ScopeAccount), func(c *gin.Context) { common.RespondMessage(c, "ok") })
+
+	jwt, err := common.GenerateJWT(&alice, 0)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		token    string
+		path     string
+		accepted bool
+	}{
+		{token: "Bearer veo_profile", path: "/profile", accepted: true},
+		{token: "Bearer veo_profile", path: "/account", accepted: false},
+		{token: "Bearer veo_expired", path: "/profile", accepted: false},
+		{token: "Bearer veo_revoked", path: "/profile", accepted: false},
+		{token: "Bearer veo_unknown", path: "/profile", accepted: false},
+		{token: "Bearer " + jwt, path: "/profile", accepted: true},
+		{token: "Bearer " + jwt, path: "/account", accepted: true},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("Authorization", tt.token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp common.Response
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, tt.accepted, resp.Code == http.StatusOK, tt.token[:14]+" "+tt.path)
+	}
+
+	// The last use is recorded
+	used := store[utils.HashToken("veo_profile")]
+	assert.NotNil(t, used.LastUsedAt)
+	assert.Equal(t, "192.0.2.1", used.LastUsedIP)
+}
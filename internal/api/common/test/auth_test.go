@@ -0,0 +1,166 @@
+package common_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"veo/internal/api/common"
+	"veo/internal/configs"
+	"veo/internal/models"
+	"veo/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// keys builds a JWT config from kid/status pairs, deriving each secret from its kid.
+func keys(pairs ...string) configs.JWTConfig {
+	cfg := configs.JWTConfig{Issuer: "https://auth.test", Audiences: []string{"api"}}
+	for i := 0; i < len(pairs); i += 2 {
+		cfg.Keys = append(cfg.Keys, configs.JWTKeyConfig{
+			KID:    pairs[i],
+			Secret: "secret-" + pairs[i],
+			Status: pairs[i+1],
+		})
+	}
+	return cfg
+}
+
+// authorize sends the token through AuthMiddleware and reports whether it was accepted.
+func authorize(t *testing.T, token string) bool {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/", common.AuthMiddleware(), func(c *gin.Context) {
+		common.RespondData(c, c.MustGet("username"))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp common.Response
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.Code == http.StatusOK
+}
+
+// TestKeyRotation verifies that tokens survive a rotation until their key is retired.
+func TestKeyRotation(t *testing.T) {
+	assert.NoError(t, common.InitJWT(keys("k1", "active", "k2", "pending")))
+	token, err := common.GenerateJWT(&models.User{ID: 1, Username: "alice"}, 0)
+	assert.NoError(t, err)
+	assert.True(t, authorize(t, token), "token signed by the active key")
+
+	// Promote k2, k1 keeps verifying the tokens it signed
+	assert.NoError(t, common.InitJWT(keys("k1", "retiring", "k2", "active")))
+	assert.True(t, authorize(t, token), "token signed by a retiring key")
+
+	rotated, err := common.GenerateJWT(&models.User{ID: 1, Username: "alice"}, 0)
+	assert.NoError(t, err)
+	assert.True(t, authorize(t, rotated), "token signed by the new active key")
+
+	// Once retired, k1 tokens are rejected
+	assert.NoError(t, common.InitJWT(keys("k1", "retired", "k2", "active")))
+	assert.False(t, authorize(t, token), "token signed by a retired key")
+	assert.True(t, authorize(t, rotated))
+
+	// Unknown kids are rejected as well
+	assert.NoError(t, common.InitJWT(keys("k3", "active")))
+	assert.False(t, authorize(t, rotated), "token signed by an unknown key")
+}
+
+// TestKeyringValidation verifies that malformed keyrings are refused.
+func TestKeyringValidation(t *testing.T) {
+	assert.Error(t, common.InitJWT(keys("k1", "pending")), "no active key")
+	assert.Error(t, common.InitJWT(keys("k1", "active", "k2", "active")), "two active keys")
+	assert.Error(t, common.InitJWT(keys("k1", "active", "k1", "retiring")), "duplicate kid")
+	assert.Error(t, common.InitJWT(keys("k1", "unknown")), "unknown status")
+}
+
+// TestRevokeJWT verifies that a revoked token is rejected while other tokens keep working.
+func TestRevokeJWT(t *testing.T) {
+	assert.NoError(t, common.InitJWT(keys("k1", "active")))
+	common.UseDenylist(common.NewMemoryDenylist())
+
+	token, err := common.GenerateJWT(&models.User{ID: 1, Username: "alice"}, 0)
+	assert.NoError(t, err)
+	other, err := common.GenerateJWT(&models.User{ID: 1, Username: "alice"}, 0)
+	assert.NoError(t, err)
+	assert.True(t, authorize(t, token))
+
+	// Revoke the token the same way the logout endpoint does
+	router := gin.New()
+	router.POST("/logout", common.AuthMiddleware(), func(c *gin.Context) {
+		assert.NoError(t, common.RevokeJWT(c.MustGet("claims").(*common.UserClaims)))
+	})
+	req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req.Header.Set("Authorization", token)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.False(t, authorize(t, token), "revoked token")
+	assert.True(t, authorize(t, other), "token with another jti")
+}
+
+// TestRevokeJWTWithinSkew verifies that a revoked token stays rejected while the clock skew still accepts it past its exp.
+func TestRevokeJWTWithinSkew(t *testing.T) {
+	cfg := keys("k1", "active")
+	cfg.AccessTokenTTL = time.Second
+	cfg.ClockSkew = 30 * time.Second
+	assert.NoError(t, common.InitJWT(cfg))
+	common.UseDenylist(common.NewMemoryDenylist())
+
+	token, err := common.GenerateJWT(&models.User{ID: 1, Username: "alice"}, 0)
+	assert.NoError(t, err)
+	other, err := common.GenerateJWT(&models.User{ID: 1, Username: "alice"}, 0)
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.POST("/logout", common.AuthMiddleware(), func(c *gin.Context) {
+		assert.NoError(t, common.RevokeJWT(c.MustGet("claims").(*common.UserClaims)))
+	})
+	req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req.Header.Set("Authorization", token)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Past exp, but within the skew
+	time.Sleep(2100 * time.Millisecond)
+	assert.True(t, authorize(t, other), "expired token within the skew")
+	assert.False(t, authorize(t, token), "revoked token within the skew")
+}
+
+// versions is a TokenVersionSource backed by a map.
+type versions map[int]int
+
+func (v versions) TokenVersion(userID int) (int, error) {
+	version, ok := v[userID]
+	if !ok {
+		return 0, errors.NewUserNotFound("User not found")
+	}
+	return version, nil
+}
+
+// TestTokenVersion verifies that bumping a user's token version revokes the tokens issued before.
+func TestTokenVersion(t *testing.T) {
+	assert.NoError(t, common.InitJWT(keys("k1", "active")))
+	source := versions{1: 0}
+	common.UseTokenVersionSource(source)
+	defer common.UseTokenVersionSource(nil)
+
+	token, err := common.GenerateJWT(&models.User{ID: 1, Username: "alice"}, 0)
+	assert.NoError(t, err)
+	assert.True(t, authorize(t, token))
+
+	// Password change or sign out everywhere
+	source[1] = 1
+	assert.False(t, authorize(t, token), "token with an outdated version")
+
+	fresh, err := common.GenerateJWT(&models.User{ID: 1, Username: "alice", TokenVersion: 1}, 0)
+	assert.NoError(t, err)
+	assert.True(t, authorize(t, fresh))
+
+	// Deleted account
+	delete(source, 1)
+	assert.False(t, authorize(t, fresh), "token of a deleted user")
+}
@@ -0,0 +1,95 @@
+package common_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"veo/internal/api/common"
+	"veo/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestValidateClaims verifies issuer, audience and time checks, including the clock skew.
+func TestValidateClaims(t *testing.T) {
+	now := time.Now()
+	valid := common.RegisteredClaims{
+		Issuer:    "https://auth.test",
+		Audience:  common.Audience{"api", "admin"},
+		ExpiresAt: now.Add(time.Minute).Unix(),
+		NotBefore: now.Unix(),
+		IssuedAt:  now.Unix(),
+	}
+	skew := 30 * time.Second
+
+	tests := []struct {
+		name          string
+		modify        func(c *common.RegisteredClaims)
+		audiences     []string
+		expectedError bool
+	}{
+		{name: "valid", modify: func(c *common.RegisteredClaims) {}, audiences: []string{"api"}},
+		{name: "second audience", modify: func(c *common.RegisteredClaims) {}, audiences: []string{"other", "admin"}},
+		{name: "other audience", modify: func(c *common.RegisteredClaims) {}, audiences: []string{"other"}, expectedError: true},
+		{name: "other issuer", modify: func(c *common.RegisteredClaims) { c.Issuer = "https://evil.test" }, audiences: []string{"api"}, expectedError: true},
+		{name: "expired within skew", modify: func(c *common.RegisteredClaims) { c.ExpiresAt = now.Add(-10 * time.Second).Unix() }, audiences: []string{"api"}},
+		{name: "expired", modify: func(c *common.RegisteredClaims) { c.ExpiresAt = now.Add(-time.Minute).Unix() }, audiences: []string{"api"}, expectedError: true},
+		{name: "missing exp", modify: func(c *common.RegisteredClaims) { c.ExpiresAt = 0 }, audiences: []string{"api"}, expectedError: true},
+		{name: "nbf within skew", modify: func(c *common.RegisteredClaims) { c.NotBefore = now.Add(10 * time.Second).Unix() }, audiences: []string{"api"}},
+		{name: "not valid yet", modify: func(c *common.RegisteredClaims) { c.NotBefore = now.Add(time.Minute).Unix() }, audiences: []string{"api"}, expectedError: true},
+		{name: "issued in the future", modify: func(c *common.RegisteredClaims) { c.IssuedAt = now.Add(time.Minute).Unix() }, audiences: []string{"api"}, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid
+			tt.modify(&claims)
+			err := claims.Validate("https://auth.test", tt.audiences, skew)
+			if tt.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestAudienceJSON verifies that aud is read in both forms and written as a string when single.
+func TestAudienceJSON(t *testing.T) {
+	var aud common.Audience
+	assert.NoError(t, json.Unmarshal([]byte(`"api"`), &aud))
+	assert.Equal(t, common.Audience{"api"}, aud)
+	assert.NoError(t, json.Unmarshal([]byte(`["api","admin"]`), &aud))
+	assert.Equal(t, common.Audience{"api", "admin"}, aud)
+
+	single, _ := json.Marshal(common.Audience{"api"})
+	assert.Equal(t, `"api"`, string(single))
+	multiple, _ := json.Marshal(common.Audience{"api", "admin"})
+	assert.Equal(t, `["api","admin"]`, string(multiple))
+}
+
+// TestRouteAudience verifies that a route only accepts the audiences it declares.
+func TestRouteAudience(t *testing.T) {
+	assert.NoError(t, common.InitJWT(keys("k1", "active")))
+	token, err := common.GenerateJWT(&models.User{ID: 1, Username: "alice"}, 0)
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/default", common.AuthMiddleware(), func(c *gin.Context) { common.RespondMessage(c, "ok") })
+	router.GET("/api", common.AuthMiddleware("api"), func(c *gin.Context) { common.RespondMessage(c, "ok") })
+	router.GET("/billing", common.AuthMiddleware("billing"), func(c *gin.Context) { common.RespondMessage(c, "ok") })
+
+	for path, accepted := range map[string]bool{"/default": true, "/api": true, "/billing": false} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp common.Response
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, accepted, resp.Code == http.StatusOK, path)
+	}
+}
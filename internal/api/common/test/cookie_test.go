@@ -0,0 +1,87 @@
+package common_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"veo/internal/api/common"
+	"veo/internal/configs"
+	"veo/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestBearerScheme verifies the accepted forms of the Authorization header.
+func TestBearerScheme(t *testing.T) {
+	assert.NoError(t, common.InitJWT(keys("k1", "active")))
+	token, err := common.GenerateJWT(&models.User{ID: 1, Username: "alice"}, 0)
+	assert.NoError(t, err)
+
+	assert.True(t, authorize(t, "Bearer "+token))
+	assert.True(t, authorize(t, "bearer "+token))
+	assert.True(t, authorize(t, token), "bare token")
+	assert.False(t, authorize(t, "Basic "+token), "other scheme")
+	assert.False(t, authorize(t, "Bearer "), "empty token")
+}
+
+// TestCookieMode verifies cookie authentication and the double-submit CSRF check.
+func TestCookieMode(t *testing.T) {
+	assert.NoError(t, common.InitJWT(keys("k1", "active")))
+	common.InitCookies(configs.CookieConfig{Enabled: true, SameSite: "strict"})
+	defer common.InitCookies(configs.CookieConfig{})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/login", func(c *gin.Context) {
+		assert.True(t, common.WantsCookies(c))
+		token, _ := common.GenerateJWT(&models.User{ID: 1, Username: "alice"}, 0)
+		csrf, err := common.SetAuthCookies(c, token, time.Minute, "refresh", time.Hour)
+		assert.NoError(t, err)
+		common.RespondData(c, csrf)
+	})
+	protected := router.Group("/", common.AuthMiddleware())
+	protected.GET("/info", func(c *gin.Context) { common.RespondMessage(c, "ok") })
+	protected.POST("/updatePassword", func(c *gin.Context) { common.RespondMessage(c, "ok") })
+
+	// Log in and collect the cookies
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+	req.Header.Set(common.AuthModeHeader, "cookie")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var login common.Response
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+	csrf := login.Data.(string)
+
+	cookies := w.Result().Cookies()
+	assert.Len(t, cookies, 3)
+	for _, cookie := range cookies {
+		assert.True(t, cookie.Secure, cookie.Name)
+		assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite, cookie.Name)
+		assert.Equal(t, cookie.Name != common.CSRFCookie, cookie.HttpOnly, cookie.Name)
+	}
+
+	call := func(method, path, csrfHeader string) bool {
+		req := httptest.NewRequest(method, path, nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		if csrfHeader != "" {
+			req.Header.Set(common.CSRFHeader, csrfHeader)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp common.Response
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Code == http.StatusOK
+	}
+
+	assert.True(t, call(http.MethodGet, "/info", ""), "safe method without CSRF token")
+	assert.False(t, call(http.MethodPost, "/updatePassword", ""), "missing CSRF token")
+	assert.False(t, call(http.MethodPost, "/updatePassword", "forged"), "wrong CSRF token")
+	assert.True(t, call(http.MethodPost, "/updatePassword", csrf), "matching CSRF token")
+}
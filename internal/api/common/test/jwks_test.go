@@ -0,0 +1,135 @@
+package common_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"veo/internal/api/common"
+	"veo/internal/configs"
+	"veo/internal/models"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeKey stores a private key as a PKCS#8 PEM file and returns its path.
+func writeKey(t *testing.T, name string, key crypto.PrivateKey) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), name+".pem")
+	assert.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+	return path
+}
+
+// fetchJWKS requests the published key set.
+func fetchJWKS(t *testing.T) common.JWKS {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/.well-known/jwks.json", common.JWKSHandler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var set common.JWKS
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &set))
+	return set
+}
+
+// publicKey rebuilds a verification key from its JWK, the way a downstream service would.
+func publicKey(t *testing.T, jwk common.JWK) interface{} {
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		assert.NoError(t, err)
+		return b
+	}
+
+	switch jwk.Kty {
+	case "RSA":
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(decode(jwk.N)), E: int(new(big.Int).SetBytes(decode(jwk.E)).Int64())}
+	case "EC":
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(decode(jwk.X)), Y: new(big.Int).SetBytes(decode(jwk.Y))}
+	case "OKP":
+		return ed25519.PublicKey(decode(jwk.X))
+	}
+	t.Fatalf("unexpected kty %s", jwk.Kty)
+	return nil
+}
+
+// TestAsymmetricSigning verifies tokens from every asymmetric algorithm offline using only the JWKS.
+func TestAsymmetricSigning(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		alg string
+		key crypto.PrivateKey
+	}{
+		{alg: "RS256", key: rsaKey},
+		{alg: "ES256", key: ecKey},
+		{alg: "EdDSA", key: edKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			assert.NoError(t, common.InitJWT(configs.JWTConfig{Issuer: "https://auth.test", Audiences: []string{"api"}, Keys: []configs.JWTKeyConfig{
+				{KID: "hmac", Secret: "secret", Status: "retiring"},
+				{KID: "old", Algorithm: tt.alg, PrivateKeyFile: writeKey(t, "old", tt.key), Status: "retired"},
+				{KID: "previous", Algorithm: tt.alg, PrivateKeyFile: writeKey(t, "previous", tt.key), Status: "retiring"},
+				{KID: tt.alg, Algorithm: tt.alg, PrivateKeyFile: writeKey(t, tt.alg, tt.key), Status: "active"},
+				{KID: "next", Algorithm: tt.alg, PrivateKeyFile: writeKey(t, "next", tt.key), Status: "pending"},
+			}}))
+
+			token, err := common.GenerateJWT(&models.User{ID: 7, Username: "alice"}, 0)
+			assert.NoError(t, err)
+			assert.True(t, authorize(t, token))
+
+			// Only the active and retiring asymmetric keys are published
+			set := fetchJWKS(t)
+			assert.Len(t, set.Keys, 2)
+			assert.Equal(t, tt.alg, set.Keys[0].Kid)
+			assert.Equal(t, "previous", set.Keys[1].Kid)
+			assert.Equal(t, tt.alg, set.Keys[0].Alg)
+
+			claims := &common.UserClaims{}
+			parsed, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+				return publicKey(t, set.Keys[0]), nil
+			})
+			assert.NoError(t, err)
+			assert.True(t, parsed.Valid)
+			assert.Equal(t, 7, claims.ID)
+		})
+	}
+}
+
+// TestAsymmetricKeyMismatch verifies that a key file must match its declared algorithm.
+func TestAsymmetricKeyMismatch(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	assert.Error(t, common.InitJWT(configs.JWTConfig{Issuer: "https://auth.test", Audiences: []string{"api"}, Keys: []configs.JWTKeyConfig{
+		{KID: "k1", Algorithm: "RS256", PrivateKeyFile: writeKey(t, "k1", edKey), Status: "active"},
+	}}), "Ed25519 key used as RS256")
+	assert.Error(t, common.InitJWT(configs.JWTConfig{Issuer: "https://auth.test", Audiences: []string{"api"}, Keys: []configs.JWTKeyConfig{
+		{KID: "k1", Algorithm: "ES256", PrivateKeyFile: writeKey(t, "k1", ecKey), Status: "active"},
+	}}), "P-384 key used as ES256")
+	assert.Error(t, common.InitJWT(configs.JWTConfig{Issuer: "https://auth.test", Audiences: []string{"api"}, Keys: []configs.JWTKeyConfig{
+		{KID: "k1", Algorithm: "EdDSA", Status: "active"},
+	}}), "missing key file")
+}
@@ -0,0 +1,182 @@
+package common_test
+
+import (
+	"testing"
+	"time"
+	"veo/internal/api/common"
+	"veo/internal/models"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memorySessions is a SessionStore backed by a map.
+type memorySessions struct {
+	sessions map[int]*models.Session
+	users    map[int]models.User
+}
+
+// start records a login session the way SessionService.Start does.
+func (m *memorySessions) start(user models.User) *models.Session {
+	session := &models.Session{ID: len(m.sessions) + 1, UserID: user.ID, TokenVersion: user.TokenVersion, ExpiresAt: time.Now().Add(time.Hour), LastSeenAt: time.Now(), CreatedAt: time.Now()}
+	m.sessions[session.ID] = session
+	return session
+}
+
+func (m *memorySessions) GetByID(id int) (*models.Session, error) {
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	found := *session
+	found.User = m.users[session.UserID]
+	return &found, nil
+}
+
+func (m *memorySessions) GetByTokenHash(tokenHash string) (*models.Session, error) {
+	for _, session := range m.sessions {
+		if session.TokenHash != nil && *session.TokenHash == tokenHash {
+			return m.GetByID(session.ID)
+		}
+	}
+	return nil, nil
+}
+
+func (m *memorySessions) SetToken(id int, tokenHash string, expiresAt time.Time) error {
+	m.sessions[id].TokenHash = &tokenHash
+	m.sessions[id].ExpiresAt = expiresAt
+	return nil
+}
+
+func (m *memorySessions) Touch(id int, lastSeenAt, expiresAt time.Time) error {
+	m.sessions[id].LastSeenAt = lastSeenAt
+	m.sessions[id].ExpiresAt = expiresAt
+	return nil
+}
+
+func (m *memorySessions) Delete(id int) error {
+	delete(m.sessions, id)
+	return nil
+}
+
+// TestOpaqueSessionStrategy verifies issuing, sliding expiry and revocation of server-side sessions.
+func TestOpaqueSessionStrategy(t *testing.T) {
+	alice := models.User{ID: 1, Username: "alice"}
+	store := &memorySessions{sessions: map[int]*models.Session{}, users: map[int]models.User{1: alice}}
+	common.UseSessionStrategy(common.NewOpaqueSessionStrategy(store, time.Hour))
+	defer common.UseSessionStrategy(common.JWTStrategy{})
+
+	token, err := common.IssueAccessToken(&alice, store.start(alice))
+	assert.NoError(t, err)
+	assert.True(t, authorize(t, "Bearer "+token), "handlers still see the username")
+	assert.Equal(t, time.Hour, common.AccessTokenTTL())
+
+	// An idle session gets its expiry pushed back
+	store.sessions[1].LastSeenAt = time.Now().Add(-10 * time.Minute)
+	store.sessions[1].ExpiresAt = time.Now().Add(time.Minute)
+	assert.True(t, authorize(t, token))
+	assert.True(t, store.sessions[1].ExpiresAt.After(time.Now().Add(50*time.Minute)), "sliding expiry")
+
+	// Expired sessions are rejected
+	store.sessions[1].ExpiresAt = time.Now().Add(-time.Second)
+	assert.False(t, authorize(t, token), "expired session")
+
+	// Revocation is immediate
+	other, err := common.IssueAccessToken(&alice, store.start(alice))
+	assert.NoError(t, err)
+	claims, err := common.NewOpaqueSessionStrategy(store, time.Hour).Authenticate(other, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, claims.SessionID)
+	assert.NoError(t, common.RevokeAccessToken(claims))
+	assert.False(t, authorize(t, other), "revoked session")
+	assert.False(t, authorize(t, "unknown"), "unknown session")
+}
+
+// TestJWTSessions verifies that JWTs stop working once their login session is revoked.
+func TestJWTSessions(t *testing.T) {
+	assert.NoError(t, common.InitJWT(keys("k1", "active")))
+	alice := models.User{ID: 1, Username: "alice"}
+	store := &memorySessions{sessions: map[int]*models.Session{}, users: map[int]models.User{1: alice}}
+	common.UseSessionStrategy(common.NewJWTStrategy(store))
+	defer common.UseSessionStrategy(common.JWTStrategy{})
+
+	first, err := common.IssueAccessToken(&alice, store.start(alice))
+	assert.NoError(t, err)
+	second, err := common.IssueAccessToken(&alice, store.start(alice))
+	assert.NoError(t, err)
+	assert.True(t, authorize(t, first))
+	assert.True(t, authorize(t, second))
+
+	// Activity is recorded, at most once a minute
+	store.sessions[1].LastSeenAt = time.Now().Add(-10 * time.Minute)
+	assert.True(t, authorize(t, first))
+	assert.WithinDuration(t, time.Now(), store.sessions[1].LastSeenAt, time.Second)
+
+	// Revoking one session leaves the other device signed in
+	assert.NoError(t, store.Delete(1))
+	assert.False(t, authorize(t, first), "revoked session")
+	assert.True(t, authorize(t, second))
+
+	// Tokens without a session are rejected
+	orphan, err := common.GenerateJWT(&alice, 0)
+	assert.NoError(t, err)
+	assert.False(t, authorize(t, orphan), "token without session")
+}
+
+// TestIntrospectToken verifies that client tokens can be introspected but not used to act as a user.
+func TestIntrospectToken(t *testing.T) {
+	assert.NoError(t, common.InitJWT(keys("k1", "active")))
+	store := &memorySessions{sessions: map[int]*models.Session{}, users: map[int]models.User{}}
+	common.UseSessionStrategy(common.NewJWTStrategy(store))
+	defer common.UseSessionStrategy(common.JWTStrategy{})
+
+	session := store.start(models.User{})
+	session.ClientID, session.Scope = "svc", models.ScopeProfile
+	token, err := common.IssueAccessToken(&models.User{}, session)
+	assert.NoError(t, err)
+	assert.False(t, authorize(t, token), "client token used as a user")
+
+	claims, err := common.IntrospectToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "svc", claims.ClientID)
+	assert.Equal(t, models.ScopeProfile, claims.Scope)
+
+	// Revoked grants are no longer active
+	assert.NoError(t, store.Delete(session.ID))
+	_, err = common.IntrospectToken(token)
+	assert.Error(t, err)
+}
+
+// TestIntrospectTokenAudience verifies that introspection accepts tokens meant for any of the configured
+// audiences, reporting them, and refuses tokens meant for another audience.
+func TestIntrospectTokenAudience(t *testing.T) {
+	cfg := keys("k1", "active")
+	cfg.Audiences = []string{"api", "billing"}
+	assert.NoError(t, common.InitJWT(cfg))
+	common.UseSessionStrategy(common.JWTStrategy{})
+
+	// sign issues a token of k1 meant for the audience
+	sign := func(audience string) string {
+		now := time.Now()
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, &common.UserClaims{ClientID: "svc", RegisteredClaims: common.RegisteredClaims{
+			Issuer:    cfg.Issuer,
+			Subject:   "svc",
+			Audience:  common.Audience{audience},
+			ExpiresAt: now.Add(time.Minute).Unix(),
+			IssuedAt:  now.Unix(),
+			Id:        "introspect-" + audience,
+		}})
+		token.Header["kid"] = "k1"
+		signed, err := token.SignedString([]byte("secret-k1"))
+		assert.NoError(t, err)
+		return signed
+	}
+
+	claims, err := common.IntrospectToken(sign("billing"))
+	require.NoError(t, err)
+	assert.Equal(t, common.Audience{"billing"}, claims.Audience)
+
+	_, err = common.IntrospectToken(sign("elsewhere"))
+	assert.Error(t, err, "token meant for an audience that is not configured")
+}
@@ -2,6 +2,7 @@ package v1
 
 import (
 	"veo/internal/api/common"
+	"veo/internal/models"
 	"veo/internal/service"
 	"veo/pkg/errors"
 
@@ -10,26 +11,39 @@ import (
 
 // 导入 common 包中的函数到当前包
 var (
-	ParseRequest   = common.ParseRequest
-	ParseQuery     = common.ParseQuery
-	ParseForm      = common.ParseForm
-	AbortIfError   = common.AbortIfError
-	RespondData    = common.RespondData
-	RespondMessage = common.RespondMessage
-	GenerateJWT    = common.GenerateJWT
-	AuthMiddleware = common.AuthMiddleware
-	NewUserExists  = errors.NewUserExists
-	NewAuthFailed  = errors.NewAuthFailed
+	ParseRequest     = common.ParseRequest
+	ParseQuery       = common.ParseQuery
+	ParseForm        = common.ParseForm
+	ParseURI         = common.ParseURI
+	AbortIfError     = common.AbortIfError
+	RespondData      = common.RespondData
+	RespondMessage   = common.RespondMessage
+	IssueAccessToken = common.IssueAccessToken
+	AuthMiddleware   = common.AuthMiddleware
+	RequireScope     = common.RequireScope
+	NewUserExists    = errors.NewUserExists
+	NewAuthFailed    = errors.NewAuthFailed
 )
 
+// MFAChallenge is returned by Login instead of the tokens when the user has a second factor
+type MFAChallenge struct {
+	MFARequired    bool   `json:"mfaRequired"`
+	ChallengeToken string `json:"challengeToken"` // Sent to /api/login/mfa together with the code
+	ExpiresIn      int    `json:"expiresIn"`      // Challenge lifetime in seconds
+}
+
 // AccountAPI handles user authentication and account management
 type AccountAPI struct {
-	userService service.UserService
+	userService    service.UserService
+	mfaService     service.MFAService
+	emailService   service.EmailService
+	lockoutService service.LockoutService
+	issuer         *TokenIssuer
 }
 
 // NewAccountAPI creates a new instance of AccountAPI
-func NewAccountAPI(userService service.UserService) *AccountAPI {
-	return &AccountAPI{userService: userService}
+func NewAccountAPI(userService service.UserService, mfaService service.MFAService, emailService service.EmailService, lockoutService service.LockoutService, issuer *TokenIssuer) *AccountAPI {
+	return &AccountAPI{userService: userService, mfaService: mfaService, emailService: emailService, lockoutService: lockoutService, issuer: issuer}
 }
 
 // SetupAccountRouter configures account-related routes
@@ -39,59 +53,154 @@ func SetupAccountRouter(router *gin.Engine, api *AccountAPI) {
 	// Public endpoints (No authentication required)
 	protected.POST("/register", api.Register)
 	protected.POST("/login", api.Login)
+	protected.POST("/login/mfa", api.LoginMFA)
+
+	// Also reachable with the restricted token of a user who must change its password first
+	password := router.Group("/api", AuthMiddleware(), RequireScope(models.ScopeAccount, models.ScopePasswordChange))
+	{
+		password.POST("/updatePassword", api.UpdatePassword)
+		password.POST("/logout", api.Logout)
+	}
 
 	// Protected endpoints (Require JWT authentication)
-	protected.Use(AuthMiddleware())
+	protected.Use(AuthMiddleware(), RequireScope(models.ScopeAccount))
 	{
-		protected.POST("/updatePassword", api.UpdatePassword)
+		protected.POST("/signOutEverywhere", api.SignOutEverywhere)
 	}
 }
 
-// Register handles user registration
+// Register handles user registration. A verification link is sent to the email address, when verification
+// is required the user signs in once the address is verified.
 func (api *AccountAPI) Register(c *gin.Context) {
 	var req struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
+		Email    string `json:"email"`  // Optional unless verification is required
+		Device   string `json:"device"` // Optional label of the device signing in
 	}
 	if !ParseRequest(c, &req) {
 		return
 	}
 
-	user, err := api.userService.Register(req.Username, req.Password)
-	if AbortIfError(c, err) {
+	if req.Email == "" && api.emailService.Required() {
+		AbortIfError(c, errors.NewInvalidParams("An email address is required"))
 		return
 	}
+	if req.Email != "" {
+		if _, err := api.emailService.Normalize(req.Email); AbortIfError(c, err) {
+			return
+		}
+	}
 
-	token, err := GenerateJWT(user.ID, user.Username)
+	user, err := api.userService.Register(req.Username, req.Password)
 	if AbortIfError(c, err) {
 		return
 	}
 
-	RespondData(c, token)
+	if req.Email != "" {
+		// The account exists either way, signing in sends a new link if this one was not sent
+		if err := api.emailService.ChangeEmail(user, req.Email); err != nil {
+			logger.Errorf("failed to send the verification link of user %d: %v", user.ID, err)
+		}
+		if api.emailService.Required() {
+			RespondMessage(c, "Account created, open the link sent to your email address to verify it and sign in")
+			return
+		}
+	}
+
+	api.issuer.SignIn(c, user, req.Device)
 }
 
-// Login handles user authentication
+// Login handles user authentication. Users with a second factor get a challenge token instead of
+// the tokens, they complete the sign-in at LoginMFA. Repeated failures slow down and then lock out
+// the username and the IP.
 func (api *AccountAPI) Login(c *gin.Context) {
 	var req struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
+		Device   string `json:"device"` // Optional label of the device signing in
 	}
 
 	if !ParseRequest(c, &req) {
 		return
 	}
 
-	user, err := api.userService.Login(req.Username, req.Password)
+	var user *models.User
+	err := api.lockoutService.AttemptFirstFactor(req.Username, c.ClientIP(), func() (err error) {
+		user, err = api.userService.Login(req.Username, req.Password)
+		return err
+	})
 	if AbortIfError(c, err) {
 		return
 	}
+	if AbortIfError(c, api.emailService.CheckVerified(user)) {
+		return
+	}
+
+	// Failures are forgotten once the sign-in is done, after the second factor when there is one
+	if signInOrChallenge(c, api.mfaService, api.issuer, user, req.Device) {
+		if err := api.lockoutService.Succeed(user.Username); err != nil {
+			logger.Errorf("failed to forget the failed sign-ins of user %d: %v", user.ID, err)
+		}
+	}
+}
+
+// LoginMFA completes a sign-in started by Login with a code of the authenticator app or a recovery code.
+// Wrong codes count as failed sign-ins of the user.
+func (api *AccountAPI) LoginMFA(c *gin.Context) {
+	var req struct {
+		ChallengeToken string `json:"challengeToken"`
+		Code           string `json:"code"`
+		Device         string `json:"device"` // Optional label of the device signing in
+	}
+
+	if !ParseRequest(c, &req) {
+		return
+	}
 
-	token, err := GenerateJWT(user.ID, user.Username)
+	user, err := completeChallenge(c, api.mfaService, api.lockoutService, req.ChallengeToken, req.Code)
 	if AbortIfError(c, err) {
 		return
 	}
 
-	RespondData(c, token)
+	api.issuer.SignIn(c, user, req.Device)
+}
+
+// signInOrChallenge signs the user in, or responds with an MFA challenge completed at LoginMFA
+// when the user has a second factor. It reports whether the user was signed in.
+func signInOrChallenge(c *gin.Context, mfaService service.MFAService, issuer *TokenIssuer, user *models.User, device string) bool {
+	enabled, err := mfaService.Enabled(user.ID)
+	if AbortIfError(c, err) {
+		return false
+	}
+	if enabled {
+		token, err := mfaService.StartChallenge(user.ID)
+		if AbortIfError(c, err) {
+			return false
+		}
+		RespondData(c, &MFAChallenge{MFARequired: true, ChallengeToken: token, ExpiresIn: int(service.MFAChallengeTTL.Seconds())})
+		return false
+	}
+
+	issuer.SignIn(c, user, device)
+	return !c.IsAborted()
+}
+
+// completeChallenge checks the code entered for an MFA challenge. Wrong codes count against the user
+// like wrong passwords, so starting new challenges does not allow guessing on, and a correct one
+// completes the sign-in and forgets the failures.
+func completeChallenge(c *gin.Context, mfaService service.MFAService, lockoutService service.LockoutService, token, code string) (*models.User, error) {
+	pending, err := mfaService.ChallengeUser(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *models.User
+	err = lockoutService.Attempt(pending.Username, c.ClientIP(), func() (err error) {
+		user, err = mfaService.CompleteChallenge(token, code)
+		return err
+	})
+	return user, err
 }
 
 // UpdatePassword allows users to change their password
@@ -106,9 +215,67 @@ func (api *AccountAPI) UpdatePassword(c *gin.Context) {
 	}
 
 	id := c.MustGet("userId").(int)
-	if AbortIfError(c, api.userService.UpdatePassword(id, req.OldPassword, req.NewPassword)) {
+	err := api.lockoutService.Attempt(c.MustGet("username").(string), c.ClientIP(), func() error {
+		return api.userService.UpdatePassword(id, req.OldPassword, req.NewPassword)
+	})
+	if AbortIfError(c, err) {
+		return
+	}
+
+	// The password change revoked every session, including the caller's, so start a new one on this device
+	user, err := api.userService.GetUserByID(id)
+	if AbortIfError(c, err) {
+		return
+	}
+
+	claims := c.MustGet("claims").(*common.UserClaims)
+	if AbortIfError(c, api.issuer.sessionService.Revoke(id, claims.SessionID)) {
+		return
+	}
+
+	api.issuer.SignIn(c, user, "")
+}
+
+// Logout ends the caller's session, revoking its access token and the refresh tokens issued with it
+func (api *AccountAPI) Logout(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+
+	// The request body is optional
+	if c.Request.ContentLength > 0 && !ParseRequest(c, &req) {
+		return
+	}
+
+	claims := c.MustGet("claims").(*common.UserClaims)
+	if AbortIfError(c, api.issuer.sessionService.Revoke(claims.ID, claims.SessionID)) {
+		return
+	}
+	if AbortIfError(c, common.RevokeAccessToken(claims)) {
+		return
+	}
+
+	// Refresh tokens of browser clients are sent as a cookie
+	if req.RefreshToken == "" {
+		req.RefreshToken = common.RefreshTokenFromCookie(c)
+	}
+	common.ClearAuthCookies(c)
+
+	if req.RefreshToken != "" {
+		if AbortIfError(c, api.issuer.tokenService.RevokeRefreshToken(claims.ID, req.RefreshToken)) {
+			return
+		}
+	}
+
+	RespondMessage(c, "Logged out successfully")
+}
+
+// SignOutEverywhere revokes every access and refresh token of the caller, on all devices, and its API keys
+func (api *AccountAPI) SignOutEverywhere(c *gin.Context) {
+	id := c.MustGet("userId").(int)
+	if AbortIfError(c, api.userService.SignOutEverywhere(id)) {
 		return
 	}
 
-	RespondMessage(c, "Password updated successfully")
+	RespondMessage(c, "Signed out everywhere")
 }
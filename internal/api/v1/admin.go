@@ -0,0 +1,199 @@
+package v1
+
+import (
+	"veo/internal/models"
+	"veo/internal/service"
+	"veo/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisteredClient is returned once, when an OAuth client is registered
+type RegisteredClient struct {
+	ClientSecret string                `json:"clientSecret,omitempty"` // Plain secret of confidential clients, it cannot be retrieved again
+	Client       models.OAuthClientDTO `json:"client"`
+}
+
+// AdminAPI provides API endpoints reserved for administrators
+type AdminAPI struct {
+	userService    service.UserService
+	oauthService   service.OAuthService
+	mfaService     service.MFAService
+	lockoutService service.LockoutService
+}
+
+// NewAdminAPI creates a new instance of AdminAPI
+func NewAdminAPI(userService service.UserService, oauthService service.OAuthService, mfaService service.MFAService, lockoutService service.LockoutService) *AdminAPI {
+	return &AdminAPI{userService: userService, oauthService: oauthService, mfaService: mfaService, lockoutService: lockoutService}
+}
+
+// SetupAdminRouter configures the admin routes
+func SetupAdminRouter(router *gin.Engine, api *AdminAPI) {
+	admin := router.Group("/api/admin")
+
+	// Every admin endpoint requires a JWT of a user flagged as admin, API keys are not accepted
+	admin.Use(AuthMiddleware(), RequireScope(models.ScopeAccount), api.RequireAdmin)
+	{
+		admin.POST("/users/:id/signOutEverywhere", api.SignOutEverywhere)
+		admin.POST("/users/:id/mfa/reset", api.ResetMFA)
+		admin.POST("/users/:id/unlock", api.Unlock)
+		admin.POST("/users/:id/mustChangePassword", api.SetMustChangePassword)
+		admin.POST("/oauth/clients", api.RegisterClient)
+		admin.GET("/oauth/clients", api.ListClients)
+		admin.DELETE("/oauth/clients/:clientId", api.DeleteClient)
+	}
+}
+
+// RequireAdmin aborts the request unless the caller is an administrator
+func (api *AdminAPI) RequireAdmin(c *gin.Context) {
+	user, err := api.userService.GetUserByID(c.MustGet("userId").(int))
+	if AbortIfError(c, err) {
+		return
+	}
+
+	if !user.IsAdmin {
+		AbortIfError(c, errors.NewPermissionDenied("Admin access required"))
+		return
+	}
+
+	c.Next()
+}
+
+// SignOutEverywhere revokes every access and refresh token, and every API key, of the given user
+func (api *AdminAPI) SignOutEverywhere(c *gin.Context) {
+	var req struct {
+		ID int `uri:"id" binding:"required"`
+	}
+	if !ParseURI(c, &req) {
+		return
+	}
+
+	if AbortIfError(c, api.userService.SignOutEverywhere(req.ID)) {
+		return
+	}
+
+	logger.Infof("Admin %s signed out user %d everywhere", c.MustGet("username").(string), req.ID)
+	RespondMessage(c, "User signed out everywhere")
+}
+
+// ResetMFA removes the second factor of a user who lost their authenticator app and recovery codes,
+// they sign in with their password alone until they enroll again
+func (api *AdminAPI) ResetMFA(c *gin.Context) {
+	var req struct {
+		ID int `uri:"id" binding:"required"`
+	}
+	if !ParseURI(c, &req) {
+		return
+	}
+
+	if AbortIfError(c, api.mfaService.Reset(req.ID)) {
+		return
+	}
+
+	logger.Warnf("Admin %s reset two-factor authentication of user %d", c.MustGet("username").(string), req.ID)
+	RespondMessage(c, "Two-factor authentication reset")
+}
+
+// Unlock ends the lockout of a user after too many failed sign-ins and forgets the failures.
+// Blocked IPs are not unlocked, their block ends on its own.
+func (api *AdminAPI) Unlock(c *gin.Context) {
+	var req struct {
+		ID int `uri:"id" binding:"required"`
+	}
+	if !ParseURI(c, &req) {
+		return
+	}
+
+	user, err := api.userService.GetUserByID(req.ID)
+	if AbortIfError(c, err) {
+		return
+	}
+	if AbortIfError(c, api.lockoutService.Unlock(user.Username)) {
+		return
+	}
+
+	logger.Securityf("Admin %s unlocked user %d", c.MustGet("username").(string), req.ID)
+	RespondMessage(c, "User unlocked")
+}
+
+// SetMustChangePassword makes a user change its password at its next sign-in, or no longer.
+// Setting it signs the user out everywhere, its next sign-ins only allow changing the password.
+func (api *AdminAPI) SetMustChangePassword(c *gin.Context) {
+	var uri struct {
+		ID int `uri:"id" binding:"required"`
+	}
+	if !ParseURI(c, &uri) {
+		return
+	}
+	var req struct {
+		MustChangePassword bool `json:"mustChangePassword"`
+	}
+	if !ParseRequest(c, &req) {
+		return
+	}
+
+	if AbortIfError(c, api.userService.SetMustChangePassword(uri.ID, req.MustChangePassword)) {
+		return
+	}
+
+	if req.MustChangePassword {
+		logger.Warnf("Admin %s required user %d to change its password", c.MustGet("username").(string), uri.ID)
+		RespondMessage(c, "User must change its password at next sign-in")
+		return
+	}
+	logger.Warnf("Admin %s no longer requires user %d to change its password", c.MustGet("username").(string), uri.ID)
+	RespondMessage(c, "User no longer must change its password")
+}
+
+// RegisterClient registers an OAuth client and returns its secret once
+func (api *AdminAPI) RegisterClient(c *gin.Context) {
+	var req struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirectUris"`
+		Scopes       []string `json:"scopes"`
+		GrantTypes   []string `json:"grantTypes"`
+		Public       bool     `json:"public"` // Clients that cannot keep a secret, such as mobile and single-page apps
+	}
+	if !ParseRequest(c, &req) {
+		return
+	}
+
+	client, secret, err := api.oauthService.RegisterClient(req.Name, req.RedirectURIs, req.Scopes, req.GrantTypes, req.Public)
+	if AbortIfError(c, err) {
+		return
+	}
+
+	logger.Infof("Admin %s registered OAuth client %s", c.MustGet("username").(string), client.ClientID)
+	RespondData(c, &RegisteredClient{ClientSecret: secret, Client: client.Sanitize()})
+}
+
+// ListClients returns every registered OAuth client
+func (api *AdminAPI) ListClients(c *gin.Context) {
+	clients, err := api.oauthService.ListClients()
+	if AbortIfError(c, err) {
+		return
+	}
+
+	dtos := make([]models.OAuthClientDTO, 0, len(clients))
+	for i := range clients {
+		dtos = append(dtos, clients[i].Sanitize())
+	}
+	RespondData(c, dtos)
+}
+
+// DeleteClient removes an OAuth client and revokes every token issued to it
+func (api *AdminAPI) DeleteClient(c *gin.Context) {
+	var req struct {
+		ClientID string `uri:"clientId" binding:"required"`
+	}
+	if !ParseURI(c, &req) {
+		return
+	}
+
+	if AbortIfError(c, api.oauthService.DeleteClient(req.ClientID)) {
+		return
+	}
+
+	logger.Infof("Admin %s deleted OAuth client %s", c.MustGet("username").(string), req.ClientID)
+	RespondMessage(c, "OAuth client deleted")
+}
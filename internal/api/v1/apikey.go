@@ -0,0 +1,90 @@
+package v1
+
+import (
+	"time"
+	"veo/internal/models"
+	"veo/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreatedAPIKey is returned once, when an API key is created
+type CreatedAPIKey struct {
+	Key    string           `json:"key"` // Plain API key, it cannot be retrieved again
+	APIKey models.APIKeyDTO `json:"apiKey"`
+}
+
+// APIKeyAPI lets users manage the API keys of their scripts and CI jobs
+type APIKeyAPI struct {
+	apiKeyService  service.APIKeyService
+	sessionService service.SessionService
+}
+
+// NewAPIKeyAPI creates a new instance of APIKeyAPI
+func NewAPIKeyAPI(apiKeyService service.APIKeyService, sessionService service.SessionService) *APIKeyAPI {
+	return &APIKeyAPI{apiKeyService: apiKeyService, sessionService: sessionService}
+}
+
+// SetupAPIKeyRouter configures API key routes
+func SetupAPIKeyRouter(router *gin.Engine, api *APIKeyAPI) {
+	protected := router.Group("/api/keys")
+
+	// Protected endpoints, an API key cannot be used to create more keys.
+	// Creating one needs a recent sign-in, a stolen access token must not outlive the session through a key.
+	protected.Use(AuthMiddleware(), RequireScope(models.ScopeAccount))
+	{
+		protected.POST("", requireRecentAuth(api.sessionService), api.Create)
+		protected.GET("", api.List)
+		protected.POST("/:id/revoke", api.Revoke)
+	}
+}
+
+// Create generates a new API key for the caller and returns it once
+func (api *APIKeyAPI) Create(c *gin.Context) {
+	var req struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expiresAt"` // Optional, the key never expires when omitted
+	}
+	if !ParseRequest(c, &req) {
+		return
+	}
+
+	id := c.MustGet("userId").(int)
+	key, plain, err := api.apiKeyService.Create(id, req.Name, req.Scopes, req.ExpiresAt)
+	if AbortIfError(c, err) {
+		return
+	}
+
+	RespondData(c, &CreatedAPIKey{Key: plain, APIKey: key.Sanitize()})
+}
+
+// List returns the API keys of the caller with their last use
+func (api *APIKeyAPI) List(c *gin.Context) {
+	keys, err := api.apiKeyService.List(c.MustGet("userId").(int))
+	if AbortIfError(c, err) {
+		return
+	}
+
+	dtos := make([]models.APIKeyDTO, 0, len(keys))
+	for i := range keys {
+		dtos = append(dtos, keys[i].Sanitize())
+	}
+	RespondData(c, dtos)
+}
+
+// Revoke revokes one of the caller's API keys
+func (api *APIKeyAPI) Revoke(c *gin.Context) {
+	var req struct {
+		ID int `uri:"id" binding:"required"`
+	}
+	if !ParseURI(c, &req) {
+		return
+	}
+
+	if AbortIfError(c, api.apiKeyService.Revoke(c.MustGet("userId").(int), req.ID)) {
+		return
+	}
+
+	RespondMessage(c, "API key revoked")
+}
@@ -0,0 +1,86 @@
+package v1
+
+import (
+	"veo/internal/models"
+	"veo/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EmailAPI lets users set and verify their email address
+type EmailAPI struct {
+	emailService   service.EmailService
+	userService    service.UserService
+	sessionService service.SessionService
+}
+
+// NewEmailAPI creates a new instance of EmailAPI
+func NewEmailAPI(emailService service.EmailService, userService service.UserService, sessionService service.SessionService) *EmailAPI {
+	return &EmailAPI{emailService: emailService, userService: userService, sessionService: sessionService}
+}
+
+// SetupEmailRouter configures email-related routes
+func SetupEmailRouter(router *gin.Engine, api *EmailAPI) {
+	protected := router.Group("/api/email")
+
+	// Public endpoints (the link in the mail proves the address)
+	protected.POST("/verify", api.Verify)
+
+	// Protected endpoints (Require JWT authentication)
+	protected.Use(AuthMiddleware(), RequireScope(models.ScopeAccount))
+	{
+		protected.POST("/resend", api.Resend)
+
+		// The address receives sign-in links, changing it requires a recent sign-in or password confirmation
+		protected.POST("/change", requireRecentAuth(api.sessionService), api.Change)
+	}
+}
+
+// Verify verifies the address with the token of a verification link, posted by the page the link opens
+func (api *EmailAPI) Verify(c *gin.Context) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if !ParseRequest(c, &req) {
+		return
+	}
+
+	user, err := api.emailService.Verify(req.Token)
+	if AbortIfError(c, err) {
+		return
+	}
+	RespondData(c, user.Sanitize())
+}
+
+// Change sends a verification link to a new address, the current one stays in use until it is verified
+func (api *EmailAPI) Change(c *gin.Context) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if !ParseRequest(c, &req) {
+		return
+	}
+
+	user, err := api.userService.GetUserByID(c.MustGet("userId").(int))
+	if AbortIfError(c, err) {
+		return
+	}
+
+	if AbortIfError(c, api.emailService.ChangeEmail(user, req.Email)) {
+		return
+	}
+	RespondMessage(c, "A verification link was sent to the new address")
+}
+
+// Resend sends a new verification link for the address waiting to be verified
+func (api *EmailAPI) Resend(c *gin.Context) {
+	user, err := api.userService.GetUserByID(c.MustGet("userId").(int))
+	if AbortIfError(c, err) {
+		return
+	}
+
+	if AbortIfError(c, api.emailService.SendVerification(user)) {
+		return
+	}
+	RespondMessage(c, "A verification link was sent")
+}
@@ -0,0 +1,150 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"veo/internal/api/common"
+	"veo/internal/service"
+	"veo/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// federationCookie keeps the secrets of a sign-in with an identity provider while the user is away
+const federationCookie = "oidc_request"
+
+// FederationAPI signs users in with external OpenID Connect providers
+type FederationAPI struct {
+	federationService service.FederationService
+	mfaService        service.MFAService
+	issuer            *TokenIssuer
+}
+
+// NewFederationAPI creates a new instance of FederationAPI
+func NewFederationAPI(federationService service.FederationService, mfaService service.MFAService, issuer *TokenIssuer) *FederationAPI {
+	return &FederationAPI{federationService: federationService, mfaService: mfaService, issuer: issuer}
+}
+
+// SetupFederationRouter configures the routes of sign-in with identity providers
+func SetupFederationRouter(router *gin.Engine, api *FederationAPI) {
+	public := router.Group("/api/oidc")
+
+	// Public endpoints (the identity provider authenticates the user)
+	public.GET("", api.Providers)
+	public.GET("/:provider/login", api.Login)
+	public.GET("/:provider/callback", api.Callback)
+}
+
+// Providers lists the names of the identity providers users can sign in with
+func (api *FederationAPI) Providers(c *gin.Context) {
+	RespondData(c, api.federationService.Providers())
+}
+
+// Login sends the user to the identity provider, remembering the sign-in in a cookie
+func (api *FederationAPI) Login(c *gin.Context) {
+	var req struct {
+		Provider string `uri:"provider" binding:"required"`
+	}
+	if !ParseURI(c, &req) {
+		return
+	}
+
+	request, authorizationURL, err := api.federationService.Begin(c.Request.Context(), req.Provider, 0)
+	if AbortIfError(c, err) {
+		return
+	}
+
+	setFederationCookie(c, req.Provider, request)
+	c.Redirect(http.StatusFound, authorizationURL)
+}
+
+// Callback completes the sign-in when the identity provider sends the user back,
+// then signs the user in like Login of AccountAPI does: users with a second factor get a challenge
+// completed at LoginMFA. Sign-ins started to link the identity link it to the signed in user instead.
+func (api *FederationAPI) Callback(c *gin.Context) {
+	var uri struct {
+		Provider string `uri:"provider" binding:"required"`
+	}
+	if !ParseURI(c, &uri) {
+		return
+	}
+	var req struct {
+		State            string `form:"state"`
+		Code             string `form:"code"`
+		Error            string `form:"error"`
+		ErrorDescription string `form:"error_description"`
+	}
+	if !ParseQuery(c, &req) {
+		return
+	}
+
+	// The sign-in can only be completed once
+	request := federationRequestFromCookie(c)
+	common.SetStateCookie(c, federationCookie, "", federationCookiePath(uri.Provider), -1)
+
+	if req.Error != "" {
+		AbortIfError(c, errors.NewAuthFailed("Identity provider refused the sign-in: "+req.Error))
+		return
+	}
+
+	if request != nil && request.LinkSession != 0 {
+		api.link(c, uri.Provider, request, req.State, req.Code)
+		return
+	}
+
+	user, err := api.federationService.Complete(c.Request.Context(), uri.Provider, request, req.State, req.Code)
+	if AbortIfError(c, err) {
+		return
+	}
+
+	signInOrChallenge(c, api.mfaService, api.issuer, user, "")
+}
+
+// link links the identity to the user of the session that started linking. The redirect back from the
+// provider carries no access token, so the session is taken from the signed cookie and must still be
+// live and recently authenticated.
+func (api *FederationAPI) link(c *gin.Context, provider string, request *service.FederationRequest, state, code string) {
+	if AbortIfError(c, api.federationService.CheckLink(request)) {
+		return
+	}
+	session, err := api.issuer.sessionService.RecentSession(request.LinkSession)
+	if AbortIfError(c, err) {
+		return
+	}
+
+	identity, err := api.federationService.Link(c.Request.Context(), provider, request, state, code, session.UserID)
+	if AbortIfError(c, err) {
+		return
+	}
+
+	RespondData(c, identity.Sanitize())
+}
+
+// setFederationCookie keeps the sign-in request in the browser until the identity provider sends the user back
+func setFederationCookie(c *gin.Context, provider string, request *service.FederationRequest) {
+	value := strings.Join([]string{request.State, request.Nonce, request.CodeVerifier, strconv.Itoa(request.LinkSession), request.LinkProof}, ".")
+	common.SetStateCookie(c, federationCookie, value, federationCookiePath(provider), service.FederationRequestTTL)
+}
+
+// federationRequestFromCookie returns the sign-in request kept by setFederationCookie, nil if there is none
+func federationRequestFromCookie(c *gin.Context) *service.FederationRequest {
+	value, err := c.Cookie(federationCookie)
+	if err != nil {
+		return nil
+	}
+	parts := strings.Split(value, ".")
+	if len(parts) != 5 {
+		return nil
+	}
+	linkSession, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return nil
+	}
+	return &service.FederationRequest{State: parts[0], Nonce: parts[1], CodeVerifier: parts[2], LinkSession: linkSession, LinkProof: parts[4]}
+}
+
+// federationCookiePath limits the sign-in cookie to the routes of its provider
+func federationCookiePath(provider string) string {
+	return "/api/oidc/" + provider
+}
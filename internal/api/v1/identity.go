@@ -0,0 +1,151 @@
+package v1
+
+import (
+	"veo/internal/api/common"
+	"veo/internal/models"
+	"veo/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProviderLink is returned when linking an identity provider starts
+type ProviderLink struct {
+	AuthorizationURL string `json:"authorizationUrl"` // Where to send the user to sign in at the provider
+}
+
+// IdentityAPI lets users manage the ways they sign in to their account
+type IdentityAPI struct {
+	identityService   service.IdentityService
+	federationService service.FederationService
+	userService       service.UserService
+	sessionService    service.SessionService
+	lockoutService    service.LockoutService
+}
+
+// NewIdentityAPI creates a new instance of IdentityAPI
+func NewIdentityAPI(identityService service.IdentityService, federationService service.FederationService, userService service.UserService, sessionService service.SessionService, lockoutService service.LockoutService) *IdentityAPI {
+	return &IdentityAPI{identityService: identityService, federationService: federationService, userService: userService, sessionService: sessionService, lockoutService: lockoutService}
+}
+
+// SetupIdentityRouter configures identity-related routes
+func SetupIdentityRouter(router *gin.Engine, api *IdentityAPI) {
+	protected := router.Group("/api")
+
+	// Protected endpoints (Require JWT authentication)
+	protected.Use(AuthMiddleware(), RequireScope(models.ScopeAccount))
+	{
+		protected.POST("/reauthenticate", api.Reauthenticate)
+		protected.GET("/identities", api.List)
+
+		// Changing the ways to sign in requires a recent sign-in or password confirmation
+		recentAuth := requireRecentAuth(api.sessionService)
+		protected.POST("/identities/password", recentAuth, api.SetPassword)
+		protected.POST("/identities/oidc/:provider", recentAuth, api.LinkProvider)
+		protected.POST("/identities/:id/unlink", recentAuth, api.Unlink)
+	}
+}
+
+// Reauthenticate confirms the password of the caller, allowing sensitive changes for a while
+func (api *IdentityAPI) Reauthenticate(c *gin.Context) {
+	var req struct {
+		Password string `json:"password"`
+	}
+	if !ParseRequest(c, &req) {
+		return
+	}
+
+	claims := c.MustGet("claims").(*common.UserClaims)
+	user, err := api.userService.GetUserByID(claims.ID)
+	if AbortIfError(c, err) {
+		return
+	}
+	err = api.lockoutService.Attempt(user.Username, c.ClientIP(), func() error {
+		if user.Password == "" || !user.CheckPassword(req.Password) {
+			return NewAuthFailed("Invalid password")
+		}
+		return nil
+	})
+	if AbortIfError(c, err) {
+		return
+	}
+
+	if AbortIfError(c, api.sessionService.Reauthenticate(claims.SessionID)) {
+		return
+	}
+	RespondMessage(c, "Password confirmed")
+}
+
+// List returns the ways the caller signs in
+func (api *IdentityAPI) List(c *gin.Context) {
+	identities, err := api.identityService.List(c.MustGet("userId").(int))
+	if AbortIfError(c, err) {
+		return
+	}
+
+	dtos := make([]models.IdentityDTO, 0, len(identities))
+	for i := range identities {
+		dtos = append(dtos, identities[i].Sanitize())
+	}
+	RespondData(c, dtos)
+}
+
+// SetPassword lets a caller who signs in with an identity provider only also sign in with a password
+func (api *IdentityAPI) SetPassword(c *gin.Context) {
+	var req struct {
+		Password string `json:"password"`
+	}
+	if !ParseRequest(c, &req) {
+		return
+	}
+
+	if AbortIfError(c, api.identityService.SetPassword(c.MustGet("userId").(int), req.Password)) {
+		return
+	}
+	RespondMessage(c, "Password set")
+}
+
+// LinkProvider starts linking an identity provider account to the caller. The client sends the user
+// to the returned URL, the provider then sends them back to the callback of FederationAPI.
+func (api *IdentityAPI) LinkProvider(c *gin.Context) {
+	var req struct {
+		Provider string `uri:"provider" binding:"required"`
+	}
+	if !ParseURI(c, &req) {
+		return
+	}
+
+	claims := c.MustGet("claims").(*common.UserClaims)
+	request, authorizationURL, err := api.federationService.Begin(c.Request.Context(), req.Provider, claims.SessionID)
+	if AbortIfError(c, err) {
+		return
+	}
+
+	setFederationCookie(c, req.Provider, request)
+	RespondData(c, &ProviderLink{AuthorizationURL: authorizationURL})
+}
+
+// Unlink removes one of the ways the caller signs in, the last one cannot be removed
+func (api *IdentityAPI) Unlink(c *gin.Context) {
+	var req struct {
+		ID int `uri:"id" binding:"required"`
+	}
+	if !ParseURI(c, &req) {
+		return
+	}
+
+	if AbortIfError(c, api.identityService.Unlink(c.MustGet("userId").(int), req.ID)) {
+		return
+	}
+	RespondMessage(c, "Identity unlinked")
+}
+
+// requireRecentAuth rejects requests unless the caller signed in or confirmed their password recently
+func requireRecentAuth(sessionService service.SessionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := c.MustGet("claims").(*common.UserClaims)
+		if AbortIfError(c, sessionService.RequireRecentAuth(claims.SessionID)) {
+			return
+		}
+		c.Next()
+	}
+}
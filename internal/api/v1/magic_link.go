@@ -0,0 +1,62 @@
+package v1
+
+import (
+	"veo/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MagicLinkAPI lets users sign in with links sent to their email address
+type MagicLinkAPI struct {
+	magicLinkService service.MagicLinkService
+	mfaService       service.MFAService
+	issuer           *TokenIssuer
+}
+
+// NewMagicLinkAPI creates a new instance of MagicLinkAPI
+func NewMagicLinkAPI(magicLinkService service.MagicLinkService, mfaService service.MFAService, issuer *TokenIssuer) *MagicLinkAPI {
+	return &MagicLinkAPI{magicLinkService: magicLinkService, mfaService: mfaService, issuer: issuer}
+}
+
+// SetupMagicLinkRouter configures magic link routes
+func SetupMagicLinkRouter(router *gin.Engine, api *MagicLinkAPI) {
+	public := router.Group("/api/login/magic")
+
+	// Public endpoints (the link in the mail proves the address)
+	public.POST("", api.Request)
+	public.POST("/verify", api.Verify)
+}
+
+// Request mails a sign-in link. The response is the same whether or not the address has an account.
+func (api *MagicLinkAPI) Request(c *gin.Context) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if !ParseRequest(c, &req) {
+		return
+	}
+
+	if AbortIfError(c, api.magicLinkService.Request(req.Email, c.ClientIP())) {
+		return
+	}
+	RespondMessage(c, "If the address belongs to an account, a sign-in link is on its way")
+}
+
+// Verify signs in with the token of a link, posted by the page the link opens.
+// Users with a second factor get an MFA challenge like Login of AccountAPI.
+func (api *MagicLinkAPI) Verify(c *gin.Context) {
+	var req struct {
+		Token  string `json:"token"`
+		Device string `json:"device"` // Optional label of the device signing in
+	}
+	if !ParseRequest(c, &req) {
+		return
+	}
+
+	user, err := api.magicLinkService.Verify(req.Token)
+	if AbortIfError(c, err) {
+		return
+	}
+
+	signInOrChallenge(c, api.mfaService, api.issuer, user, req.Device)
+}
@@ -0,0 +1,130 @@
+package v1
+
+import (
+	"net/http"
+	"veo/internal/models"
+	"veo/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RecoveryCodes is returned when recovery codes are generated, they cannot be retrieved again
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"` // One-time codes replacing the authenticator app
+}
+
+// MFAAPI lets users protect their account with an authenticator app
+type MFAAPI struct {
+	mfaService     service.MFAService
+	userService    service.UserService
+	sessionService service.SessionService
+}
+
+// NewMFAAPI creates a new instance of MFAAPI
+func NewMFAAPI(mfaService service.MFAService, userService service.UserService, sessionService service.SessionService) *MFAAPI {
+	return &MFAAPI{mfaService: mfaService, userService: userService, sessionService: sessionService}
+}
+
+// SetupMFARouter configures the two-factor authentication routes
+func SetupMFARouter(router *gin.Engine, api *MFAAPI) {
+	protected := router.Group("/api/mfa")
+
+	// Protected endpoints (Require JWT authentication)
+	protected.Use(AuthMiddleware(), RequireScope(models.ScopeAccount))
+	{
+		protected.GET("", api.Status)
+		protected.GET("/totp/qrcode", api.QRCode)
+		protected.POST("/totp/confirm", api.Confirm)
+
+		// Changing the second factor requires a recent sign-in or password confirmation
+		recentAuth := requireRecentAuth(api.sessionService)
+		protected.POST("/totp", recentAuth, api.Enroll)
+		protected.POST("/recoveryCodes", recentAuth, api.RegenerateRecoveryCodes)
+		protected.POST("/disable", recentAuth, api.Disable)
+	}
+}
+
+// Status tells the caller whether their account is protected by a second factor
+func (api *MFAAPI) Status(c *gin.Context) {
+	status, err := api.mfaService.Status(c.MustGet("userId").(int))
+	if AbortIfError(c, err) {
+		return
+	}
+	RespondData(c, status)
+}
+
+// Enroll starts adding an authenticator app, returning its secret and otpauth URI.
+// The app is used for signing in once Confirm receives a first code.
+func (api *MFAAPI) Enroll(c *gin.Context) {
+	user, err := api.userService.GetUserByID(c.MustGet("userId").(int))
+	if AbortIfError(c, err) {
+		return
+	}
+
+	enrollment, err := api.mfaService.Enroll(user)
+	if AbortIfError(c, err) {
+		return
+	}
+	RespondData(c, enrollment)
+}
+
+// QRCode returns the QR code of the enrollment waiting for confirmation as a PNG image
+func (api *MFAAPI) QRCode(c *gin.Context) {
+	user, err := api.userService.GetUserByID(c.MustGet("userId").(int))
+	if AbortIfError(c, err) {
+		return
+	}
+
+	enrollment, err := api.mfaService.Enrollment(user)
+	if AbortIfError(c, err) {
+		return
+	}
+	png, err := enrollment.QRCode()
+	if AbortIfError(c, err) {
+		return
+	}
+
+	// The image carries the secret
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "image/png", png)
+}
+
+// Confirm enables the second factor with a first code of the authenticator app and returns the recovery codes
+func (api *MFAAPI) Confirm(c *gin.Context) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if !ParseRequest(c, &req) {
+		return
+	}
+
+	codes, err := api.mfaService.Confirm(c.MustGet("userId").(int), req.Code)
+	if AbortIfError(c, err) {
+		return
+	}
+	RespondData(c, &RecoveryCodes{RecoveryCodes: codes})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the caller
+func (api *MFAAPI) RegenerateRecoveryCodes(c *gin.Context) {
+	codes, err := api.mfaService.RegenerateRecoveryCodes(c.MustGet("userId").(int))
+	if AbortIfError(c, err) {
+		return
+	}
+	RespondData(c, &RecoveryCodes{RecoveryCodes: codes})
+}
+
+// Disable removes the second factor of the caller, who enters a current code or a recovery code
+func (api *MFAAPI) Disable(c *gin.Context) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if !ParseRequest(c, &req) {
+		return
+	}
+
+	if AbortIfError(c, api.mfaService.Disable(c.MustGet("userId").(int), req.Code)) {
+		return
+	}
+	RespondMessage(c, "Two-factor authentication disabled")
+}
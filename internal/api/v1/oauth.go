@@ -0,0 +1,671 @@
+package v1
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"veo/internal/api/common"
+	"veo/internal/models"
+	"veo/internal/service"
+	"veo/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// consentPage asks the user to sign in and approve an authorization request
+var consentPage = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in to {{.Client}}</title></head>
+<body>
+{{if .Error}}<p>{{.Error}}</p>{{end}}
+{{if .Client}}
+<h1>{{.Client}} wants to access your account</h1>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+<form method="post" action="/oauth/authorize">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}{{if .MFAToken}}<input type="hidden" name="mfa_token" value="{{.MFAToken}}">
+<label>Authentication code <input name="code" autocomplete="one-time-code" inputmode="numeric"></label>
+{{else}}<label>Username <input name="username" autocomplete="username"></label>
+<label>Password <input name="password" type="password" autocomplete="current-password"></label>
+{{end}}<button name="decision" value="approve">Allow</button>
+<button name="decision" value="deny">Deny</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// authorizeRequest holds the parameters of an authorization request (RFC 6749 section 4.1.1, RFC 7636)
+type authorizeRequest struct {
+	ResponseType        string `form:"response_type"`
+	ClientID            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+}
+
+// params returns the request parameters carried through the consent form
+func (r *authorizeRequest) params() map[string]string {
+	return map[string]string{
+		"response_type":         r.ResponseType,
+		"client_id":             r.ClientID,
+		"redirect_uri":          r.RedirectURI,
+		"scope":                 r.Scope,
+		"state":                 r.State,
+		"code_challenge":        r.CodeChallenge,
+		"code_challenge_method": r.CodeChallengeMethod,
+	}
+}
+
+// OAuthTokenResponse is the successful response of the token endpoint (RFC 6749 section 5.1)
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// IntrospectionResponse describes a token to a resource server (RFC 7662 section 2.2).
+// Inactive tokens are only described as such.
+type IntrospectionResponse struct {
+	Active    bool            `json:"active"`
+	Scope     string          `json:"scope,omitempty"`
+	ClientID  string          `json:"client_id,omitempty"`
+	Username  string          `json:"username,omitempty"`
+	TokenType string          `json:"token_type,omitempty"`
+	ExpiresAt int64           `json:"exp,omitempty"`
+	IssuedAt  int64           `json:"iat,omitempty"`
+	NotBefore int64           `json:"nbf,omitempty"`
+	Subject   string          `json:"sub,omitempty"`
+	Audience  common.Audience `json:"aud,omitempty"`
+	Issuer    string          `json:"iss,omitempty"`
+	ID        string          `json:"jti,omitempty"`
+}
+
+// Token types reported by the introspection endpoint
+const (
+	tokenTypeBearer  = "Bearer"
+	tokenTypeRefresh = "refresh_token"
+)
+
+// OAuthAPI implements the OAuth 2.0 authorization server used by our first-party apps
+type OAuthAPI struct {
+	userService    service.UserService
+	oauthService   service.OAuthService
+	apiKeyService  service.APIKeyService
+	mfaService     service.MFAService
+	emailService   service.EmailService
+	lockoutService service.LockoutService
+	issuer         *TokenIssuer
+}
+
+// NewOAuthAPI creates a new instance of OAuthAPI
+func NewOAuthAPI(userService service.UserService, oauthService service.OAuthService, apiKeyService service.APIKeyService, mfaService service.MFAService, emailService service.EmailService, lockoutService service.LockoutService, issuer *TokenIssuer) *OAuthAPI {
+	return &OAuthAPI{userService: userService, oauthService: oauthService, apiKeyService: apiKeyService, mfaService: mfaService, emailService: emailService, lockoutService: lockoutService, issuer: issuer}
+}
+
+// SetupOAuthRouter configures the OAuth 2.0 endpoints.
+// They follow the OAuth specifications rather than our response format, so standard client libraries work.
+func SetupOAuthRouter(router *gin.Engine, api *OAuthAPI) {
+	oauth := router.Group("/oauth")
+
+	// Public endpoints (the user signs in on the consent page, clients authenticate at the token endpoint)
+	oauth.GET("/authorize", api.Authorize)
+	oauth.POST("/authorize", api.Approve)
+	oauth.POST("/token", api.Token)
+	oauth.POST("/introspect", api.Introspect)
+	oauth.POST("/revoke", api.Revoke)
+}
+
+// Authorize validates an authorization request and shows the sign-in and consent page
+func (api *OAuthAPI) Authorize(c *gin.Context) {
+	var req authorizeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		api.renderConsent(c, http.StatusBadRequest, nil, nil, "", "", "Invalid authorization request")
+		return
+	}
+
+	client, scope, ok := api.validateAuthorization(c, &req)
+	if !ok {
+		return
+	}
+
+	api.renderConsent(c, http.StatusOK, &req, client, scope, "", "")
+}
+
+// Approve signs the user in with UserService.Login and, when they allow the request,
+// redirects back to the client with an authorization code. Users with a second factor
+// are asked for a code next, like Login of AccountAPI does.
+func (api *OAuthAPI) Approve(c *gin.Context) {
+	var req struct {
+		authorizeRequest
+		Username string `form:"username"`
+		Password string `form:"password"`
+		MFAToken string `form:"mfa_token"`
+		Code     string `form:"code"`
+		Decision string `form:"decision"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		api.renderConsent(c, http.StatusBadRequest, nil, nil, "", "", "Invalid authorization request")
+		return
+	}
+
+	client, scope, ok := api.validateAuthorization(c, &req.authorizeRequest)
+	if !ok {
+		return
+	}
+
+	if req.Decision != "approve" {
+		redirectWithError(c, req.RedirectURI, req.State, service.NewOAuthError(service.OAuthAccessDenied, "The user denied the request"))
+		return
+	}
+
+	user, ok := api.signIn(c, &req.authorizeRequest, client, scope, req.Username, req.Password, req.MFAToken, req.Code)
+	if !ok {
+		return
+	}
+
+	code, err := api.oauthService.IssueCode(client, user.ID, req.RedirectURI, scope, req.CodeChallenge)
+	if err != nil {
+		redirectWithError(c, req.RedirectURI, req.State, err)
+		return
+	}
+
+	redirectWithParams(c, req.RedirectURI, map[string]string{"code": code, "state": req.State})
+}
+
+// signIn checks the credentials entered on the consent page: the password first, then the code
+// of the second factor when the user has one. It returns false when the page was shown again.
+func (api *OAuthAPI) signIn(c *gin.Context, req *authorizeRequest, client *models.OAuthClient, scope, username, password, mfaToken, code string) (*models.User, bool) {
+	if mfaToken != "" {
+		user, err := completeChallenge(c, api.mfaService, api.lockoutService, mfaToken, code)
+		if e, ok := err.(*errors.Error); ok && e.Code == errors.CodeTokenExpired {
+			api.renderConsent(c, http.StatusUnauthorized, req, client, scope, "", e.Message)
+			return nil, false
+		}
+		if e, ok := err.(*errors.Error); ok && (e.Code == errors.CodeTooManyRequests || e.Code == errors.CodeAccountLocked) {
+			api.renderConsent(c, http.StatusTooManyRequests, req, client, scope, "", e.Message)
+			return nil, false
+		}
+		if err != nil {
+			api.renderConsent(c, http.StatusUnauthorized, req, client, scope, mfaToken, err.Error())
+			return nil, false
+		}
+		return user, true
+	}
+
+	var user *models.User
+	err := api.lockoutService.AttemptFirstFactor(username, c.ClientIP(), func() (err error) {
+		user, err = api.userService.Login(username, password)
+		return err
+	})
+	if e, ok := err.(*errors.Error); ok && (e.Code == errors.CodeTooManyRequests || e.Code == errors.CodeAccountLocked) {
+		api.renderConsent(c, http.StatusTooManyRequests, req, client, scope, "", e.Message)
+		return nil, false
+	}
+	if err != nil {
+		api.renderConsent(c, http.StatusUnauthorized, req, client, scope, "", "Invalid username or password")
+		return nil, false
+	}
+	if err := api.emailService.CheckVerified(user); err != nil {
+		api.renderConsent(c, http.StatusForbidden, req, client, scope, "", err.Error())
+		return nil, false
+	}
+	if service.PasswordChangeRequired(user) {
+		api.renderConsent(c, http.StatusForbidden, req, client, scope, "", "Your password must be changed, sign in to the account to change it")
+		return nil, false
+	}
+
+	enabled, err := api.mfaService.Enabled(user.ID)
+	if err != nil {
+		api.renderConsent(c, http.StatusInternalServerError, req, client, scope, "", "Sign-in failed, please try again")
+		return nil, false
+	}
+	if !enabled {
+		if err := api.lockoutService.Succeed(user.Username); err != nil {
+			logger.Errorf("failed to forget the failed sign-ins of user %d: %v", user.ID, err)
+		}
+		return user, true
+	}
+
+	mfaToken, err = api.mfaService.StartChallenge(user.ID)
+	if err != nil {
+		api.renderConsent(c, http.StatusInternalServerError, req, client, scope, "", "Sign-in failed, please try again")
+		return nil, false
+	}
+	api.renderConsent(c, http.StatusOK, req, client, scope, mfaToken, "")
+	return nil, false
+}
+
+// Token exchanges a grant for an access token (RFC 6749 section 3.2)
+func (api *OAuthAPI) Token(c *gin.Context) {
+	var req struct {
+		GrantType    string `form:"grant_type"`
+		Code         string `form:"code"`
+		RedirectURI  string `form:"redirect_uri"`
+		CodeVerifier string `form:"code_verifier"`
+		RefreshToken string `form:"refresh_token"`
+		Scope        string `form:"scope"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		respondOAuthError(c, service.NewOAuthError(service.OAuthInvalidRequest, "Invalid token request"))
+		return
+	}
+	switch req.GrantType {
+	case models.GrantAuthorizationCode, models.GrantClientCredentials, models.GrantRefreshToken:
+	default:
+		respondOAuthError(c, service.NewOAuthError(service.OAuthUnsupportedGrantType, "Unsupported grant type"))
+		return
+	}
+
+	client, ok := api.authenticateClient(c)
+	if !ok {
+		return
+	}
+	if !client.HasGrantType(req.GrantType) {
+		respondOAuthError(c, service.NewOAuthError(service.OAuthUnauthorizedClient, "Client may not use this grant type"))
+		return
+	}
+
+	switch req.GrantType {
+	case models.GrantAuthorizationCode:
+		api.exchangeCode(c, client, req.Code, req.RedirectURI, req.CodeVerifier)
+	case models.GrantClientCredentials:
+		api.clientCredentials(c, client, req.Scope)
+	case models.GrantRefreshToken:
+		api.refresh(c, client, req.RefreshToken)
+	}
+}
+
+// Introspect tells a resource server whether a token is active and what it grants (RFC 7662).
+// Access tokens, API keys and refresh tokens are described; refresh tokens only to the client they were issued to.
+func (api *OAuthAPI) Introspect(c *gin.Context) {
+	var req struct {
+		Token         string `form:"token"`
+		TokenTypeHint string `form:"token_type_hint"`
+	}
+	if err := c.ShouldBind(&req); err != nil || req.Token == "" {
+		respondOAuthError(c, service.NewOAuthError(service.OAuthInvalidRequest, "Missing token"))
+		return
+	}
+
+	// Only confidential clients, such as resource servers, may learn about tokens
+	client, ok := api.authenticateClient(c)
+	if !ok {
+		return
+	}
+	if client.Public {
+		respondOAuthError(c, service.NewOAuthError(service.OAuthInvalidClient, "Public clients cannot introspect tokens"))
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	for _, introspect := range hintedLookups(req.TokenTypeHint, api.introspectAccessToken, api.introspectRefreshToken) {
+		if introspect(c, client, req.Token) {
+			return
+		}
+	}
+	c.JSON(http.StatusOK, &IntrospectionResponse{Active: false})
+}
+
+// introspectAccessToken describes an access token or API key, it returns false without responding for other tokens
+func (api *OAuthAPI) introspectAccessToken(c *gin.Context, client *models.OAuthClient, token string) bool {
+	claims, err := common.IntrospectToken(token)
+	if err != nil {
+		return false
+	}
+	c.JSON(http.StatusOK, introspectClaims(claims))
+	return true
+}
+
+// introspectRefreshToken describes a refresh token to the client it was issued to,
+// it returns false without responding if the token is no active refresh token
+func (api *OAuthAPI) introspectRefreshToken(c *gin.Context, client *models.OAuthClient, token string) bool {
+	refreshToken, session, err := api.issuer.tokenService.IntrospectRefreshToken(token)
+	if err != nil {
+		respondOAuthError(c, err)
+		return true
+	}
+	if refreshToken == nil {
+		return false
+	}
+	if session.ClientID != client.ClientID {
+		c.JSON(http.StatusOK, &IntrospectionResponse{Active: false})
+		return true
+	}
+
+	c.JSON(http.StatusOK, &IntrospectionResponse{
+		Active:    true,
+		Scope:     session.Scope,
+		ClientID:  session.ClientID,
+		Username:  session.User.Username,
+		TokenType: tokenTypeRefresh,
+		ExpiresAt: refreshToken.ExpiresAt.Unix(),
+		IssuedAt:  refreshToken.CreatedAt.Unix(),
+		Subject:   strconv.Itoa(refreshToken.UserID),
+	})
+	return true
+}
+
+// Revoke revokes a token (RFC 7009). Clients may revoke the access and refresh tokens issued to them,
+// which ends the whole grant. API keys can be revoked by any client, so leaked keys are easy to report.
+// Unknown and inactive tokens are ignored, the response is the same either way.
+func (api *OAuthAPI) Revoke(c *gin.Context) {
+	var req struct {
+		Token         string `form:"token"`
+		TokenTypeHint string `form:"token_type_hint"`
+	}
+	if err := c.ShouldBind(&req); err != nil || req.Token == "" {
+		respondOAuthError(c, service.NewOAuthError(service.OAuthInvalidRequest, "Missing token"))
+		return
+	}
+
+	client, ok := api.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	if strings.HasPrefix(req.Token, models.APIKeyPrefix) {
+		if err := api.apiKeyService.RevokeKey(req.Token); err != nil {
+			respondOAuthError(c, err)
+			return
+		}
+		c.Status(http.StatusOK)
+		return
+	}
+
+	for _, revoke := range hintedLookups(req.TokenTypeHint, api.revokeAccessToken, api.revokeRefreshToken) {
+		if revoke(c, client, req.Token) {
+			return
+		}
+	}
+	c.Status(http.StatusOK)
+}
+
+// revokeAccessToken revokes an access token issued to the client, it returns false without responding for other tokens
+func (api *OAuthAPI) revokeAccessToken(c *gin.Context, client *models.OAuthClient, token string) bool {
+	claims, err := common.IntrospectToken(token)
+	if err != nil {
+		return false
+	}
+	if claims.ClientID != client.ClientID {
+		respondOAuthError(c, service.NewOAuthError(service.OAuthUnauthorizedClient, "Token was not issued to the client"))
+		return true
+	}
+	if err := common.RevokeAccessToken(claims); err != nil {
+		respondOAuthError(c, err)
+		return true
+	}
+	c.Status(http.StatusOK)
+	return true
+}
+
+// revokeRefreshToken ends the grant of a refresh token issued to the client,
+// it returns false without responding if the token is no active refresh token
+func (api *OAuthAPI) revokeRefreshToken(c *gin.Context, client *models.OAuthClient, token string) bool {
+	_, session, err := api.issuer.tokenService.IntrospectRefreshToken(token)
+	if err != nil {
+		respondOAuthError(c, err)
+		return true
+	}
+	if session == nil {
+		return false
+	}
+	if session.ClientID != client.ClientID {
+		respondOAuthError(c, service.NewOAuthError(service.OAuthUnauthorizedClient, "Token was not issued to the client"))
+		return true
+	}
+	if err := api.issuer.sessionService.Revoke(session.UserID, session.ID); err != nil {
+		respondOAuthError(c, err)
+		return true
+	}
+	c.Status(http.StatusOK)
+	return true
+}
+
+// tokenLookup handles a token of one type for a client, it returns false without responding if the token is of another type
+type tokenLookup func(c *gin.Context, client *models.OAuthClient, token string) bool
+
+// hintedLookups orders the lookups of access and refresh tokens by the token_type_hint of the client.
+// The hint only saves a lookup: a wrong hint still finds the token (RFC 7662 and RFC 7009, section 2.1).
+func hintedLookups(hint string, accessToken, refreshToken tokenLookup) []tokenLookup {
+	if hint == tokenTypeRefresh {
+		return []tokenLookup{refreshToken, accessToken}
+	}
+	return []tokenLookup{accessToken, refreshToken}
+}
+
+// exchangeCode redeems an authorization code, starting a session of the client for the user
+func (api *OAuthAPI) exchangeCode(c *gin.Context, client *models.OAuthClient, code, redirectURI, codeVerifier string) {
+	grant, err := api.oauthService.ExchangeCode(client, code, redirectURI, codeVerifier)
+	if err != nil {
+		respondOAuthError(c, err)
+		return
+	}
+
+	user, err := api.userService.GetUserByID(grant.UserID)
+	if err != nil {
+		respondOAuthError(c, service.NewOAuthError(service.OAuthInvalidGrant, "Invalid authorization code"))
+		return
+	}
+
+	session, err := api.issuer.sessionService.StartGrant(user, client, grant.Scope, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		respondOAuthError(c, err)
+		return
+	}
+
+	api.respondToken(c, user, session, client.HasGrantType(models.GrantRefreshToken))
+}
+
+// clientCredentials issues a token for the client itself, without a user or refresh token
+func (api *OAuthAPI) clientCredentials(c *gin.Context, client *models.OAuthClient, scope string) {
+	scope, err := api.oauthService.ResolveScope(client, scope)
+	if err != nil {
+		respondOAuthError(c, err)
+		return
+	}
+
+	session, err := api.issuer.sessionService.StartClient(client, scope, common.AccessTokenTTL())
+	if err != nil {
+		respondOAuthError(c, err)
+		return
+	}
+
+	api.respondToken(c, &models.User{}, session, false)
+}
+
+// refresh rotates a refresh token of the client. The new tokens keep the scope of the original grant.
+func (api *OAuthAPI) refresh(c *gin.Context, client *models.OAuthClient, refreshToken string) {
+	session, newRefreshToken, err := api.issuer.tokenService.RotateRefreshToken(refreshToken, client.ClientID)
+	if err != nil {
+		respondOAuthError(c, err)
+		return
+	}
+
+	if err := api.issuer.sessionService.Extend(session); err != nil {
+		respondOAuthError(c, err)
+		return
+	}
+
+	accessToken, err := IssueAccessToken(&session.User, session)
+	if err != nil {
+		respondOAuthError(c, err)
+		return
+	}
+
+	respondOAuthToken(c, accessToken, newRefreshToken, session.Scope)
+}
+
+// respondToken issues the access token of a new session and, when asked, a refresh token
+func (api *OAuthAPI) respondToken(c *gin.Context, user *models.User, session *models.Session, withRefreshToken bool) {
+	accessToken, err := IssueAccessToken(user, session)
+	if err != nil {
+		respondOAuthError(c, err)
+		return
+	}
+
+	var refreshToken string
+	if withRefreshToken {
+		if refreshToken, err = api.issuer.tokenService.IssueRefreshToken(user, session.ID); err != nil {
+			respondOAuthError(c, err)
+			return
+		}
+	}
+
+	respondOAuthToken(c, accessToken, refreshToken, session.Scope)
+}
+
+// authenticateClient checks the credentials of the client calling the token, introspection or revocation
+// endpoint, sent with HTTP Basic authentication or in the form. It returns false when a response was written.
+func (api *OAuthAPI) authenticateClient(c *gin.Context) (*models.OAuthClient, bool) {
+	clientID, secret := c.PostForm("client_id"), c.PostForm("client_secret")
+	if id, password, ok := c.Request.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(password)
+	}
+
+	client, err := api.oauthService.AuthenticateClient(clientID, secret)
+	if err != nil {
+		respondOAuthError(c, err)
+		return nil, false
+	}
+	return client, true
+}
+
+// introspectClaims describes an active access token or API key
+func introspectClaims(claims *common.UserClaims) *IntrospectionResponse {
+	return &IntrospectionResponse{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		Username:  claims.Username,
+		TokenType: tokenTypeBearer,
+		ExpiresAt: claims.ExpiresAt,
+		IssuedAt:  claims.IssuedAt,
+		NotBefore: claims.NotBefore,
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		ID:        claims.Id,
+	}
+}
+
+// validateAuthorization checks an authorization request and returns its client and granted scope.
+// Requests from unknown clients or with an unregistered redirect URI are answered with an error page,
+// other errors are sent back to the client. It returns false when a response was written.
+func (api *OAuthAPI) validateAuthorization(c *gin.Context, req *authorizeRequest) (*models.OAuthClient, string, bool) {
+	client, redirectURI, err := api.oauthService.ResolveClient(req.ClientID, req.RedirectURI)
+	if err != nil {
+		api.renderConsent(c, http.StatusBadRequest, nil, nil, "", "", err.Error())
+		return nil, "", false
+	}
+	req.RedirectURI = redirectURI
+
+	scope, err := api.oauthService.ValidateAuthorization(client, req.ResponseType, req.Scope, req.CodeChallenge, req.CodeChallengeMethod)
+	if err != nil {
+		redirectWithError(c, redirectURI, req.State, err)
+		return nil, "", false
+	}
+	return client, scope, true
+}
+
+// renderConsent writes the consent page with an optional error message.
+// Without a client only the message is shown, with an MFA token the code of the second factor is asked instead of the password.
+func (api *OAuthAPI) renderConsent(c *gin.Context, status int, req *authorizeRequest, client *models.OAuthClient, scope, mfaToken, message string) {
+	data := struct {
+		Client   string
+		Scopes   []string
+		Params   map[string]string
+		MFAToken string
+		Error    string
+	}{MFAToken: mfaToken, Error: message}
+	if client != nil {
+		data.Client = client.Name
+		data.Scopes = strings.Fields(scope)
+		data.Params = req.params()
+	}
+
+	// The page collects passwords, it must never be framed or cached
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "frame-ancestors 'none'")
+	c.Header("Cache-Control", "no-store")
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := consentPage.Execute(c.Writer, data); err != nil {
+		logger.Errorf("Failed to render consent page: %v", err)
+	}
+}
+
+// redirectWithError sends an authorization error back to the client (RFC 6749 section 4.1.2.1)
+func redirectWithError(c *gin.Context, redirectURI, state string, err error) {
+	code, description := oauthErrorCode(err)
+	redirectWithParams(c, redirectURI, map[string]string{"error": code, "error_description": description, "state": state})
+}
+
+// redirectWithParams redirects to the client, adding the parameters to the query of its redirect URI
+func redirectWithParams(c *gin.Context, redirectURI string, params map[string]string) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid redirect URI")
+		return
+	}
+
+	query := target.Query()
+	for name, value := range params {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	target.RawQuery = query.Encode()
+	c.Redirect(http.StatusFound, target.String())
+}
+
+// respondOAuthToken writes a successful token response
+func respondOAuthToken(c *gin.Context, accessToken, refreshToken, scope string) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(http.StatusOK, &OAuthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(common.AccessTokenTTL().Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        scope,
+	})
+}
+
+// respondOAuthError writes an error response of the token endpoint (RFC 6749 section 5.2)
+func respondOAuthError(c *gin.Context, err error) {
+	code, description := oauthErrorCode(err)
+
+	status := http.StatusBadRequest
+	switch code {
+	case service.OAuthInvalidClient:
+		status = http.StatusUnauthorized
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	case service.OAuthServerError:
+		status = http.StatusInternalServerError
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, gin.H{"error": code, "error_description": description})
+}
+
+// oauthErrorCode maps an error to an OAuth error code. Our own errors come from checking
+// a grant, anything else is an internal failure whose details are not disclosed.
+func oauthErrorCode(err error) (string, string) {
+	switch e := err.(type) {
+	case *service.OAuthError:
+		return e.Code, e.Description
+	case interface{ GetCode() int }:
+		return service.OAuthInvalidGrant, err.Error()
+	default:
+		logger.Errorf("OAuth request failed: %v", err)
+		return service.OAuthServerError, "Internal server error"
+	}
+}
@@ -0,0 +1,132 @@
+package v1
+
+import (
+	"veo/internal/models"
+	"veo/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PasskeyAPI lets users sign in with passkeys instead of a password
+type PasskeyAPI struct {
+	passkeyService service.PasskeyService
+	userService    service.UserService
+	sessionService service.SessionService
+	issuer         *TokenIssuer
+}
+
+// NewPasskeyAPI creates a new instance of PasskeyAPI
+func NewPasskeyAPI(passkeyService service.PasskeyService, userService service.UserService, sessionService service.SessionService, issuer *TokenIssuer) *PasskeyAPI {
+	return &PasskeyAPI{passkeyService: passkeyService, userService: userService, sessionService: sessionService, issuer: issuer}
+}
+
+// SetupPasskeyRouter configures passkey-related routes
+func SetupPasskeyRouter(router *gin.Engine, api *PasskeyAPI) {
+	public := router.Group("/api/login/passkey")
+
+	// Public endpoints (the authenticator signs the challenge)
+	public.POST("/begin", api.BeginLogin)
+	public.POST("/finish", api.FinishLogin)
+
+	protected := router.Group("/api/passkeys")
+
+	// Protected endpoints (Require JWT authentication)
+	protected.Use(AuthMiddleware(), RequireScope(models.ScopeAccount))
+	{
+		protected.GET("", api.List)
+		protected.POST("/register/finish", api.FinishRegistration)
+
+		// Changing the ways to sign in requires a recent sign-in or password confirmation
+		recentAuth := requireRecentAuth(api.sessionService)
+		protected.POST("/register/begin", recentAuth, api.BeginRegistration)
+		protected.POST("/:id/delete", recentAuth, api.Delete)
+	}
+}
+
+// List returns the passkeys of the caller
+func (api *PasskeyAPI) List(c *gin.Context) {
+	passkeys, err := api.passkeyService.List(c.MustGet("userId").(int))
+	if AbortIfError(c, err) {
+		return
+	}
+
+	dtos := make([]models.PasskeyDTO, 0, len(passkeys))
+	for i := range passkeys {
+		dtos = append(dtos, passkeys[i].Sanitize())
+	}
+	RespondData(c, dtos)
+}
+
+// BeginRegistration returns the options the browser passes to navigator.credentials.create
+func (api *PasskeyAPI) BeginRegistration(c *gin.Context) {
+	user, err := api.userService.GetUserByID(c.MustGet("userId").(int))
+	if AbortIfError(c, err) {
+		return
+	}
+
+	options, err := api.passkeyService.BeginRegistration(user)
+	if AbortIfError(c, err) {
+		return
+	}
+	RespondData(c, options)
+}
+
+// FinishRegistration stores the passkey the browser created with the options of BeginRegistration
+func (api *PasskeyAPI) FinishRegistration(c *gin.Context) {
+	var req struct {
+		Name       string                         `json:"name"` // Optional label, e.g. the device
+		Credential service.RegistrationCredential `json:"credential"`
+	}
+	if !ParseRequest(c, &req) {
+		return
+	}
+
+	passkey, err := api.passkeyService.FinishRegistration(c.MustGet("userId").(int), req.Name, &req.Credential)
+	if AbortIfError(c, err) {
+		return
+	}
+	RespondData(c, passkey.Sanitize())
+}
+
+// Delete removes a passkey of the caller, the last way to sign in cannot be removed
+func (api *PasskeyAPI) Delete(c *gin.Context) {
+	var req struct {
+		ID int `uri:"id" binding:"required"`
+	}
+	if !ParseURI(c, &req) {
+		return
+	}
+
+	if AbortIfError(c, api.passkeyService.Delete(c.MustGet("userId").(int), req.ID)) {
+		return
+	}
+	RespondMessage(c, "Passkey removed")
+}
+
+// BeginLogin returns the options the browser passes to navigator.credentials.get
+func (api *PasskeyAPI) BeginLogin(c *gin.Context) {
+	options, err := api.passkeyService.BeginLogin()
+	if AbortIfError(c, err) {
+		return
+	}
+	RespondData(c, options)
+}
+
+// FinishLogin checks the assertion of the passkey and signs the user in like Login of AccountAPI does.
+// The authenticator verified the user, no second factor is asked.
+func (api *PasskeyAPI) FinishLogin(c *gin.Context) {
+	var req struct {
+		Credential service.AssertionCredential `json:"credential"`
+		Device     string                      `json:"device"` // Optional label of the device signing in
+	}
+	if !ParseRequest(c, &req) {
+		return
+	}
+
+	user, err := api.passkeyService.FinishLogin(&req.Credential)
+	if AbortIfError(c, err) {
+		return
+	}
+
+	api.issuer.SignIn(c, user, req.Device)
+}
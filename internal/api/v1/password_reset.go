@@ -0,0 +1,57 @@
+package v1
+
+import (
+	"veo/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PasswordResetAPI lets users who forgot their password set a new one
+type PasswordResetAPI struct {
+	passwordResetService service.PasswordResetService
+}
+
+// NewPasswordResetAPI creates a new instance of PasswordResetAPI
+func NewPasswordResetAPI(passwordResetService service.PasswordResetService) *PasswordResetAPI {
+	return &PasswordResetAPI{passwordResetService: passwordResetService}
+}
+
+// SetupPasswordResetRouter configures password reset routes
+func SetupPasswordResetRouter(router *gin.Engine, api *PasswordResetAPI) {
+	public := router.Group("/api")
+
+	// Public endpoints (the link in the mail proves the address)
+	public.POST("/forgotPassword", api.ForgotPassword)
+	public.POST("/resetPassword", api.ResetPassword)
+}
+
+// ForgotPassword mails a reset link. The response is the same whether or not the address has an account.
+func (api *PasswordResetAPI) ForgotPassword(c *gin.Context) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if !ParseRequest(c, &req) {
+		return
+	}
+
+	if AbortIfError(c, api.passwordResetService.Request(req.Email, c.ClientIP())) {
+		return
+	}
+	RespondMessage(c, "If the address belongs to an account, a reset link is on its way")
+}
+
+// ResetPassword sets a new password with the token of a reset link and signs the user out everywhere
+func (api *PasswordResetAPI) ResetPassword(c *gin.Context) {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"newPassword"`
+	}
+	if !ParseRequest(c, &req) {
+		return
+	}
+
+	if AbortIfError(c, api.passwordResetService.Reset(req.Token, req.NewPassword)) {
+		return
+	}
+	RespondMessage(c, "Password reset, please sign in with the new password")
+}
@@ -0,0 +1,63 @@
+package v1
+
+import (
+	"veo/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PhoneAPI lets users sign in, and sign up, with codes sent to their phone number
+type PhoneAPI struct {
+	phoneService service.PhoneService
+	mfaService   service.MFAService
+	issuer       *TokenIssuer
+}
+
+// NewPhoneAPI creates a new instance of PhoneAPI
+func NewPhoneAPI(phoneService service.PhoneService, mfaService service.MFAService, issuer *TokenIssuer) *PhoneAPI {
+	return &PhoneAPI{phoneService: phoneService, mfaService: mfaService, issuer: issuer}
+}
+
+// SetupPhoneRouter configures phone sign-in routes
+func SetupPhoneRouter(router *gin.Engine, api *PhoneAPI) {
+	public := router.Group("/api/login/phone")
+
+	// Public endpoints (the code sent by text message proves the number)
+	public.POST("", api.SendCode)
+	public.POST("/verify", api.Verify)
+}
+
+// SendCode sends a code by text message to the number, registered or not
+func (api *PhoneAPI) SendCode(c *gin.Context) {
+	var req struct {
+		Phone string `json:"phone"`
+	}
+	if !ParseRequest(c, &req) {
+		return
+	}
+
+	if AbortIfError(c, api.phoneService.SendCode(req.Phone, c.ClientIP())) {
+		return
+	}
+	RespondMessage(c, "A code was sent to the phone number")
+}
+
+// Verify signs in with the code sent to the number, creating an account for a new number.
+// Users with a second factor get an MFA challenge like Login of AccountAPI.
+func (api *PhoneAPI) Verify(c *gin.Context) {
+	var req struct {
+		Phone  string `json:"phone"`
+		Code   string `json:"code"`
+		Device string `json:"device"` // Optional label of the device signing in
+	}
+	if !ParseRequest(c, &req) {
+		return
+	}
+
+	user, err := api.phoneService.Verify(req.Phone, req.Code, c.ClientIP())
+	if AbortIfError(c, err) {
+		return
+	}
+
+	signInOrChallenge(c, api.mfaService, api.issuer, user, req.Device)
+}
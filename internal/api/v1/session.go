@@ -0,0 +1,82 @@
+package v1
+
+import (
+	"veo/internal/api/common"
+	"veo/internal/models"
+	"veo/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionAPI lets users review and end their login sessions
+type SessionAPI struct {
+	sessionService service.SessionService
+}
+
+// NewSessionAPI creates a new instance of SessionAPI
+func NewSessionAPI(sessionService service.SessionService) *SessionAPI {
+	return &SessionAPI{sessionService: sessionService}
+}
+
+// SetupSessionRouter configures session-related routes
+func SetupSessionRouter(router *gin.Engine, api *SessionAPI) {
+	protected := router.Group("/api/sessions")
+
+	// Protected endpoints (Require JWT authentication)
+	protected.Use(AuthMiddleware(), RequireScope(models.ScopeSessions))
+	{
+		protected.GET("", api.List)
+		protected.POST("/:id/revoke", api.Revoke)
+		protected.POST("/revokeOthers", api.RevokeOthers)
+	}
+}
+
+// List returns the active sessions of the caller, the current one is flagged
+func (api *SessionAPI) List(c *gin.Context) {
+	claims := c.MustGet("claims").(*common.UserClaims)
+	sessions, err := api.sessionService.List(claims.ID)
+	if AbortIfError(c, err) {
+		return
+	}
+
+	dtos := make([]models.SessionDTO, 0, len(sessions))
+	for i := range sessions {
+		dtos = append(dtos, sessions[i].Sanitize(claims.SessionID))
+	}
+	RespondData(c, dtos)
+}
+
+// Revoke ends one session of the caller, signing that device out
+func (api *SessionAPI) Revoke(c *gin.Context) {
+	var req struct {
+		ID int `uri:"id" binding:"required"`
+	}
+	if !ParseURI(c, &req) {
+		return
+	}
+
+	claims := c.MustGet("claims").(*common.UserClaims)
+	if AbortIfError(c, api.sessionService.Revoke(claims.ID, req.ID)) {
+		return
+	}
+
+	// Ending the current session is a logout
+	if req.ID == claims.SessionID {
+		if AbortIfError(c, common.RevokeAccessToken(claims)) {
+			return
+		}
+		common.ClearAuthCookies(c)
+	}
+
+	RespondMessage(c, "Session revoked")
+}
+
+// RevokeOthers ends every session of the caller except the current one
+func (api *SessionAPI) RevokeOthers(c *gin.Context) {
+	claims := c.MustGet("claims").(*common.UserClaims)
+	if AbortIfError(c, api.sessionService.RevokeOthers(claims.ID, claims.SessionID)) {
+		return
+	}
+
+	RespondMessage(c, "Other sessions revoked")
+}
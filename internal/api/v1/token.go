@@ -0,0 +1,146 @@
+package v1
+
+import (
+	"veo/internal/api/common"
+	"veo/internal/models"
+	"veo/internal/service"
+	"veo/internal/utils"
+	"veo/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TokenPair is returned by every endpoint that signs a user in
+type TokenPair struct {
+	AccessToken            string `json:"accessToken,omitempty"`            // Short-lived JWT sent with every request
+	RefreshToken           string `json:"refreshToken,omitempty"`           // Long-lived opaque token used to renew the access token
+	ExpiresIn              int    `json:"expiresIn"`                        // Access token lifetime in seconds
+	CSRFToken              string `json:"csrfToken,omitempty"`              // Double-submit token, only set in browser cookie mode
+	PasswordChangeRequired bool   `json:"passwordChangeRequired,omitempty"` // The tokens only allow changing the password
+}
+
+// TokenIssuer signs users in: it starts a login session and issues the tokens bound to it.
+// It is shared by every API with a sign-in endpoint.
+type TokenIssuer struct {
+	tokenService   service.TokenService
+	sessionService service.SessionService
+}
+
+// NewTokenIssuer creates a new instance of TokenIssuer
+func NewTokenIssuer(tokenService service.TokenService, sessionService service.SessionService) *TokenIssuer {
+	return &TokenIssuer{tokenService: tokenService, sessionService: sessionService}
+}
+
+// SignIn starts a session for the user on the requesting device and responds with its tokens.
+// device is the label chosen by the client, when empty one is derived from the user agent.
+// A user who must change its password gets tokens that only allow changing it.
+func (issuer *TokenIssuer) SignIn(c *gin.Context, user *models.User, device string) {
+	userAgent := c.Request.UserAgent()
+	if device == "" {
+		device = utils.DeviceFromUserAgent(userAgent)
+	}
+
+	start := issuer.sessionService.Start
+	if service.PasswordChangeRequired(user) {
+		start = issuer.sessionService.StartPasswordChange
+	}
+	session, err := start(user, device, userAgent, c.ClientIP())
+	if AbortIfError(c, err) {
+		return
+	}
+
+	accessToken, err := IssueAccessToken(user, session)
+	if AbortIfError(c, err) {
+		return
+	}
+
+	refreshToken, err := issuer.tokenService.IssueRefreshToken(user, session.ID)
+	if AbortIfError(c, err) {
+		return
+	}
+
+	issuer.respond(c, newTokenPair(accessToken, refreshToken, session))
+}
+
+// respond sends the tokens to the client, as HttpOnly cookies when it asked for the browser mode
+func (issuer *TokenIssuer) respond(c *gin.Context, tokens *TokenPair) {
+	if !common.WantsCookies(c) {
+		RespondData(c, tokens)
+		return
+	}
+
+	csrfToken, err := common.SetAuthCookies(c, tokens.AccessToken, common.AccessTokenTTL(), tokens.RefreshToken, issuer.tokenService.RefreshTokenTTL())
+	if AbortIfError(c, err) {
+		return
+	}
+
+	// Keep the tokens out of reach of JavaScript
+	RespondData(c, &TokenPair{ExpiresIn: tokens.ExpiresIn, CSRFToken: csrfToken, PasswordChangeRequired: tokens.PasswordChangeRequired})
+}
+
+// TokenAPI handles access token renewal
+type TokenAPI struct {
+	issuer *TokenIssuer
+}
+
+// NewTokenAPI creates a new instance of TokenAPI
+func NewTokenAPI(issuer *TokenIssuer) *TokenAPI {
+	return &TokenAPI{issuer: issuer}
+}
+
+// SetupTokenRouter configures token-related routes
+func SetupTokenRouter(router *gin.Engine, api *TokenAPI) {
+	public := router.Group("/api/token")
+
+	// Public endpoints (the refresh token is the credential)
+	public.POST("/refresh", api.Refresh)
+}
+
+// Refresh exchanges a refresh token for a new access token and a rotated refresh token,
+// and extends the session they belong to
+func (api *TokenAPI) Refresh(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+
+	// Browsers in cookie mode send the refresh token as a cookie and no body
+	if c.Request.ContentLength > 0 && !ParseRequest(c, &req) {
+		return
+	}
+	if req.RefreshToken == "" {
+		req.RefreshToken = common.RefreshTokenFromCookie(c)
+		if req.RefreshToken == "" {
+			AbortIfError(c, errors.NewInvalidParams("Missing refresh token"))
+			return
+		}
+		if AbortIfError(c, common.VerifyCSRF(c)) {
+			return
+		}
+	}
+
+	session, refreshToken, err := api.issuer.tokenService.RotateRefreshToken(req.RefreshToken, "")
+	if AbortIfError(c, err) {
+		return
+	}
+
+	if AbortIfError(c, api.issuer.sessionService.Extend(session)) {
+		return
+	}
+
+	accessToken, err := IssueAccessToken(&session.User, session)
+	if AbortIfError(c, err) {
+		return
+	}
+
+	api.issuer.respond(c, newTokenPair(accessToken, refreshToken, session))
+}
+
+// newTokenPair builds the response returned to the client for the tokens of the session
+func newTokenPair(accessToken, refreshToken string, session *models.Session) *TokenPair {
+	return &TokenPair{
+		AccessToken:            accessToken,
+		RefreshToken:           refreshToken,
+		ExpiresIn:              int(common.AccessTokenTTL().Seconds()),
+		PasswordChangeRequired: session.Scope == models.ScopePasswordChange,
+	}
+}
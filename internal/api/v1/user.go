@@ -1,6 +1,7 @@
 package v1
 
 import (
+	"veo/internal/models"
 	"veo/internal/service"
 	"veo/internal/utils"
 
@@ -24,7 +25,7 @@ func SetupUserRouter(router *gin.Engine, api *UserAPI) {
 	protected := router.Group("/api")
 
 	// Apply JWT authentication middleware
-	protected.Use(AuthMiddleware())
+	protected.Use(AuthMiddleware(), RequireScope(models.ScopeProfile))
 	{
 		protected.GET("/getUserInfo", api.GetUserInfo) // Route for retrieving user information
 	}
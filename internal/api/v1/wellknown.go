@@ -0,0 +1,15 @@
+package v1
+
+import (
+	"veo/internal/api/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupWellKnownRouter configures the public discovery routes under /.well-known.
+func SetupWellKnownRouter(router *gin.Engine) {
+	wellKnown := router.Group("/.well-known")
+
+	// Public keys used by other services to verify our tokens offline
+	wellKnown.GET("/jwks.json", common.JWKSHandler)
+}
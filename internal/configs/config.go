@@ -1,12 +1,28 @@
 package configs
 
 import (
+	"time"
+
 	"github.com/spf13/viper"
 )
 
 // Config represents the main application configuration structure.
 type Config struct {
-	Database DBConfig // Database configuration
+	Database       DBConfig             // Database configuration
+	JWT            JWTConfig            // JWT signing configuration
+	Cookie         CookieConfig         // Browser cookie mode configuration
+	Session        SessionConfig        // Access token strategy configuration
+	OIDC           OIDCConfig           // External OpenID Connect identity providers
+	MFA            MFAConfig            // Two-factor authentication
+	WebAuthn       WebAuthnConfig       // Passkey sign-in
+	Mail           MailConfig           // Outgoing mail
+	MagicLink      MagicLinkConfig      `mapstructure:"magic_link"` // Sign-in links sent by email
+	Phone          PhoneConfig          // Sign-in codes sent by text message
+	Email          EmailConfig          // Email addresses of users
+	PasswordReset  PasswordResetConfig  `mapstructure:"password_reset"` // Links resetting forgotten passwords
+	Lockout        LockoutConfig        // Back-off and lockout after failed password sign-ins
+	PasswordPolicy PasswordPolicyConfig `mapstructure:"password_policy"` // Rules new passwords must follow
+	PasswordHash   PasswordHashConfig   `mapstructure:"password_hash"`   // Algorithm and parameters passwords are hashed with
 }
 
 // DBConfig holds the database connection details.
@@ -19,6 +35,178 @@ type DBConfig struct {
 	Charset  string // Character set for the database
 }
 
+// JWTConfig holds the keyring used to sign and verify JWT tokens, the registered claims and the token lifetimes.
+type JWTConfig struct {
+	Keys            []JWTKeyConfig // Signing keys, exactly one of them must be active
+	Issuer          string         // iss claim stamped into and required from every token
+	Audiences       []string       // aud claim stamped into tokens, accepted by routes that do not name their own
+	ClockSkew       time.Duration  `mapstructure:"clock_skew"`        // Tolerance when checking exp, nbf and iat
+	AccessTokenTTL  time.Duration  `mapstructure:"access_token_ttl"`  // Lifetime of access tokens, e.g. 15m
+	RefreshTokenTTL time.Duration  `mapstructure:"refresh_token_ttl"` // Lifetime of refresh tokens, e.g. 720h
+	Denylist        string         // Where revoked token IDs are kept: memory (default) or database
+}
+
+// JWTKeyConfig describes a single signing key in the keyring.
+type JWTKeyConfig struct {
+	KID            string // Key ID stamped into the token header
+	Algorithm      string // HS256 (default), RS256, ES256 or EdDSA
+	Secret         string // HMAC secret used for HS256
+	PrivateKeyFile string `mapstructure:"private_key_file"` // PEM private key used for RS256, ES256 and EdDSA
+	Status         string // pending, active, retiring or retired
+}
+
+// CookieConfig controls the optional browser mode, where tokens travel in HttpOnly cookies.
+type CookieConfig struct {
+	Enabled       bool   // Lets clients ask for cookies instead of tokens in the response body
+	Domain        string // Cookie domain, empty for the host only
+	SameSite      string `mapstructure:"same_site"`      // strict, lax (default) or none
+	AllowInsecure bool   `mapstructure:"allow_insecure"` // Drops the Secure flag, for local development over plain HTTP
+}
+
+// SessionConfig selects how access tokens are issued and checked, and limits login sessions.
+type SessionConfig struct {
+	Strategy   string        // jwt (default) for stateless JWTs, session for opaque server-side sessions
+	TTL        time.Duration // Idle timeout of server-side sessions, extended on every request
+	MaxPerUser int           `mapstructure:"max_per_user"` // Concurrent sessions per user, the oldest is revoked beyond it
+}
+
+// OIDCConfig lists the OpenID Connect providers users can sign in with.
+type OIDCConfig struct {
+	Providers  []OIDCProviderConfig // Sign-in is offered at /api/oidc/<name>/login for each of them
+	LinkSecret string               `mapstructure:"link_secret"` // Signs the identities being linked to an account, the same on every instance
+}
+
+// OIDCProviderConfig describes our registration as a relying party at an OpenID Connect provider.
+type OIDCProviderConfig struct {
+	Name         string   // Short name used in URLs and stored with the identities of its users
+	Issuer       string   // Issuer URL, the provider metadata is discovered below it
+	ClientID     string   `mapstructure:"client_id"`     // Client ID registered at the provider
+	ClientSecret string   `mapstructure:"client_secret"` // Client secret, empty for a public client relying on PKCE alone
+	RedirectURL  string   `mapstructure:"redirect_url"`  // Our callback, e.g. https://auth.example.com/api/oidc/<name>/callback
+	Scopes       []string // Scopes requested besides openid, e.g. profile and email
+}
+
+// MFAConfig controls two-factor authentication with authenticator apps.
+type MFAConfig struct {
+	Issuer string // Name authenticator apps show next to the codes of our users
+}
+
+// WebAuthnConfig describes us as a WebAuthn relying party. Passkeys are bound to the relying party ID,
+// changing it makes every registered passkey unusable.
+type WebAuthnConfig struct {
+	RPID    string   `mapstructure:"rp_id"`   // Domain the passkeys are registered for, e.g. example.com
+	RPName  string   `mapstructure:"rp_name"` // Name shown by the browser when a passkey is created
+	Origins []string // Origins of the pages running the ceremonies, e.g. https://app.example.com
+}
+
+// MailConfig selects how mail is sent to users and signs the links it carries.
+type MailConfig struct {
+	Driver     string     // console (default) prints mail, file writes .eml files, smtp sends them
+	From       string     // Sender, e.g. veo <no-reply@example.com>
+	Dir        string     // Directory the file driver writes to
+	SMTP       SMTPConfig // Server used by the smtp driver
+	LinkSecret string     `mapstructure:"link_secret"` // Signs the links sent by email, shared by every instance
+}
+
+// SMTPConfig holds the SMTP server mail is sent through.
+type SMTPConfig struct {
+	Host     string // Server host name, also checked against its TLS certificate
+	Port     int    // Server port, usually 587
+	Username string // Optional, sent only over TLS
+	Password string // Password of Username
+}
+
+// MagicLinkConfig controls sign-in with single-use links sent by email.
+type MagicLinkConfig struct {
+	URL            string        // Frontend page the link opens, it posts the token query parameter to /api/login/magic/verify
+	TTL            time.Duration // Lifetime of a link, 15m when empty
+	AllowedDomains []string      `mapstructure:"allowed_domains"` // Addresses of these domains get an account on their first sign-in
+}
+
+// PhoneConfig controls sign-in with one-time codes sent by text message.
+type PhoneConfig struct {
+	Provider           string        // SMS provider, log (default) writes messages to the log instead of sending them
+	DefaultCountryCode string        `mapstructure:"default_country_code"` // Calling code of numbers entered without one, e.g. 1 or 44
+	CodeTTL            time.Duration `mapstructure:"code_ttl"`             // Lifetime of a code, 5m when empty
+}
+
+// EmailConfig controls the email addresses of users and their verification.
+type EmailConfig struct {
+	VerifyURL       string        `mapstructure:"verify_url"`       // Frontend page the verification link opens, it posts the token query parameter to /api/email/verify
+	VerifyTTL       time.Duration `mapstructure:"verify_ttl"`       // Lifetime of a verification link, 24h when empty
+	RequireVerified bool          `mapstructure:"require_verified"` // Require an address at registration, and block password sign-in until it is verified
+}
+
+// PasswordResetConfig controls the links sent to users who forgot their password.
+type PasswordResetConfig struct {
+	URL string        // Frontend page the link opens, it posts the token query parameter with the new password to /api/resetPassword
+	TTL time.Duration // Lifetime of a link, 1h when empty
+}
+
+// LockoutConfig controls how failed password sign-ins slow down and then lock out a user or an IP.
+type LockoutConfig struct {
+	BackoffAfter  int           `mapstructure:"backoff_after"`   // Failures after which each attempt must wait, doubling from 1s, 3 when empty
+	MaxDelay      time.Duration `mapstructure:"max_delay"`       // Longest wait between attempts, 1m when empty
+	MaxFailures   int           `mapstructure:"max_failures"`    // Failures locking a user out, 10 when empty
+	IPMaxFailures int           `mapstructure:"ip_max_failures"` // Failures blocking an IP, whatever the users tried, 50 when empty
+	Duration      time.Duration // Length of a lockout, 15m when empty
+	ResetAfter    time.Duration `mapstructure:"reset_after"` // Quiet time after which failures are forgotten, 1h when empty
+}
+
+// PasswordPolicyConfig lists the rules new passwords must follow. Passwords set before a rule was added keep working.
+type PasswordPolicyConfig struct {
+	MinLength           int           `mapstructure:"min_length"`            // Fewest characters, 8 when empty
+	MaxLength           int           `mapstructure:"max_length"`            // Most bytes, 72 when empty since bcrypt cannot hash more
+	RequiredClasses     []string      `mapstructure:"required_classes"`      // Classes every password must contain: lower, upper, digit and symbol
+	MinClasses          int           `mapstructure:"min_classes"`           // Different classes every password must contain, whichever they are
+	RejectUsername      bool          `mapstructure:"reject_username"`       // Refuse passwords containing or resembling the username
+	CommonPasswordsFile string        `mapstructure:"common_passwords_file"` // Breached or common passwords to refuse, one per line, compared case-insensitively
+	MinEntropy          float64       `mapstructure:"min_entropy"`           // Estimated strength in bits every password must reach, 0 to skip
+	History             int           // Previous passwords of a user that cannot be set again, 0 to allow any
+	MaxAge              time.Duration `mapstructure:"max_age"` // Age after which a password must be changed at sign-in, 0 for never
+}
+
+// PasswordHashConfig selects how new passwords are hashed. Hashes made with another algorithm or other
+// parameters keep working, and are replaced when their user signs in.
+type PasswordHashConfig struct {
+	Algorithm string         // argon2id (default), bcrypt or scrypt
+	Argon2id  Argon2idConfig // Parameters of argon2id
+	Bcrypt    BcryptConfig   // Parameters of bcrypt
+	Scrypt    ScryptConfig   // Parameters of scrypt
+	Peppers   []PepperConfig // Secrets mixed into passwords before hashing, so hashes leaked from the database cannot be attacked alone
+}
+
+// PepperConfig describes a pepper: an HMAC key applied to passwords before hashing. Every hash records the
+// version of its pepper, removing a pepper makes the passwords hashed with it unusable.
+type PepperConfig struct {
+	Version int    // Recorded in the hashes made with the pepper, never reuse one
+	Secret  string // HMAC key, at least 32 random bytes
+	Status  string // active peppers new hashes, retired only verifies old ones until they are re-peppered at sign-in
+}
+
+// Argon2idConfig holds the parameters of argon2id hashes.
+type Argon2idConfig struct {
+	Memory      int // Memory in KiB, 65536 when empty
+	Iterations  int // Passes over the memory, 3 when empty
+	Parallelism int // Threads, 2 when empty
+	SaltLength  int `mapstructure:"salt_length"` // Bytes of salt, 16 when empty
+	KeyLength   int `mapstructure:"key_length"`  // Bytes of hash, 32 when empty
+}
+
+// BcryptConfig holds the parameters of bcrypt hashes.
+type BcryptConfig struct {
+	Cost int // Base 2 logarithm of the rounds, 10 when empty
+}
+
+// ScryptConfig holds the parameters of scrypt hashes.
+type ScryptConfig struct {
+	N          int // CPU and memory cost, a power of two, 32768 when empty
+	R          int // Block size, 8 when empty
+	P          int // Parallelization, 1 when empty
+	SaltLength int `mapstructure:"salt_length"` // Bytes of salt, 16 when empty
+	KeyLength  int `mapstructure:"key_length"`  // Bytes of hash, 32 when empty
+}
+
 // Load reads the configuration file from the specified path and unmarshals it into the Config struct.
 func Load(configPath string) (*Config, error) {
 	viper.SetConfigFile(configPath) // Set the path of the configuration file
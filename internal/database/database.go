@@ -21,8 +21,9 @@ var logger = utils.GetLogger()
 func Init(config configs.DBConfig) error {
 	var initErr error
 	once.Do(func() {
-		// Construct the Data Source Name (DSN) for MySQL connection
-		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s",
+		// Construct the Data Source Name (DSN) for MySQL connection,
+		// parseTime lets DATETIME columns scan into time.Time
+		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&parseTime=True&loc=Local",
 			config.Username,
 			config.Password,
 			config.Host,
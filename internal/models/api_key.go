@@ -0,0 +1,52 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix starts every API key, telling AuthMiddleware and secret scanners what the token is.
+const APIKeyPrefix = "veo_"
+
+// APIKey represents the database model for a personal access token used by scripts and CI jobs.
+// Only the SHA-256 hash of the key is stored, the key itself is shown once when it is created.
+type APIKey struct {
+	ID         int        `gorm:"primaryKey"` // Unique key ID (primary key)
+	UserID     int        `gorm:"index"`      // Owner of the key
+	User       User       // Owner, preloaded when the key is authenticated
+	Name       string     // Name chosen by the owner
+	Prefix     string     // First characters of the key, shown to tell keys apart
+	KeyHash    string     `gorm:"unique"` // SHA-256 hash of the key
+	Scopes     string     // Space separated scopes granted to the key
+	ExpiresAt  *time.Time // Optional end of validity
+	LastUsedAt *time.Time // Last time the key authenticated a request
+	LastUsedIP string     // Client IP of that request
+	RevokedAt  *time.Time // Set when the owner revokes the key
+	CreatedAt  time.Time  // Time the key was created
+}
+
+// APIKeyDTO is a data transfer object (DTO) for API key data shown to its owner.
+type APIKeyDTO struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	LastUsedIP string     `json:"lastUsedIp"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// Sanitize removes the key hash and returns an APIKeyDTO.
+func (k *APIKey) Sanitize() APIKeyDTO {
+	return APIKeyDTO{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     strings.Fields(k.Scopes),
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		LastUsedIP: k.LastUsedIP,
+		CreatedAt:  k.CreatedAt,
+	}
+}
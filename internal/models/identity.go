@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Kinds of identity a user can sign in with
+const (
+	IdentityPassword = "password" // The username and password of the user, its subject is the user ID
+	IdentityOIDC     = "oidc"     // A subject at an OpenID Connect provider
+	IdentityPhone    = "phone"    // A phone number receiving one-time codes
+	IdentityPasskey  = "passkey"  // A WebAuthn credential, its subject is the passkey ID
+	IdentityEmail    = "email"    // An email address receiving sign-in links, its subject is the lower case address
+)
+
+// Identity represents the database model for a way of signing in as a user. A user has at least one,
+// and duplicate accounts are avoided by linking several identities to the same user.
+// The password hash itself stays on the user, its identity only records that one is set.
+type Identity struct {
+	ID          int        `gorm:"primaryKey"` // Unique identity ID (primary key)
+	UserID      int        `gorm:"index"`      // User the identity signs in as
+	User        User       // User, preloaded when the identity signs in
+	Type        string     `gorm:"size:16;uniqueIndex:idx_identity_subject"`  // Kind of identity, see IdentityPassword and others
+	Provider    string     `gorm:"size:64;uniqueIndex:idx_identity_subject"`  // Name of the identity provider, empty unless Type is oidc
+	Subject     string     `gorm:"size:255;uniqueIndex:idx_identity_subject"` // Stable ID of the identity, e.g. the sub claim of the provider
+	Email       string     // Email address asserted by the provider when the identity was linked
+	LastLoginAt *time.Time // Last time the identity signed in
+	CreatedAt   time.Time  // Time the identity was linked
+}
+
+// IdentityDTO is a data transfer object (DTO) for identity data shown to its owner.
+type IdentityDTO struct {
+	ID          int        `json:"id"`
+	Type        string     `json:"type"`
+	Provider    string     `json:"provider,omitempty"`
+	Email       string     `json:"email,omitempty"`
+	LastLoginAt *time.Time `json:"lastLoginAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+// Sanitize returns an IdentityDTO.
+func (i *Identity) Sanitize() IdentityDTO {
+	return IdentityDTO{
+		ID:          i.ID,
+		Type:        i.Type,
+		Provider:    i.Provider,
+		Email:       i.Email,
+		LastLoginAt: i.LastLoginAt,
+		CreatedAt:   i.CreatedAt,
+	}
+}
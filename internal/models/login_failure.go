@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// LoginFailure represents the database model for the failed sign-ins counted against a user or an IP,
+// shared by every instance.
+type LoginFailure struct {
+	Key          string     `gorm:"primaryKey;size:191"` // What failed, user:<username> or ip:<address>
+	Failures     int        // Failed sign-ins since the failures were last forgotten
+	LastFailedAt time.Time  `gorm:"index"` // Time of the last failed sign-in
+	LockedUntil  *time.Time // End of the current lockout, nil if none was ever started
+}
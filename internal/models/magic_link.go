@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// MagicLink represents the database model for a single-use sign-in link sent by email.
+// Only the hash of its token is stored, the link in the mail is the only copy.
+type MagicLink struct {
+	ID        int        `gorm:"primaryKey"` // Unique link ID (primary key)
+	TokenHash string     `gorm:"unique"`     // SHA-256 hash of the signed token
+	Email     string     // Lower case address the link was sent to
+	ExpiresAt time.Time  `gorm:"index"` // Time after which the link no longer signs in
+	UsedAt    *time.Time // Time the link signed in, nil while unused
+	CreatedAt time.Time  // Time the link was sent
+}
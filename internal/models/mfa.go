@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// TOTPCredential represents the database model for the authenticator app of a user (RFC 6238).
+// The secret must be readable to check codes, so unlike passwords and tokens it is not hashed.
+type TOTPCredential struct {
+	ID           int        `gorm:"primaryKey"` // Unique credential ID (primary key)
+	UserID       int        `gorm:"unique"`     // User the authenticator app belongs to
+	Secret       string     // Base32 encoded shared secret
+	ConfirmedAt  *time.Time // Set once the user entered a first code, the second factor is enabled from then on
+	LastUsedStep int64      // Time step of the last accepted code, a code cannot be used twice
+	CreatedAt    time.Time  // Time the enrollment started
+}
+
+// RecoveryCode represents the database model for a one-time code that replaces the authenticator app,
+// for users who lost it. Only the SHA-256 hash of the code is stored.
+type RecoveryCode struct {
+	ID        int        `gorm:"primaryKey"` // Unique code ID (primary key)
+	UserID    int        `gorm:"index"`      // User the code belongs to
+	CodeHash  string     `gorm:"unique"`     // SHA-256 hash of the normalized code
+	UsedAt    *time.Time // Set once the code has been used
+	CreatedAt time.Time  // Time the code was generated
+}
+
+// MFAChallenge represents the database model for a sign-in waiting for its second factor.
+// The password step hands out the challenge token, of which only the SHA-256 hash is stored.
+type MFAChallenge struct {
+	ID        int       `gorm:"primaryKey"` // Unique challenge ID (primary key)
+	TokenHash string    `gorm:"unique"`     // SHA-256 hash of the challenge token
+	UserID    int       `gorm:"index"`      // User who entered their password
+	User      User      `gorm:"foreignKey:UserID"`
+	Attempts  int       // Wrong codes entered so far
+	ExpiresAt time.Time // Time after which the password must be entered again
+	CreatedAt time.Time // Time the password was checked
+}
+
+// MFAStatus tells a user whether their account is protected by a second factor.
+type MFAStatus struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// OAuth 2.0 grant types a client may be registered for
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+	GrantRefreshToken      = "refresh_token"
+)
+
+// OAuthScopes lists the scopes an OAuth client may be registered for. Account management is left
+// to the user's own sign-ins, like for API keys.
+var OAuthScopes = []string{ScopeProfile, ScopeSessions}
+
+// OAuthClient represents the database model for an application registered with the authorization server.
+// Confidential clients authenticate with a secret, of which only the SHA-256 hash is stored.
+// Public clients, such as mobile and single-page apps, have no secret and rely on PKCE.
+type OAuthClient struct {
+	ID           int       `gorm:"primaryKey"` // Unique row ID (primary key)
+	ClientID     string    `gorm:"unique"`     // Public identifier of the client
+	SecretHash   string    // SHA-256 hash of the client secret, empty for public clients
+	Name         string    // Name shown on the consent page
+	RedirectURIs string    // Space separated redirect URIs, matched exactly
+	Scopes       string    // Space separated scopes the client may request
+	GrantTypes   string    // Space separated grant types the client may use
+	Public       bool      // Whether the client cannot keep a secret
+	CreatedAt    time.Time // Time the client was registered
+}
+
+// HasRedirectURI reports whether uri is registered for the client.
+func (c *OAuthClient) HasRedirectURI(uri string) bool {
+	return containsField(c.RedirectURIs, uri)
+}
+
+// HasGrantType reports whether the client may use the grant type.
+func (c *OAuthClient) HasGrantType(grantType string) bool {
+	return containsField(c.GrantTypes, grantType)
+}
+
+// OAuthClientDTO is a data transfer object (DTO) for OAuth client data shown to administrators.
+type OAuthClientDTO struct {
+	ClientID     string    `json:"clientId"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirectUris"`
+	Scopes       []string  `json:"scopes"`
+	GrantTypes   []string  `json:"grantTypes"`
+	Public       bool      `json:"public"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// Sanitize removes the secret hash and returns an OAuthClientDTO.
+func (c *OAuthClient) Sanitize() OAuthClientDTO {
+	return OAuthClientDTO{
+		ClientID:     c.ClientID,
+		Name:         c.Name,
+		RedirectURIs: strings.Fields(c.RedirectURIs),
+		Scopes:       strings.Fields(c.Scopes),
+		GrantTypes:   strings.Fields(c.GrantTypes),
+		Public:       c.Public,
+		CreatedAt:    c.CreatedAt,
+	}
+}
+
+// OAuthAuthorizationCode represents the database model for a code handed out by the authorization endpoint.
+// Codes are short-lived, single use and bound to their client, redirect URI and PKCE challenge.
+type OAuthAuthorizationCode struct {
+	ID            int        `gorm:"primaryKey"` // Unique code ID (primary key)
+	CodeHash      string     `gorm:"unique"`     // SHA-256 hash of the code
+	ClientID      string     `gorm:"index"`      // Client the code was issued to
+	UserID        int        // User who approved the request
+	RedirectURI   string     // Redirect URI the code was sent to
+	Scope         string     // Space separated scopes approved by the user
+	CodeChallenge string     // PKCE S256 challenge
+	ExpiresAt     time.Time  // Time after which the code can no longer be exchanged
+	UsedAt        *time.Time // Set once the code has been exchanged
+	CreatedAt     time.Time  // Time the code was issued
+}
+
+// containsField reports whether value is one of the space separated fields
+func containsField(fields, value string) bool {
+	for _, field := range strings.Fields(fields) {
+		if field == value {
+			return true
+		}
+	}
+	return false
+}
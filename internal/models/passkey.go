@@ -0,0 +1,60 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Ceremonies a passkey challenge is handed out for
+const (
+	PasskeyRegistration = "registration"
+	PasskeyLogin        = "login"
+)
+
+// Passkey represents the database model for a WebAuthn credential a user signs in with, without a password.
+// The authenticator keeps the private key, only the public key is stored. Each passkey has an identity
+// of type passkey whose subject is the passkey ID.
+type Passkey struct {
+	ID             int        `gorm:"primaryKey"` // Unique passkey ID (primary key)
+	UserID         int        `gorm:"index"`      // User the passkey signs in as
+	User           User       // User, preloaded when the passkey signs in
+	Name           string     // Label chosen by the user, e.g. the device
+	CredentialID   string     `gorm:"size:1400"` // Base64url credential ID chosen by the authenticator
+	CredentialHash string     `gorm:"unique"`    // SHA-256 hash of CredentialID, credential IDs are too long to index
+	PublicKey      []byte     // COSE encoded public key
+	SignCount      uint32     // Signature counter of the authenticator, 0 if it keeps none
+	Transports     string     // Space separated transports reported by the browser, e.g. internal hybrid
+	LastUsedAt     *time.Time // Last time the passkey signed in
+	CreatedAt      time.Time  // Time the passkey was registered
+}
+
+// PasskeyDTO is a data transfer object (DTO) for passkey data shown to its owner.
+type PasskeyDTO struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Transports []string   `json:"transports"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// Sanitize removes the key material and returns a PasskeyDTO.
+func (p *Passkey) Sanitize() PasskeyDTO {
+	return PasskeyDTO{
+		ID:         p.ID,
+		Name:       p.Name,
+		Transports: strings.Fields(p.Transports),
+		LastUsedAt: p.LastUsedAt,
+		CreatedAt:  p.CreatedAt,
+	}
+}
+
+// PasskeyChallenge represents the database model for a challenge handed out to start a WebAuthn ceremony.
+// The browser echoes the challenge in the client data, which is how the ceremony is found again.
+type PasskeyChallenge struct {
+	ID            int       `gorm:"primaryKey"` // Unique challenge ID (primary key)
+	ChallengeHash string    `gorm:"unique"`     // SHA-256 hash of the base64url challenge
+	Purpose       string    `gorm:"size:16"`    // PasskeyRegistration or PasskeyLogin
+	UserID        int       // User registering a passkey, 0 for sign-ins
+	ExpiresAt     time.Time // Time after which the ceremony must start over
+	CreatedAt     time.Time // Time the challenge was handed out
+}
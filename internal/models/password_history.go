@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// PasswordHistory represents the database model for a password a user set, kept so it cannot be set again.
+// The newest entries of a user are kept, as many as the password policy asks for.
+type PasswordHistory struct {
+	ID        int       `gorm:"primaryKey"` // Unique entry ID (primary key)
+	UserID    int       `gorm:"index"`      // User who set the password
+	Password  string    // Hash of the password
+	CreatedAt time.Time // Time the password was set
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// PasswordReset represents the database model for a single-use token mailed to a user who forgot its password.
+// Only the hash of the token is stored, the link in the mail is the only copy.
+type PasswordReset struct {
+	ID        int        `gorm:"primaryKey"` // Unique reset ID (primary key)
+	TokenHash string     `gorm:"unique"`     // SHA-256 hash of the token
+	UserID    int        `gorm:"index"`      // User whose password the token resets
+	ExpiresAt time.Time  `gorm:"index"`      // Time after which the token no longer resets the password
+	UsedAt    *time.Time // Time the password was reset with the token, nil while unused
+	CreatedAt time.Time  // Time the token was sent
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// PhoneCode represents the database model for a one-time code sent by text message to sign in or sign up
+// with a phone number. A number has at most one live code, sending a new one replaces it.
+type PhoneCode struct {
+	ID        int       `gorm:"primaryKey"`     // Unique code ID (primary key)
+	Phone     string    `gorm:"size:16;unique"` // E.164 number the code was sent to
+	CodeHash  string    // SHA-256 hash of the code
+	Attempts  int       // Wrong codes entered so far
+	ExpiresAt time.Time `gorm:"index"` // Time after which a new code must be sent
+	CreatedAt time.Time // Time the code was sent
+}
@@ -0,0 +1,13 @@
+package models
+
+import (
+	"time"
+)
+
+// RateLimit represents the database model for the requests counted against a key in a fixed window,
+// shared by every instance.
+type RateLimit struct {
+	Key       string    `gorm:"primaryKey;size:191"` // What is limited, e.g. magic:ip:203.0.113.7
+	Count     int       // Requests counted in the current window
+	ExpiresAt time.Time `gorm:"index"` // End of the current window, after which the entry can be purged
+}
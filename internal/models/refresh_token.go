@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken represents the database model for an opaque refresh token.
+// Only the SHA-256 hash of the token is stored.
+type RefreshToken struct {
+	ID           int        `gorm:"primaryKey"` // Unique token ID (primary key)
+	UserID       int        `gorm:"index"`      // Owner of the token
+	SessionID    int        `gorm:"index"`      // Login session the token keeps alive
+	FamilyID     string     `gorm:"index"`      // Shared by every token rotated from the same login
+	TokenHash    string     `gorm:"unique"`     // SHA-256 hash of the token
+	TokenVersion int        // Token version of the user when the family was started
+	ExpiresAt    time.Time  // Time after which the token can no longer be used
+	RotatedAt    *time.Time // Set once the token has been exchanged for a new one
+	RevokedAt    *time.Time // Set when the token family has been revoked
+	CreatedAt    time.Time  // Time the token was issued
+}
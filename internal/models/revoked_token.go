@@ -0,0 +1,11 @@
+package models
+
+import (
+	"time"
+)
+
+// RevokedToken represents the database model for a denylisted JWT.
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey"` // Token ID from the jti claim
+	ExpiresAt time.Time `gorm:"index"`      // Expiry of the token, after which the entry can be purged
+}
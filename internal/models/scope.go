@@ -0,0 +1,13 @@
+package models
+
+// Scopes limit what a delegated credential, such as an API key, may do.
+// Interactive sign-ins carry no scope and may use every endpoint.
+const (
+	ScopeProfile        = "profile"         // Read the user's profile
+	ScopeSessions       = "sessions"        // List and revoke the user's login sessions
+	ScopeAccount        = "account"         // Manage passwords, credentials and API keys, never granted to API keys or OAuth clients
+	ScopePasswordChange = "password_change" // Only change the password, granted to sign-ins whose password must be changed first
+)
+
+// APIKeyScopes lists the scopes an API key may be created with.
+var APIKeyScopes = []string{ScopeProfile, ScopeSessions}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+)
+
+// Session represents the database model for a login session.
+// Every sign-in and every OAuth grant starts one; the access and refresh tokens issued for it are bound to it.
+// Sessions of the client credentials grant belong to a client only, their UserID is 0.
+// With the opaque session strategy the access token is the session token itself,
+// and only its SHA-256 hash is stored.
+type Session struct {
+	ID              int       `gorm:"primaryKey"` // Unique session ID (primary key)
+	UserID          int       `gorm:"index"`      // Owner of the session
+	User            User      // Owner, preloaded when the session is authenticated
+	TokenHash       *string   `gorm:"unique"` // SHA-256 hash of the opaque session token, unused with JWTs
+	TokenVersion    int       // Token version of the user when the session was created
+	ClientID        string    `gorm:"index"` // OAuth client the session was granted to, empty for direct sign-ins
+	Scope           string    // Space separated scopes granted to the OAuth client
+	Device          string    // Device label given by the client or derived from the user agent
+	UserAgent       string    // User agent of the sign-in request
+	IP              string    // Client IP of the sign-in request
+	ExpiresAt       time.Time // End of the session, pushed back while it is used
+	LastSeenAt      time.Time // Last time the session authenticated a request
+	AuthenticatedAt time.Time // Last time the user proved who they are in this session, by signing in or confirming the password
+	CreatedAt       time.Time // Time the session was created
+}
+
+// SessionDTO is a data transfer object (DTO) for session data shown to its owner.
+type SessionDTO struct {
+	ID         int       `json:"id"`
+	Device     string    `json:"device"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	Current    bool      `json:"current"` // Whether this is the session making the request
+}
+
+// Sanitize removes the token hash and returns a SessionDTO.
+func (s *Session) Sanitize(currentID int) SessionDTO {
+	return SessionDTO{
+		ID:         s.ID,
+		Device:     s.Device,
+		UserAgent:  s.UserAgent,
+		IP:         s.IP,
+		CreatedAt:  s.CreatedAt,
+		LastSeenAt: s.LastSeenAt,
+		Current:    s.ID == currentID,
+	}
+}
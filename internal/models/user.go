@@ -1,42 +1,56 @@
 package models
 
 import (
-	"golang.org/x/crypto/bcrypt"
+	"time"
+	"veo/internal/utils"
 )
 
 // User represents the database model for a user.
 type User struct {
-	ID       int    `gorm:"primaryKey"` // Unique user ID (primary key)
-	Username string `gorm:"unique"`     // Unique username
-	Password string // Hashed password
+	ID                 int        `gorm:"primaryKey"` // Unique user ID (primary key)
+	Username           string     `gorm:"unique"`     // Unique username
+	Password           string     // Hashed password
+	Email              *string    `gorm:"size:254;unique"` // Verified lower case email address, nil if none
+	EmailVerifiedAt    *time.Time // Time Email was verified
+	PendingEmail       string     `gorm:"size:254"`       // Address waiting for its verification link to be opened, replacing Email once verified
+	Phone              *string    `gorm:"size:16;unique"` // E.164 phone number receiving sign-in codes, nil if none
+	PhoneVerifiedAt    *time.Time // Time a code sent to Phone was last entered
+	TokenVersion       int        // Embedded in every token, bumping it invalidates all tokens issued before
+	IsAdmin            bool       // Grants access to the admin endpoints
+	PasswordChangedAt  *time.Time // Time the password was last set, nil if unknown
+	MustChangePassword bool       // Set by an admin, sign-ins can only change the password until it is changed
 }
 
 // UserDTO is a data transfer object (DTO) for user data.
 // It is used to return user information without sensitive fields.
 type UserDTO struct {
-	ID       int    `json:"id"`
-	Username string `json:"username"`
+	ID                 int    `json:"id"`
+	Username           string `json:"username"`
+	Email              string `json:"email,omitempty"`
+	PendingEmail       string `json:"pendingEmail,omitempty"` // Address waiting to be verified
+	Phone              string `json:"phone,omitempty"`
+	MustChangePassword bool   `json:"mustChangePassword,omitempty"` // The password must be changed before anything else
 }
 
 // Sanitize removes sensitive information (e.g., password) and returns a UserDTO.
 func (u *User) Sanitize() UserDTO {
-	return UserDTO{
-		ID:       u.ID,
-		Username: u.Username,
+	dto := UserDTO{
+		ID:                 u.ID,
+		Username:           u.Username,
+		PendingEmail:       u.PendingEmail,
+		MustChangePassword: u.MustChangePassword,
 	}
-}
-
-// GetHashedPassword hashes a given password using bcrypt.
-func GetHashedPassword(password string) (string, error) {
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
+	if u.Email != nil {
+		dto.Email = *u.Email
+	}
+	if u.Phone != nil {
+		dto.Phone = *u.Phone
 	}
-	return string(hashedBytes), nil
+	return dto
 }
 
-// CheckPassword verifies whether the given password matches the stored hashed password.
+// CheckPassword verifies whether the given password matches the stored hashed password, whatever its algorithm.
 func (u *User) CheckPassword(password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
-	return err == nil
+	ok, _ := utils.VerifyPassword(password, u.Password)
+	return ok
 }
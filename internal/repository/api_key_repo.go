@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"time"
+	"veo/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// APIKeyRepository handles database operations for API keys
+type APIKeyRepository struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyRepository creates a new instance of APIKeyRepository
+func NewAPIKeyRepository(db *gorm.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+// Create stores a new API key
+func (r *APIKeyRepository) Create(key *models.APIKey) error {
+	return r.db.Omit("User").Create(key).Error
+}
+
+// GetByHash retrieves an API key and its owner by the hash of the key, returning nil if it does not exist
+func (r *APIKeyRepository) GetByHash(keyHash string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.db.Preload("User").Where("key_hash = ?", keyHash).First(&key).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ListByUser retrieves the API keys of a user that were not revoked, newest first
+func (r *APIKeyRepository) ListByUser(userID int) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL", userID).Order("created_at DESC, id DESC").Find(&keys).Error
+	return keys, err
+}
+
+// Touch records the use of an API key
+func (r *APIKeyRepository) Touch(id int, lastUsedAt time.Time, ip string) error {
+	return r.db.Model(&models.APIKey{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"last_used_at": lastUsedAt,
+		"last_used_ip": ip,
+	}).Error
+}
+
+// Revoke revokes an API key of the user, returning false if the user has no such key
+func (r *APIKeyRepository) Revoke(userID, id int) (bool, error) {
+	result := r.db.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// RevokeByHash revokes an API key by the hash of the key, returning false if there is no such active key
+func (r *APIKeyRepository) RevokeByHash(keyHash string) (bool, error) {
+	result := r.db.Model(&models.APIKey{}).
+		Where("key_hash = ? AND revoked_at IS NULL", keyHash).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// revokeAPIKeys revokes every API key of a user within the transaction
+func revokeAPIKeys(tx *gorm.DB, userID int) error {
+	return tx.Model(&models.APIKey{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", time.Now()).Error
+}
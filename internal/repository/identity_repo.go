@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"time"
+	"veo/internal/models"
+	"veo/pkg/errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdentityRepository handles database operations for external identities
+type IdentityRepository struct {
+	db *gorm.DB
+}
+
+// NewIdentityRepository creates a new instance of IdentityRepository
+func NewIdentityRepository(db *gorm.DB) *IdentityRepository {
+	return &IdentityRepository{db: db}
+}
+
+// Create stores a new identity
+func (r *IdentityRepository) Create(identity *models.Identity) error {
+	return r.db.Omit("User").Create(identity).Error
+}
+
+// GetBySubject retrieves an identity and its user by type, provider and subject, returning nil if it does not exist
+func (r *IdentityRepository) GetBySubject(identityType, provider, subject string) (*models.Identity, error) {
+	var identity models.Identity
+	err := r.db.Preload("User").Where("type = ? AND provider = ? AND subject = ?", identityType, provider, subject).First(&identity).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// ListByUser retrieves the identities of a user, oldest first
+func (r *IdentityRepository) ListByUser(userID int) ([]models.Identity, error) {
+	var identities []models.Identity
+	err := r.db.Where("user_id = ?", userID).Order("created_at, id").Find(&identities).Error
+	return identities, err
+}
+
+// Touch records a sign-in with the identity
+func (r *IdentityRepository) Touch(id int, lastLoginAt time.Time) error {
+	return r.db.Model(&models.Identity{}).Where("id = ?", id).Update("last_login_at", lastLoginAt).Error
+}
+
+// Delete removes an identity of the user and returns it, or nil if the user has no such identity.
+// The last identity of a user is never removed, the user could no longer sign in.
+// Removing the password identity also clears the password hash, removing a passkey identity deletes the passkey
+// and removing an email or phone identity clears the address or number.
+func (r *IdentityRepository) Delete(userID, id int) (*models.Identity, error) {
+	var removed *models.Identity
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the identities of the user so concurrent removals cannot take away the last two at once
+		var identities []models.Identity
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).Find(&identities).Error; err != nil {
+			return err
+		}
+		for i := range identities {
+			if identities[i].ID == id {
+				removed = &identities[i]
+			}
+		}
+		if removed == nil {
+			return nil
+		}
+		if len(identities) == 1 {
+			return errors.NewPermissionDenied("The last way to sign in cannot be removed")
+		}
+
+		if err := tx.Delete(&models.Identity{}, id).Error; err != nil {
+			return err
+		}
+		switch removed.Type {
+		case models.IdentityPassword:
+			return tx.Model(&models.User{}).Where("id = ?", userID).Update("password", "").Error
+		case models.IdentityPasskey:
+			return tx.Where("id = ? AND user_id = ?", removed.Subject, userID).Delete(&models.Passkey{}).Error
+		case models.IdentityPhone:
+			return tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{"phone": nil, "phone_verified_at": nil}).Error
+		case models.IdentityEmail:
+			return tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{"email": nil, "email_verified_at": nil}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
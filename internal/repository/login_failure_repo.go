@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"time"
+	"veo/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginFailureRepository counts failed sign-ins per user and per IP
+type LoginFailureRepository struct {
+	db *gorm.DB
+}
+
+// NewLoginFailureRepository creates a new instance of LoginFailureRepository
+func NewLoginFailureRepository(db *gorm.DB) *LoginFailureRepository {
+	return &LoginFailureRepository{db: db}
+}
+
+// Get retrieves the failures counted against a key, returning nil if there are none
+func (r *LoginFailureRepository) Get(key string) (*models.LoginFailure, error) {
+	var failure models.LoginFailure
+	err := r.db.Where(&models.LoginFailure{Key: key}).First(&failure).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &failure, nil
+}
+
+// Fail counts a failed sign-in against the key and returns its failures. Failures older than
+// forgetBefore are forgotten first, unless a lockout is still running.
+func (r *LoginFailureRepository) Fail(key string, forgetBefore time.Time) (*models.LoginFailure, error) {
+	now := time.Now()
+	if err := r.db.Where("last_failed_at < ? AND (locked_until IS NULL OR locked_until < ?)", forgetBefore, now).
+		Delete(&models.LoginFailure{}).Error; err != nil {
+		logger.Error(err.Error())
+	}
+
+	// A single statement, so concurrent failures are all counted
+	failure := &models.LoginFailure{Key: key, Failures: 1, LastFailedAt: now}
+	err := r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"failures":       gorm.Expr("login_failures.failures + 1"),
+			"last_failed_at": now,
+		}),
+	}).Create(failure).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.db.Where(&models.LoginFailure{Key: key}).First(failure).Error; err != nil {
+		return nil, err
+	}
+	return failure, nil
+}
+
+// Lock refuses sign-ins for the key until the given time
+func (r *LoginFailureRepository) Lock(key string, until time.Time) error {
+	return r.db.Model(&models.LoginFailure{}).Where(&models.LoginFailure{Key: key}).Update("locked_until", until).Error
+}
+
+// Clear forgets the failures and lockout of the key
+func (r *LoginFailureRepository) Clear(key string) error {
+	return r.db.Where(&models.LoginFailure{Key: key}).Delete(&models.LoginFailure{}).Error
+}
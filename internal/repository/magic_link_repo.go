@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"time"
+	"veo/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// MagicLinkRepository handles database operations for sign-in links sent by email
+type MagicLinkRepository struct {
+	db *gorm.DB
+}
+
+// NewMagicLinkRepository creates a new instance of MagicLinkRepository
+func NewMagicLinkRepository(db *gorm.DB) *MagicLinkRepository {
+	return &MagicLinkRepository{db: db}
+}
+
+// Create stores a new link and purges the expired ones
+func (r *MagicLinkRepository) Create(link *models.MagicLink) error {
+	if err := r.db.Where("expires_at < ?", time.Now()).Delete(&models.MagicLink{}).Error; err != nil {
+		logger.Error(err.Error())
+	}
+	return r.db.Create(link).Error
+}
+
+// GetByHash retrieves a link by the hash of its token, returning nil if it does not exist
+func (r *MagicLinkRepository) GetByHash(tokenHash string) (*models.MagicLink, error) {
+	var link models.MagicLink
+	err := r.db.Where("token_hash = ?", tokenHash).First(&link).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &link, nil
+}
+
+// MarkUsed records the sign-in with the link. It returns false if the link was already used,
+// so a link signs in once even when opened twice at the same time.
+func (r *MagicLinkRepository) MarkUsed(id int) (bool, error) {
+	result := r.db.Model(&models.MagicLink{}).Where("id = ? AND used_at IS NULL", id).Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
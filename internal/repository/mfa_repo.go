@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"time"
+	"veo/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// MFARepository handles database operations for the second factor of users:
+// authenticator apps, recovery codes and sign-ins waiting for a code
+type MFARepository struct {
+	db *gorm.DB
+}
+
+// NewMFARepository creates a new instance of MFARepository
+func NewMFARepository(db *gorm.DB) *MFARepository {
+	return &MFARepository{db: db}
+}
+
+// GetTOTP retrieves the authenticator app of a user, returning nil if the user has none
+func (r *MFARepository) GetTOTP(userID int) (*models.TOTPCredential, error) {
+	var credential models.TOTPCredential
+	err := r.db.Where("user_id = ?", userID).First(&credential).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// CreateTOTP stores a new authenticator app, replacing an enrollment the user did not confirm
+func (r *MFARepository) CreateTOTP(credential *models.TOTPCredential) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND confirmed_at IS NULL", credential.UserID).Delete(&models.TOTPCredential{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(credential).Error
+	})
+}
+
+// ConfirmTOTP enables an authenticator app with the time step of its first code and replaces
+// the recovery codes of the user. It returns false if the app was confirmed or the step used meanwhile.
+func (r *MFARepository) ConfirmTOTP(id int, step int64, userID int, recoveryCodeHashes []string) (bool, error) {
+	confirmed := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.TOTPCredential{}).
+			Where("id = ? AND confirmed_at IS NULL AND last_used_step < ?", id, step).
+			Updates(map[string]interface{}{"confirmed_at": time.Now(), "last_used_step": step})
+		if result.Error != nil || result.RowsAffected != 1 {
+			return result.Error
+		}
+		confirmed = true
+		return replaceRecoveryCodes(tx, userID, recoveryCodeHashes)
+	})
+	return confirmed, err
+}
+
+// UseTOTPStep records the time step of an accepted code. It returns false if a code of this
+// or a later step was already accepted, so a code cannot be replayed.
+func (r *MFARepository) UseTOTPStep(id int, step int64) (bool, error) {
+	result := r.db.Model(&models.TOTPCredential{}).
+		Where("id = ? AND last_used_step < ?", id, step).
+		Update("last_used_step", step)
+	return result.RowsAffected == 1, result.Error
+}
+
+// ReplaceRecoveryCodes invalidates the recovery codes of a user and stores new ones
+func (r *MFARepository) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+// UseRecoveryCode flags a recovery code of the user as used. It returns false if the user has
+// no such code or it was already used, so two concurrent sign-ins cannot both use it.
+func (r *MFARepository) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	result := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// CountRecoveryCodes returns the number of recovery codes the user has not used yet
+func (r *MFARepository) CountRecoveryCodes(userID int) (int, error) {
+	var count int64
+	err := r.db.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return int(count), err
+}
+
+// DeleteByUser removes the authenticator app, recovery codes and pending sign-ins of a user
+func (r *MFARepository) DeleteByUser(userID int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return deleteMFA(tx, userID)
+	})
+}
+
+// CreateChallenge stores a sign-in waiting for its second factor and purges the expired ones
+func (r *MFARepository) CreateChallenge(challenge *models.MFAChallenge) error {
+	if err := r.db.Where("expires_at < ?", time.Now()).Delete(&models.MFAChallenge{}).Error; err != nil {
+		logger.Error(err.Error())
+	}
+	return r.db.Omit("User").Create(challenge).Error
+}
+
+// GetChallenge retrieves a sign-in and its user by the hash of its token, returning nil if it does not exist
+func (r *MFARepository) GetChallenge(tokenHash string) (*models.MFAChallenge, error) {
+	var challenge models.MFAChallenge
+	err := r.db.Preload("User").Where("token_hash = ?", tokenHash).First(&challenge).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// FailChallenge counts a wrong code entered for a sign-in and returns the attempts made so far.
+// The count is incremented in the database so concurrent guesses are all counted.
+func (r *MFARepository) FailChallenge(id int) (int, error) {
+	if err := r.db.Model(&models.MFAChallenge{}).Where("id = ?", id).
+		Update("attempts", gorm.Expr("attempts + 1")).Error; err != nil {
+		return 0, err
+	}
+	var challenge models.MFAChallenge
+	if err := r.db.Select("attempts").Where("id = ?", id).First(&challenge).Error; err != nil {
+		return 0, err
+	}
+	return challenge.Attempts, nil
+}
+
+// DeleteChallenge removes a sign-in once it is completed or abandoned. It returns false if it
+// was already removed, so a challenge completes only once.
+func (r *MFARepository) DeleteChallenge(id int) (bool, error) {
+	result := r.db.Delete(&models.MFAChallenge{}, id)
+	return result.RowsAffected == 1, result.Error
+}
+
+// replaceRecoveryCodes removes the recovery codes of a user and stores new ones within the transaction
+func replaceRecoveryCodes(tx *gorm.DB, userID int, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	if len(codeHashes) == 0 {
+		return nil
+	}
+	codes := make([]models.RecoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, models.RecoveryCode{UserID: userID, CodeHash: hash})
+	}
+	return tx.Create(&codes).Error
+}
+
+// deleteMFA removes every second factor record of a user within the transaction
+func deleteMFA(tx *gorm.DB, userID int) error {
+	for _, model := range []interface{}{&models.TOTPCredential{}, &models.RecoveryCode{}, &models.MFAChallenge{}} {
+		if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"veo/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// OAuthClientRepository handles database operations for OAuth clients
+type OAuthClientRepository struct {
+	db *gorm.DB
+}
+
+// NewOAuthClientRepository creates a new instance of OAuthClientRepository
+func NewOAuthClientRepository(db *gorm.DB) *OAuthClientRepository {
+	return &OAuthClientRepository{db: db}
+}
+
+// Create registers a new client
+func (r *OAuthClientRepository) Create(client *models.OAuthClient) error {
+	return r.db.Create(client).Error
+}
+
+// GetByClientID retrieves a client by its public identifier, returning nil if it does not exist
+func (r *OAuthClientRepository) GetByClientID(clientID string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	err := r.db.Where("client_id = ?", clientID).First(&client).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &client, nil
+}
+
+// List retrieves every registered client, oldest first
+func (r *OAuthClientRepository) List() ([]models.OAuthClient, error) {
+	var clients []models.OAuthClient
+	err := r.db.Order("id").Find(&clients).Error
+	return clients, err
+}
+
+// Delete removes a client, returning false if it does not exist
+func (r *OAuthClientRepository) Delete(clientID string) (bool, error) {
+	result := r.db.Where("client_id = ?", clientID).Delete(&models.OAuthClient{})
+	return result.RowsAffected == 1, result.Error
+}
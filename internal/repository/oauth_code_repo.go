@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"time"
+	"veo/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// OAuthCodeRepository handles database operations for OAuth authorization codes
+type OAuthCodeRepository struct {
+	db *gorm.DB
+}
+
+// NewOAuthCodeRepository creates a new instance of OAuthCodeRepository
+func NewOAuthCodeRepository(db *gorm.DB) *OAuthCodeRepository {
+	return &OAuthCodeRepository{db: db}
+}
+
+// Create stores a new authorization code and purges the expired ones
+func (r *OAuthCodeRepository) Create(code *models.OAuthAuthorizationCode) error {
+	if err := r.db.Where("expires_at < ?", time.Now()).Delete(&models.OAuthAuthorizationCode{}).Error; err != nil {
+		logger.Error(err.Error())
+	}
+	return r.db.Create(code).Error
+}
+
+// GetByHash retrieves an authorization code by the hash of its value, returning nil if it does not exist
+func (r *OAuthCodeRepository) GetByHash(codeHash string) (*models.OAuthAuthorizationCode, error) {
+	var code models.OAuthAuthorizationCode
+	err := r.db.Where("code_hash = ?", codeHash).First(&code).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &code, nil
+}
+
+// MarkUsed flags a code as exchanged. It returns false if the code was already used,
+// so two concurrent exchanges cannot both succeed.
+func (r *OAuthCodeRepository) MarkUsed(id int) (bool, error) {
+	result := r.db.Model(&models.OAuthAuthorizationCode{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
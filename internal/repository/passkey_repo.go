@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"strconv"
+	"time"
+	"veo/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// PasskeyRepository handles database operations for passkeys and the challenges of their ceremonies
+type PasskeyRepository struct {
+	db *gorm.DB
+}
+
+// NewPasskeyRepository creates a new instance of PasskeyRepository
+func NewPasskeyRepository(db *gorm.DB) *PasskeyRepository {
+	return &PasskeyRepository{db: db}
+}
+
+// Create stores a new passkey together with its identity
+func (r *PasskeyRepository) Create(passkey *models.Passkey) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("User").Create(passkey).Error; err != nil {
+			return err
+		}
+		identity := &models.Identity{UserID: passkey.UserID, Type: models.IdentityPasskey, Subject: strconv.Itoa(passkey.ID)}
+		return tx.Omit("User").Create(identity).Error
+	})
+}
+
+// GetByCredentialHash retrieves a passkey and its user by the hash of its credential ID, returning nil if it does not exist
+func (r *PasskeyRepository) GetByCredentialHash(credentialHash string) (*models.Passkey, error) {
+	var passkey models.Passkey
+	err := r.db.Preload("User").Where("credential_hash = ?", credentialHash).First(&passkey).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &passkey, nil
+}
+
+// ListByUser retrieves the passkeys of a user, oldest first
+func (r *PasskeyRepository) ListByUser(userID int) ([]models.Passkey, error) {
+	var passkeys []models.Passkey
+	err := r.db.Where("user_id = ?", userID).Order("created_at, id").Find(&passkeys).Error
+	return passkeys, err
+}
+
+// RecordUse stores the signature counter of a sign-in with the passkey. It returns false if another
+// sign-in changed the counter meanwhile, so two sign-ins cannot both pass with the same counter.
+func (r *PasskeyRepository) RecordUse(id int, oldSignCount, signCount uint32) (bool, error) {
+	result := r.db.Model(&models.Passkey{}).
+		Where("id = ? AND sign_count = ?", id, oldSignCount).
+		Updates(map[string]interface{}{"sign_count": signCount, "last_used_at": time.Now()})
+	return result.RowsAffected == 1, result.Error
+}
+
+// CreateChallenge stores the challenge of a ceremony and purges the expired ones
+func (r *PasskeyRepository) CreateChallenge(challenge *models.PasskeyChallenge) error {
+	if err := r.db.Where("expires_at < ?", time.Now()).Delete(&models.PasskeyChallenge{}).Error; err != nil {
+		logger.Error(err.Error())
+	}
+	return r.db.Create(challenge).Error
+}
+
+// TakeChallenge removes the challenge of a ceremony and returns it, or nil if it does not exist
+// or was already taken, so a challenge completes a single ceremony
+func (r *PasskeyRepository) TakeChallenge(challengeHash, purpose string) (*models.PasskeyChallenge, error) {
+	var challenge models.PasskeyChallenge
+	err := r.db.Where("challenge_hash = ? AND purpose = ?", challengeHash, purpose).First(&challenge).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	result := r.db.Delete(&models.PasskeyChallenge{}, challenge.ID)
+	if result.Error != nil || result.RowsAffected != 1 {
+		return nil, result.Error
+	}
+	return &challenge, nil
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"time"
+	"veo/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// PasswordResetRepository handles database operations for password reset tokens
+type PasswordResetRepository struct {
+	db *gorm.DB
+}
+
+// NewPasswordResetRepository creates a new instance of PasswordResetRepository
+func NewPasswordResetRepository(db *gorm.DB) *PasswordResetRepository {
+	return &PasswordResetRepository{db: db}
+}
+
+// Create stores a new reset token and purges the expired ones
+func (r *PasswordResetRepository) Create(reset *models.PasswordReset) error {
+	if err := r.db.Where("expires_at < ?", time.Now()).Delete(&models.PasswordReset{}).Error; err != nil {
+		logger.Error(err.Error())
+	}
+	return r.db.Create(reset).Error
+}
+
+// GetByHash retrieves a reset token by its hash, returning nil if it does not exist
+func (r *PasswordResetRepository) GetByHash(tokenHash string) (*models.PasswordReset, error) {
+	var reset models.PasswordReset
+	err := r.db.Where("token_hash = ?", tokenHash).First(&reset).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &reset, nil
+}
+
+// MarkUsed records the use of a reset token. It returns false if the token was already used,
+// so a token resets the password once even when submitted twice at the same time.
+func (r *PasswordResetRepository) MarkUsed(id int) (bool, error) {
+	result := r.db.Model(&models.PasswordReset{}).Where("id = ? AND used_at IS NULL", id).Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// DeleteUnusedByUser removes the reset tokens of a user not used yet, once its password was reset
+func (r *PasswordResetRepository) DeleteUnusedByUser(userID int) error {
+	return r.db.Where("user_id = ? AND used_at IS NULL", userID).Delete(&models.PasswordReset{}).Error
+}
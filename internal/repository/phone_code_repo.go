@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"time"
+	"veo/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// PhoneCodeRepository handles database operations for one-time codes sent by text message
+type PhoneCodeRepository struct {
+	db *gorm.DB
+}
+
+// NewPhoneCodeRepository creates a new instance of PhoneCodeRepository
+func NewPhoneCodeRepository(db *gorm.DB) *PhoneCodeRepository {
+	return &PhoneCodeRepository{db: db}
+}
+
+// Replace stores a new code for its number, replacing the previous one, and purges the expired codes
+func (r *PhoneCodeRepository) Replace(code *models.PhoneCode) error {
+	if err := r.db.Where("expires_at < ?", time.Now()).Delete(&models.PhoneCode{}).Error; err != nil {
+		logger.Error(err.Error())
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("phone = ?", code.Phone).Delete(&models.PhoneCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(code).Error
+	})
+}
+
+// GetByPhone retrieves the code sent to a number, returning nil if there is none
+func (r *PhoneCodeRepository) GetByPhone(phone string) (*models.PhoneCode, error) {
+	var code models.PhoneCode
+	err := r.db.Where("phone = ?", phone).First(&code).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &code, nil
+}
+
+// Fail records a wrong code and returns the number of wrong codes entered so far
+func (r *PhoneCodeRepository) Fail(id int) (int, error) {
+	if err := r.db.Model(&models.PhoneCode{}).Where("id = ?", id).
+		Update("attempts", gorm.Expr("attempts + 1")).Error; err != nil {
+		return 0, err
+	}
+	var code models.PhoneCode
+	if err := r.db.Select("attempts").Where("id = ?", id).First(&code).Error; err != nil {
+		return 0, err
+	}
+	return code.Attempts, nil
+}
+
+// Delete removes a code. It returns false if the code was already removed,
+// so a code signs in once even when entered twice at the same time.
+func (r *PhoneCodeRepository) Delete(id int) (bool, error) {
+	result := r.db.Delete(&models.PhoneCode{}, id)
+	return result.RowsAffected == 1, result.Error
+}
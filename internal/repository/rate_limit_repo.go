@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"time"
+	"veo/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RateLimitRepository counts requests per key in fixed windows
+type RateLimitRepository struct {
+	db *gorm.DB
+}
+
+// NewRateLimitRepository creates a new instance of RateLimitRepository
+func NewRateLimitRepository(db *gorm.DB) *RateLimitRepository {
+	return &RateLimitRepository{db: db}
+}
+
+// Hit counts a request against the key and returns the requests counted in the current window.
+// A window starts with the first request after the previous one ended.
+func (r *RateLimitRepository) Hit(key string, window time.Duration) (int, error) {
+	now := time.Now()
+	if err := r.db.Where("expires_at < ?", now).Delete(&models.RateLimit{}).Error; err != nil {
+		logger.Error(err.Error())
+	}
+
+	// A single statement, so concurrent requests are all counted
+	entry := &models.RateLimit{Key: key, Count: 1, ExpiresAt: now.Add(window)}
+	err := r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"count":      gorm.Expr("CASE WHEN rate_limits.expires_at < ? THEN 1 ELSE rate_limits.count + 1 END", now),
+			"expires_at": gorm.Expr("CASE WHEN rate_limits.expires_at < ? THEN ? ELSE rate_limits.expires_at END", now, entry.ExpiresAt),
+		}),
+	}).Create(entry).Error
+	if err != nil {
+		return 0, err
+	}
+
+	if err := r.db.Where(&models.RateLimit{Key: key}).First(entry).Error; err != nil {
+		return 0, err
+	}
+	return entry.Count, nil
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"time"
+	"veo/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// RefreshTokenRepository handles database operations for refresh tokens
+type RefreshTokenRepository struct {
+	db *gorm.DB
+}
+
+// NewRefreshTokenRepository creates a new instance of RefreshTokenRepository
+func NewRefreshTokenRepository(db *gorm.DB) *RefreshTokenRepository {
+	return &RefreshTokenRepository{db: db}
+}
+
+// Create stores a new refresh token
+func (r *RefreshTokenRepository) Create(token *models.RefreshToken) error {
+	return r.db.Create(token).Error
+}
+
+// GetByHash retrieves a refresh token by the hash of its value, returning nil if it does not exist
+func (r *RefreshTokenRepository) GetByHash(tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkRotated flags a token as exchanged. It returns false if the token was already
+// rotated or revoked, so two concurrent refreshes cannot both succeed.
+func (r *RefreshTokenRepository) MarkRotated(id int) (bool, error) {
+	result := r.db.Model(&models.RefreshToken{}).
+		Where("id = ? AND rotated_at IS NULL AND revoked_at IS NULL", id).
+		Update("rotated_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// RevokeFamily revokes every token rotated from the same login
+func (r *RefreshTokenRepository) RevokeFamily(familyID string) error {
+	return r.db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeSession revokes every refresh token issued for a login session
+func (r *RefreshTokenRepository) RevokeSession(sessionID int) error {
+	return r.db.Model(&models.RefreshToken{}).
+		Where("session_id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"time"
+	"veo/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RevokedTokenRepository is a database backed token denylist, shared by every instance
+type RevokedTokenRepository struct {
+	db *gorm.DB
+}
+
+// NewRevokedTokenRepository creates a new instance of RevokedTokenRepository
+func NewRevokedTokenRepository(db *gorm.DB) *RevokedTokenRepository {
+	return &RevokedTokenRepository{db: db}
+}
+
+// Revoke adds a token to the denylist and purges entries whose tokens have expired
+func (r *RevokedTokenRepository) Revoke(jti string, expiresAt time.Time) error {
+	if err := r.db.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{}).Error; err != nil {
+		logger.Error(err.Error())
+	}
+
+	token := &models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(token).Error
+}
+
+// IsRevoked reports whether a token is on the denylist and has not expired yet
+func (r *RevokedTokenRepository) IsRevoked(jti string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.RevokedToken{}).
+		Where("jti = ? AND expires_at >= ?", jti, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
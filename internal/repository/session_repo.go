@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"time"
+	"veo/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// SessionRepository handles database operations for login sessions
+type SessionRepository struct {
+	db *gorm.DB
+}
+
+// NewSessionRepository creates a new instance of SessionRepository
+func NewSessionRepository(db *gorm.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// Create stores a new session
+func (r *SessionRepository) Create(session *models.Session) error {
+	return r.db.Omit("User").Create(session).Error
+}
+
+// GetByID retrieves a session and its owner by ID, returning nil if it does not exist
+func (r *SessionRepository) GetByID(id int) (*models.Session, error) {
+	return r.first(r.db.Where("id = ?", id))
+}
+
+// GetByTokenHash retrieves a session and its owner by the hash of its token, returning nil if it does not exist
+func (r *SessionRepository) GetByTokenHash(tokenHash string) (*models.Session, error) {
+	return r.first(r.db.Where("token_hash = ?", tokenHash))
+}
+
+// ListActiveByUser retrieves the sessions of a user that are unexpired and were not
+// invalidated by a token version change, oldest first
+func (r *SessionRepository) ListActiveByUser(userID int) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.
+		Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Where("token_version = (?)", r.db.Model(&models.User{}).Select("token_version").Where("id = ?", userID)).
+		Order("created_at, id").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// SetToken replaces the opaque token of a session and its expiry
+func (r *SessionRepository) SetToken(id int, tokenHash string, expiresAt time.Time) error {
+	return r.db.Model(&models.Session{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"token_hash": tokenHash,
+		"expires_at": expiresAt,
+	}).Error
+}
+
+// Touch records activity on a session and sets its expiry
+func (r *SessionRepository) Touch(id int, lastSeenAt, expiresAt time.Time) error {
+	return r.db.Model(&models.Session{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"last_seen_at": lastSeenAt,
+		"expires_at":   expiresAt,
+	}).Error
+}
+
+// SetAuthenticatedAt records that the user of a session proved who they are again
+func (r *SessionRepository) SetAuthenticatedAt(id int, authenticatedAt time.Time) error {
+	return r.db.Model(&models.Session{}).Where("id = ?", id).Update("authenticated_at", authenticatedAt).Error
+}
+
+// Delete removes a session
+func (r *SessionRepository) Delete(id int) error {
+	return r.db.Delete(&models.Session{}, id).Error
+}
+
+// DeleteInactiveByUser removes the expired sessions of a user and those invalidated by a token version change
+func (r *SessionRepository) DeleteInactiveByUser(userID int) error {
+	return r.db.
+		Where("user_id = ?", userID).
+		Where("expires_at <= ? OR token_version <> (?)", time.Now(), r.db.Model(&models.User{}).Select("token_version").Where("id = ?", userID)).
+		Delete(&models.Session{}).Error
+}
+
+// DeleteExpiredClientSessions removes the expired client credentials sessions of an OAuth client
+func (r *SessionRepository) DeleteExpiredClientSessions(clientID string) error {
+	return r.db.
+		Where("user_id = 0 AND client_id = ? AND expires_at <= ?", clientID, time.Now()).
+		Delete(&models.Session{}).Error
+}
+
+// ListByClient retrieves every session granted to an OAuth client
+func (r *SessionRepository) ListByClient(clientID string) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.Where("client_id = ?", clientID).Find(&sessions).Error
+	return sessions, err
+}
+
+// first runs the query and preloads the owner of the session
+func (r *SessionRepository) first(query *gorm.DB) (*models.Session, error) {
+	var session models.Session
+	err := query.Preload("User").First(&session).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &session, nil
+}
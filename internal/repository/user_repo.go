@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"strconv"
+	"time"
 	"veo/internal/models"
 	"veo/internal/utils"
 	"veo/pkg/errors"
@@ -30,7 +32,28 @@ func (r *UserRepository) CreateUser(user *models.User) error {
 		return err
 	}
 
-	if err := r.db.Create(user).Error; err != nil {
+	// Users registering with a password, a verified email address or a phone number get its identity,
+	// users of identity providers get theirs when linked
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		if user.Password != "" {
+			if err := tx.Create(passwordIdentity(user.ID)).Error; err != nil {
+				return err
+			}
+		}
+		if user.Email != nil {
+			if err := tx.Create(emailIdentity(user.ID, *user.Email)).Error; err != nil {
+				return err
+			}
+		}
+		if user.Phone != nil {
+			return tx.Create(&models.Identity{UserID: user.ID, Type: models.IdentityPhone, Subject: *user.Phone}).Error
+		}
+		return nil
+	})
+	if err != nil {
 		logger.Error(err.Error())
 		return err
 	}
@@ -64,12 +87,187 @@ func (r *UserRepository) GetUserByUsername(username string) (*models.User, error
 	return user, nil
 }
 
-// UpdatePassword updates a user's password
+// GetUserByEmail retrieves a user by its verified email address
+func (r *UserRepository) GetUserByEmail(email string) (*models.User, error) {
+	var user models.User
+	err := r.db.Where("email = ?", email).First(&user).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, NewUserNotFound("User not found")
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdatePassword updates a user's password and invalidates every token issued with the old one.
+// A password change asked for by an admin is done.
 func (r *UserRepository) UpdatePassword(userID int, hashedPassword string) error {
-	return r.db.Model(&models.User{}).Where("id = ?", userID).Update("password", hashedPassword).Error
+	return r.db.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"password":             hashedPassword,
+		"token_version":        gorm.Expr("token_version + 1"),
+		"password_changed_at":  time.Now(),
+		"must_change_password": false,
+	}).Error
+}
+
+// ReplacePasswordHash replaces the hash of the password of a user by a new hash of the same password.
+// It returns false if the password was changed since oldHash was read. Tokens stay valid, the password is the same.
+func (r *UserRepository) ReplacePasswordHash(userID int, oldHash, newHash string) (bool, error) {
+	result := r.db.Model(&models.User{}).Where("id = ? AND password = ?", userID, oldHash).Update("password", newHash)
+	return result.RowsAffected == 1, result.Error
 }
 
-// DeleteUser removes a user from the database
+// SetPassword sets the password of a user who has none, linking its identity
+func (r *UserRepository) SetPassword(userID int, hashedPassword string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"password":             hashedPassword,
+			"password_changed_at":  time.Now(),
+			"must_change_password": false,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(passwordIdentity(userID)).Error
+	})
+}
+
+// SetPendingEmail stores the address a user wants to use until its verification link is opened
+func (r *UserRepository) SetPendingEmail(userID int, email string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).Update("pending_email", email).Error
+}
+
+// ConfirmEmail makes the pending address of a user its verified address, and moves its email identity
+// to the address. It returns false if the address is no longer the pending one, so a verification link
+// cannot bring back an address replaced since.
+func (r *UserRepository) ConfirmEmail(userID int, email string, verifiedAt time.Time) (bool, error) {
+	confirmed := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var taken int64
+		if err := tx.Model(&models.User{}).Where("email = ? AND id <> ?", email, userID).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return errors.NewUserExists("The email address belongs to another account")
+		}
+
+		result := tx.Model(&models.User{}).Where("id = ? AND pending_email = ?", userID, email).
+			Updates(map[string]interface{}{"email": email, "email_verified_at": verifiedAt, "pending_email": ""})
+		if result.Error != nil || result.RowsAffected != 1 {
+			return result.Error
+		}
+		confirmed = true
+
+		if err := tx.Where("user_id = ? AND type = ?", userID, models.IdentityEmail).Delete(&models.Identity{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(emailIdentity(userID, email)).Error
+	})
+	if err != nil {
+		return false, err
+	}
+	return confirmed, nil
+}
+
+// SetPhoneVerified records that a code sent to the phone number of a user was entered
+func (r *UserRepository) SetPhoneVerified(userID int, verifiedAt time.Time) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).Update("phone_verified_at", verifiedAt).Error
+}
+
+// SetMustChangePassword sets or clears the flag limiting the sign-ins of a user to changing its password.
+// Setting it invalidates every token issued so far, so the user signs in again and meets the limit.
+func (r *UserRepository) SetMustChangePassword(userID int, mustChange bool) error {
+	updates := map[string]interface{}{"must_change_password": mustChange}
+	if mustChange {
+		updates["token_version"] = gorm.Expr("token_version + 1")
+	}
+	result := r.db.Model(&models.User{}).Where("id = ?", userID).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NewUserNotFound("User not found")
+	}
+	return nil
+}
+
+// PasswordHistory returns the hashes of the last passwords the user set, newest first
+func (r *UserRepository) PasswordHistory(userID, limit int) ([]models.PasswordHistory, error) {
+	var history []models.PasswordHistory
+	err := r.db.Where("user_id = ?", userID).Order("id DESC").Limit(limit).Find(&history).Error
+	return history, err
+}
+
+// AddPasswordHistory records a password the user set, and forgets those older than the keep newest
+func (r *UserRepository) AddPasswordHistory(userID int, hashedPassword string, keep int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&models.PasswordHistory{UserID: userID, Password: hashedPassword}).Error; err != nil {
+			return err
+		}
+		var kept []int
+		if err := tx.Model(&models.PasswordHistory{}).Where("user_id = ?", userID).Order("id DESC").Limit(keep).Pluck("id", &kept).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ? AND id NOT IN ?", userID, kept).Delete(&models.PasswordHistory{}).Error
+	})
+}
+
+// IncrementTokenVersion invalidates every token issued to a user so far
+func (r *UserRepository) IncrementTokenVersion(userID int) error {
+	result := r.db.Model(&models.User{}).Where("id = ?", userID).Update("token_version", gorm.Expr("token_version + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NewUserNotFound("User not found")
+	}
+	return nil
+}
+
+// SignOutEverywhere invalidates every token issued to a user so far and revokes the API keys of the user
+func (r *UserRepository) SignOutEverywhere(userID int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := (&UserRepository{db: tx}).IncrementTokenVersion(userID); err != nil {
+			return err
+		}
+		return revokeAPIKeys(tx, userID)
+	})
+}
+
+// RevokeAPIKeys revokes every API key of a user
+func (r *UserRepository) RevokeAPIKeys(userID int) error {
+	return revokeAPIKeys(r.db, userID)
+}
+
+// DeleteUser removes a user from the database, along with the external identities signing in as the user
 func (r *UserRepository) DeleteUser(id int) error {
-	return r.db.Delete(&models.User{}, id).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", id).Delete(&models.Identity{}).Error; err != nil {
+			return err
+		}
+		if err := deleteMFA(tx, id); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&models.Passkey{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&models.PasswordReset{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&models.PasswordHistory{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.User{}, id).Error
+	})
+}
+
+// emailIdentity returns the identity signing a user in with links sent to its verified address
+func emailIdentity(userID int, email string) *models.Identity {
+	return &models.Identity{UserID: userID, Type: models.IdentityEmail, Subject: email, Email: email}
+}
+
+// passwordIdentity returns the identity recording that the user has a password
+func passwordIdentity(userID int) *models.Identity {
+	return &models.Identity{UserID: userID, Type: models.IdentityPassword, Subject: strconv.Itoa(userID)}
 }
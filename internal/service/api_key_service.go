@@ -0,0 +1,120 @@
+package service
+
+import (
+	"strings"
+	"time"
+	"veo/internal/models"
+	"veo/internal/repository"
+	"veo/internal/utils"
+	"veo/pkg/errors"
+)
+
+// Limits on the API keys created by users
+const (
+	maxAPIKeyNameLength = 100
+	apiKeyPrefixLength  = len(models.APIKeyPrefix) + 8
+)
+
+// APIKeyService handles the API keys users create for scripts and CI jobs
+type APIKeyService struct {
+	apiKeyRepo *repository.APIKeyRepository
+}
+
+// NewAPIKeyService creates a new instance of APIKeyService
+func NewAPIKeyService(apiKeyRepo *repository.APIKeyRepository) APIKeyService {
+	return APIKeyService{apiKeyRepo: apiKeyRepo}
+}
+
+// Create generates a named API key for the user, limited to the given scopes and, optionally, until expiresAt.
+// It returns the stored key and its plain value, which cannot be retrieved again.
+func (s *APIKeyService) Create(userID int, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxAPIKeyNameLength {
+		return nil, "", errors.NewInvalidParams("API key name must be between 1 and 100 characters")
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", errors.NewInvalidParams("API key expiry must be in the future")
+	}
+
+	granted, err := validateScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	secret, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, "", NewError(CodeError, "Failed to generate API key")
+	}
+	plain := models.APIKeyPrefix + secret
+
+	key := &models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    plain[:apiKeyPrefixLength],
+		KeyHash:   utils.HashToken(plain),
+		Scopes:    strings.Join(granted, " "),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.apiKeyRepo.Create(key); err != nil {
+		return nil, "", err
+	}
+	return key, plain, nil
+}
+
+// List returns the API keys of the user that were not revoked, newest first
+func (s *APIKeyService) List(userID int) ([]models.APIKey, error) {
+	return s.apiKeyRepo.ListByUser(userID)
+}
+
+// Revoke revokes an API key of the user, it stops working immediately
+func (s *APIKeyService) Revoke(userID, id int) error {
+	revoked, err := s.apiKeyRepo.Revoke(userID, id)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return errors.NewInvalidParams("API key does not exist")
+	}
+	return nil
+}
+
+// RevokeKey revokes an API key given its plain value, for instance after it leaked.
+// Unknown and already revoked keys are ignored.
+func (s *APIKeyService) RevokeKey(key string) error {
+	revoked, err := s.apiKeyRepo.RevokeByHash(utils.HashToken(key))
+	if err != nil {
+		return err
+	}
+	if revoked {
+		logger.Warnf("API key %s revoked by its value", key[:min(len(key), apiKeyPrefixLength)])
+	}
+	return nil
+}
+
+// validateScopes checks that every requested scope may be granted to an API key and removes duplicates
+func validateScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, errors.NewInvalidParams("API key needs at least one scope")
+	}
+
+	granted := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !contains(models.APIKeyScopes, scope) {
+			return nil, errors.NewInvalidParams("Scope " + scope + " cannot be granted to an API key")
+		}
+		if !contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	return granted, nil
+}
+
+// contains reports whether value is in values
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
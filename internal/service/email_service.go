@@ -0,0 +1,167 @@
+package service
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"veo/internal/configs"
+	"veo/internal/models"
+	"veo/internal/repository"
+	"veo/internal/utils"
+	"veo/pkg/errors"
+)
+
+// defaultEmailVerifyTTL is the lifetime of a verification link when none is configured
+const defaultEmailVerifyTTL = 24 * time.Hour
+
+// Limit on verification mails, so an account cannot be used to flood an address
+const (
+	verificationMailsPerUser = 3
+	verificationMailWindow   = time.Hour
+)
+
+// emailVerifyPurpose tells verification tokens apart from other tokens signed with the same secret
+const emailVerifyPurpose = "verify-email"
+
+// EmailService manages the email addresses of users: an address is only used once its owner
+// opened the verification link sent to it
+type EmailService struct {
+	userRepo    *repository.UserRepository
+	rateLimiter RateLimiter
+	mailer      Mailer
+	cfg         configs.EmailConfig
+	secret      []byte
+}
+
+// NewEmailService creates a new instance of EmailService. secret signs the verification links and must be shared by every instance.
+func NewEmailService(userRepo *repository.UserRepository, rateLimiter RateLimiter, mailer Mailer, cfg configs.EmailConfig, secret []byte) EmailService {
+	if cfg.VerifyTTL <= 0 {
+		cfg.VerifyTTL = defaultEmailVerifyTTL
+	}
+	return EmailService{userRepo: userRepo, rateLimiter: rateLimiter, mailer: mailer, cfg: cfg, secret: secret}
+}
+
+// Required tells whether users must register with an address and verify it before signing in with their password
+func (s *EmailService) Required() bool {
+	return s.cfg.RequireVerified
+}
+
+// Normalize returns the lower case form of an email address
+func (s *EmailService) Normalize(email string) (string, error) {
+	address, ok := utils.NormalizeEmail(email)
+	if !ok {
+		return "", errors.NewInvalidParams("Invalid email address")
+	}
+	return address, nil
+}
+
+// ChangeEmail sends a verification link to the new address of the user. The current address, if any,
+// stays in use until the link is opened, and is told about the change so its owner can react.
+func (s *EmailService) ChangeEmail(user *models.User, email string) error {
+	address, err := s.Normalize(email)
+	if err != nil {
+		return err
+	}
+	if user.Email != nil && *user.Email == address {
+		return errors.NewInvalidParams("This is already the email address of the account")
+	}
+
+	if err := s.userRepo.SetPendingEmail(user.ID, address); err != nil {
+		return err
+	}
+	user.PendingEmail = address
+	if err := s.SendVerification(user); err != nil {
+		return err
+	}
+
+	if user.Email != nil {
+		notice := &Mail{
+			To:      *user.Email,
+			Subject: "Your email address is being changed",
+			Body: fmt.Sprintf("Someone asked to change the email address of the account %s to %s.\n\n"+
+				"If it was you, open the link sent to the new address. If not, sign in and change your password: "+
+				"this address stays in use until the new one is verified.\n", user.Username, address),
+		}
+		if err := s.mailer.Send(notice); err != nil {
+			logger.Errorf("failed to tell user %d about the change of its email address: %v", user.ID, err)
+		}
+	}
+	logger.Infof("user %d asked to change its email address", user.ID)
+	return nil
+}
+
+// SendVerification mails a new verification link for the pending address of the user
+func (s *EmailService) SendVerification(user *models.User) error {
+	if user.PendingEmail == "" {
+		return errors.NewInvalidParams("No email address is waiting to be verified")
+	}
+	if err := s.rateLimiter.Allow("verify:user:"+strconv.Itoa(user.ID), verificationMailsPerUser, verificationMailWindow); err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(s.cfg.VerifyTTL)
+	claims := fmt.Sprintf("%s:%d:%d:%s", emailVerifyPurpose, user.ID, expiresAt.Unix(), user.PendingEmail)
+	token := utils.SignToken(s.secret, base64.RawURLEncoding.EncodeToString([]byte(claims)))
+
+	return s.mailer.Send(&Mail{
+		To:      user.PendingEmail,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Open this link to verify the email address of the account %s:\n\n%s\n\nIt expires in %s. If you did not use this address, ignore this mail.\n",
+			user.Username, linkURL(s.cfg.VerifyURL, token), s.cfg.VerifyTTL),
+	})
+}
+
+// Verify checks the token of a verification link and makes the address it was sent to the address of its user.
+// A link only verifies the address still pending, and only once.
+func (s *EmailService) Verify(token string) (*models.User, error) {
+	payload, ok := utils.VerifySignedToken(s.secret, token)
+	if !ok {
+		return nil, invalidVerificationLink()
+	}
+	claims, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, invalidVerificationLink()
+	}
+	parts := strings.SplitN(string(claims), ":", 4)
+	if len(parts) != 4 || parts[0] != emailVerifyPurpose {
+		return nil, invalidVerificationLink()
+	}
+	userID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, invalidVerificationLink()
+	}
+	expiresAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return nil, invalidVerificationLink()
+	}
+
+	confirmed, err := s.userRepo.ConfirmEmail(userID, parts[3], time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !confirmed {
+		return nil, invalidVerificationLink()
+	}
+
+	logger.Infof("user %d verified its email address", userID)
+	return s.userRepo.GetUserByID(userID)
+}
+
+// CheckVerified returns an EmailNotVerified error when verification is required and the user registered
+// an address it did not verify yet. A new link is sent along, unless too many were sent already.
+func (s *EmailService) CheckVerified(user *models.User) error {
+	if !s.cfg.RequireVerified || user.Email != nil || user.PendingEmail == "" {
+		return nil
+	}
+	if err := s.SendVerification(user); err != nil {
+		return errors.NewEmailNotVerified("Please open the link sent to your email address before signing in")
+	}
+	return errors.NewEmailNotVerified("Please verify your email address before signing in, a new link was sent")
+}
+
+// invalidVerificationLink is returned for every verification link that does not verify, whatever the reason
+func invalidVerificationLink() error {
+	return errors.NewAuthFailed("Invalid or expired verification link")
+}
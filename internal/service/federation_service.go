@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"veo/internal/models"
+	"veo/internal/repository"
+	"veo/internal/utils"
+	"veo/pkg/errors"
+)
+
+// FederationRequestTTL bounds the time a user may spend at the identity provider before coming back
+const FederationRequestTTL = 10 * time.Minute
+
+// Usernames given to users created on their first sign-in without a password
+const (
+	maxFederatedUsernameLength = 64
+	maxUsernameAttempts        = 5
+)
+
+// FederationRequest holds the secrets of a sign-in at an identity provider.
+// The browser keeps them until the provider sends the user back.
+type FederationRequest struct {
+	State        string // Echoed by the provider, ties the callback to the browser that started the sign-in
+	Nonce        string // Embedded in the ID token, ties the token to this sign-in
+	CodeVerifier string // PKCE verifier of the authorization code
+	LinkSession  int    // Session of the signed in user linking the identity, 0 to sign in with it
+	LinkProof    string // Signature binding LinkSession to State, so the request cannot be moved to another session
+}
+
+// FederationService signs users in with external identity providers
+type FederationService struct {
+	providers    map[string]IdentityProvider
+	identityRepo *repository.IdentityRepository
+	userRepo     *repository.UserRepository
+	secret       []byte // Signs the session of linking requests
+}
+
+// NewFederationService creates a new instance of FederationService with the providers users can sign in with, by name.
+// secret signs the session linking requests were started in, it must be the same on every instance.
+func NewFederationService(providers map[string]IdentityProvider, identityRepo *repository.IdentityRepository, userRepo *repository.UserRepository, secret []byte) FederationService {
+	return FederationService{providers: providers, identityRepo: identityRepo, userRepo: userRepo, secret: secret}
+}
+
+// Providers returns the names of the identity providers, sorted
+func (s *FederationService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Begin starts a sign-in with an identity provider. It returns the secrets the browser must keep
+// and the URL to send the user to. linkSession is the session of the user linking the identity, 0 to sign in with it.
+func (s *FederationService) Begin(ctx context.Context, provider string, linkSession int) (*FederationRequest, string, error) {
+	idp, err := s.provider(provider)
+	if err != nil {
+		return nil, "", err
+	}
+
+	request := &FederationRequest{LinkSession: linkSession}
+	for _, secret := range []*string{&request.State, &request.Nonce, &request.CodeVerifier} {
+		if *secret, err = utils.RandomToken(32); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if linkSession != 0 {
+		request.LinkProof = s.linkProof(request.State, linkSession)
+	}
+
+	authorizationURL, err := idp.AuthorizationURL(ctx, request.State, request.Nonce, codeChallengeS256(request.CodeVerifier))
+	if err != nil {
+		return nil, "", err
+	}
+	return request, authorizationURL, nil
+}
+
+// Complete finishes a sign-in when the provider sends the user back with a state and an authorization code.
+// request is the one Begin returned to this browser. The user is created on the first sign-in of an identity.
+func (s *FederationService) Complete(ctx context.Context, provider string, request *FederationRequest, state, code string) (*models.User, error) {
+	external, err := s.exchange(ctx, provider, request, state, code)
+	if err != nil {
+		return nil, err
+	}
+	return s.signIn(provider, external)
+}
+
+// CheckLink returns an error unless the request was started by Begin to link an identity to the user of its LinkSession
+func (s *FederationService) CheckLink(request *FederationRequest) error {
+	if request == nil || request.LinkSession == 0 ||
+		subtle.ConstantTimeCompare([]byte(request.LinkProof), []byte(s.linkProof(request.State, request.LinkSession))) != 1 {
+		return errors.NewAuthFailed("Linking expired or was started in another browser")
+	}
+	return nil
+}
+
+// Link finishes a sign-in started to link the identity at the provider to the user, who is already signed in.
+// An identity already signing in as another user is not moved, that account would lose a way to sign in.
+func (s *FederationService) Link(ctx context.Context, provider string, request *FederationRequest, state, code string, userID int) (*models.Identity, error) {
+	if err := s.CheckLink(request); err != nil {
+		return nil, err
+	}
+	external, err := s.exchange(ctx, provider, request, state, code)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := s.identityRepo.GetBySubject(models.IdentityOIDC, provider, external.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		if identity.UserID != userID {
+			return nil, errors.NewUserExists("The identity already signs in to another account")
+		}
+		return identity, nil
+	}
+
+	identity = &models.Identity{UserID: userID, Type: models.IdentityOIDC, Provider: provider, Subject: external.Subject, Email: external.Email}
+	if err := s.identityRepo.Create(identity); err != nil {
+		return nil, err
+	}
+	logger.Infof("linked %s identity %s to user %d", provider, external.Subject, userID)
+	return identity, nil
+}
+
+// linkProof signs the state of a linking request together with the session it was started in
+func (s *FederationService) linkProof(state string, linkSession int) string {
+	signed := utils.SignToken(s.secret, state+"."+strconv.Itoa(linkSession))
+	return signed[strings.LastIndexByte(signed, '.')+1:]
+}
+
+// exchange checks the state returned by the provider against the request and redeems the authorization code
+func (s *FederationService) exchange(ctx context.Context, provider string, request *FederationRequest, state, code string) (*ExternalIdentity, error) {
+	idp, err := s.provider(provider)
+	if err != nil {
+		return nil, err
+	}
+	if request == nil || request.State == "" || subtle.ConstantTimeCompare([]byte(state), []byte(request.State)) != 1 {
+		return nil, errors.NewAuthFailed("Sign-in expired or was started in another browser")
+	}
+	if code == "" {
+		return nil, errors.NewInvalidParams("Missing authorization code")
+	}
+	return idp.Exchange(ctx, code, request.CodeVerifier, request.Nonce)
+}
+
+// signIn returns the user the identity signs in as, creating both on the first sign-in.
+// Identities are never matched to existing users by email, the address may not belong to the same person.
+func (s *FederationService) signIn(provider string, external *ExternalIdentity) (*models.User, error) {
+	identity, err := s.identityRepo.GetBySubject(models.IdentityOIDC, provider, external.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if identity != nil {
+		if err := s.identityRepo.Touch(identity.ID, now); err != nil {
+			return nil, err
+		}
+		return &identity.User, nil
+	}
+
+	user := &models.User{Username: federatedUsername(provider, external)}
+	if err := createUser(s.userRepo, user); err != nil {
+		return nil, err
+	}
+	identity = &models.Identity{UserID: user.ID, Type: models.IdentityOIDC, Provider: provider, Subject: external.Subject, Email: external.Email, LastLoginAt: &now}
+	if err := s.identityRepo.Create(identity); err != nil {
+		// Most likely a concurrent first sign-in of the same identity, which created its own user
+		if deleteErr := s.userRepo.DeleteUser(user.ID); deleteErr != nil {
+			logger.Errorf("failed to delete user %d after linking %s identity failed: %v", user.ID, provider, deleteErr)
+		}
+		return nil, err
+	}
+
+	logger.Infof("created user %d for %s identity %s", user.ID, provider, external.Subject)
+	return user, nil
+}
+
+// provider returns the identity provider with the given name
+func (s *FederationService) provider(name string) (IdentityProvider, error) {
+	idp, ok := s.providers[name]
+	if !ok {
+		return nil, errors.NewInvalidParams("Unknown identity provider")
+	}
+	return idp, nil
+}
+
+// federatedUsername derives a username from the preferred username or the email address of the identity
+func federatedUsername(provider string, external *ExternalIdentity) string {
+	candidate := external.PreferredUsername
+	if candidate == "" {
+		candidate, _, _ = strings.Cut(external.Email, "@")
+	}
+	return usernameFrom(candidate, provider+"-user")
+}
+
+// usernameFrom keeps the characters of the candidate allowed in usernames, returning fallback if none is left
+func usernameFrom(candidate, fallback string) string {
+	var b strings.Builder
+	for _, r := range candidate {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || strings.ContainsRune("._-", r) {
+			b.WriteRune(r)
+		}
+	}
+	username := truncate(b.String(), maxFederatedUsernameLength)
+	if username == "" {
+		return fallback
+	}
+	return username
+}
+
+// createUser creates a user without password for a sign-in other than a password, picking a free username
+// from the username of the user
+func createUser(userRepo *repository.UserRepository, user *models.User) error {
+	base := user.Username
+	for attempt := 1; ; attempt++ {
+		user.Username = base
+		if attempt == maxUsernameAttempts {
+			suffix, err := utils.RandomToken(6)
+			if err != nil {
+				return err
+			}
+			user.Username = fmt.Sprintf("%s-%s", base, suffix)
+		} else if attempt > 1 {
+			user.Username = fmt.Sprintf("%s-%d", base, attempt)
+		}
+
+		err := userRepo.CreateUser(user)
+		if e, ok := err.(*errors.Error); ok && e.Code == errors.CodeUserExists && attempt < maxUsernameAttempts {
+			continue
+		}
+		return err
+	}
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"veo/internal/models"
+	"veo/internal/repository"
+	"veo/pkg/errors"
+)
+
+// IdentityService manages the ways users sign in
+type IdentityService struct {
+	identityRepo *repository.IdentityRepository
+	userRepo     *repository.UserRepository
+}
+
+// NewIdentityService creates a new instance of IdentityService
+func NewIdentityService(identityRepo *repository.IdentityRepository, userRepo *repository.UserRepository) IdentityService {
+	return IdentityService{identityRepo: identityRepo, userRepo: userRepo}
+}
+
+// List returns the identities of the user, oldest first
+func (s *IdentityService) List(userID int) ([]models.Identity, error) {
+	return s.identityRepo.ListByUser(userID)
+}
+
+// SetPassword lets a user who signs in with an identity provider only also sign in with a password
+func (s *IdentityService) SetPassword(userID int, password string) error {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.Password != "" {
+		return errors.NewInvalidParams("A password is already set, change it instead")
+	}
+	if err := passwordPolicy.Check("password", password, user.Username); err != nil {
+		return err
+	}
+	if err := checkPasswordReuse(s.userRepo, user, "password", password); err != nil {
+		return err
+	}
+
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.SetPassword(userID, hashedPassword); err != nil {
+		return err
+	}
+	recordPassword(s.userRepo, userID, hashedPassword)
+	return nil
+}
+
+// Unlink removes an identity of the user, who keeps signing in with the others.
+// The last identity of a user cannot be removed.
+func (s *IdentityService) Unlink(userID, identityID int) error {
+	identity, err := s.identityRepo.Delete(userID, identityID)
+	if err != nil {
+		return err
+	}
+	if identity == nil {
+		return errors.NewInvalidParams("Identity does not exist")
+	}
+
+	logger.Infof("unlinked %s identity %d from user %d", identity.Type, identity.ID, userID)
+	return nil
+}
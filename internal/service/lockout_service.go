@@ -0,0 +1,189 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"veo/internal/configs"
+	"veo/internal/models"
+	"veo/internal/repository"
+	"veo/pkg/errors"
+)
+
+// Defaults of the lockout settings left empty in the configuration
+const (
+	defaultBackoffAfter  = 3
+	defaultMaxDelay      = time.Minute
+	defaultMaxFailures   = 10
+	defaultIPMaxFailures = 50
+	defaultLockout       = 15 * time.Minute
+	defaultLockoutReset  = time.Hour
+)
+
+// LockoutService slows down and then stops password and second factor guessing. Failed sign-ins are counted
+// per username and per IP: past a threshold each attempt must wait twice as long as the previous one,
+// and past a higher one the username or IP is locked out for a while.
+type LockoutService struct {
+	loginFailureRepo *repository.LoginFailureRepository
+	cfg              configs.LockoutConfig
+}
+
+// NewLockoutService creates a new instance of LockoutService
+func NewLockoutService(loginFailureRepo *repository.LoginFailureRepository, cfg configs.LockoutConfig) LockoutService {
+	if cfg.BackoffAfter <= 0 {
+		cfg.BackoffAfter = defaultBackoffAfter
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = defaultMaxDelay
+	}
+	if cfg.MaxFailures <= 0 {
+		cfg.MaxFailures = defaultMaxFailures
+	}
+	if cfg.IPMaxFailures <= 0 {
+		cfg.IPMaxFailures = defaultIPMaxFailures
+	}
+	if cfg.Duration <= 0 {
+		cfg.Duration = defaultLockout
+	}
+	if cfg.ResetAfter <= 0 {
+		cfg.ResetAfter = defaultLockoutReset
+	}
+	return LockoutService{loginFailureRepo: loginFailureRepo, cfg: cfg}
+}
+
+// Attempt runs a password check for the username from the IP, unless either must still wait or is
+// locked out, and counts its outcome. Only wrong passwords and unknown usernames count as failures,
+// so unknown usernames are throttled like existing ones and tell nothing apart.
+func (s *LockoutService) Attempt(username, ip string, check func() error) error {
+	if err := s.AttemptFirstFactor(username, ip, check); err != nil {
+		return err
+	}
+	return s.Succeed(username)
+}
+
+// AttemptFirstFactor is Attempt for the password step of a sign-in that may still ask for a second factor:
+// failures count the same, but a correct password forgets none of them. The caller calls Succeed once
+// the whole sign-in is done, or the second factor could be guessed on by entering the password again.
+func (s *LockoutService) AttemptFirstFactor(username, ip string, check func() error) error {
+	if err := s.Check(username, ip); err != nil {
+		return err
+	}
+
+	err := check()
+	if err == nil {
+		return nil
+	}
+	if e, ok := err.(*errors.Error); ok && (e.Code == errors.CodeAuthFailed || e.Code == errors.CodeUserNotFound) {
+		if failErr := s.Fail(username, ip); failErr != nil {
+			logger.Errorf("failed to count a failed sign-in: %v", failErr)
+		}
+	}
+	return err
+}
+
+// Check returns a TooManyRequests error while the username or the IP must wait before the next attempt
+// or the IP is blocked, and an AccountLocked error while the username is locked out
+func (s *LockoutService) Check(username, ip string) error {
+	if err := s.check(ipKey(ip), errors.NewTooManyRequests); err != nil {
+		return err
+	}
+	if username == "" {
+		return nil
+	}
+	return s.check(userKey(username), errors.NewAccountLocked)
+}
+
+// Fail counts a failed sign-in against the username and the IP
+func (s *LockoutService) Fail(username, ip string) error {
+	if err := s.fail(ipKey(ip), s.cfg.IPMaxFailures); err != nil {
+		return err
+	}
+	if username == "" {
+		return nil
+	}
+	return s.fail(userKey(username), s.cfg.MaxFailures)
+}
+
+// Succeed forgets the failures of the username after a successful sign-in. Failures from the IP are
+// kept, or signing in to an account of one's own would clear the guesses made at others.
+func (s *LockoutService) Succeed(username string) error {
+	return s.loginFailureRepo.Clear(userKey(username))
+}
+
+// Unlock ends the lockout of the username and forgets its failures
+func (s *LockoutService) Unlock(username string) error {
+	return s.loginFailureRepo.Clear(userKey(username))
+}
+
+// check refuses attempts for the key while it is locked out or must wait, locked builds the error of a lockout
+func (s *LockoutService) check(key string, locked func(string) error) error {
+	failure, err := s.loginFailureRepo.Get(key)
+	if err != nil {
+		return err
+	}
+	if failure == nil {
+		return nil
+	}
+
+	now := time.Now()
+	if isLocked(failure, now) {
+		return locked(fmt.Sprintf("Too many failed sign-ins, try again in %s", failure.LockedUntil.Sub(now).Round(time.Second)))
+	}
+	if next := failure.LastFailedAt.Add(s.delay(failure.Failures)); now.Before(next) {
+		return errors.NewTooManyRequests(fmt.Sprintf("Too many failed sign-ins, try again in %s", next.Sub(now).Round(time.Second)))
+	}
+	return nil
+}
+
+// fail counts a failure against the key, and locks it out once it reached maxFailures
+func (s *LockoutService) fail(key string, maxFailures int) error {
+	now := time.Now()
+	failure, err := s.loginFailureRepo.Fail(key, now.Add(-s.cfg.ResetAfter))
+	if err != nil {
+		return err
+	}
+
+	if failure.Failures == s.cfg.BackoffAfter {
+		logger.Securityf("%d failed sign-ins for %s, slowing down its attempts", failure.Failures, key)
+	}
+	if failure.Failures < maxFailures || isLocked(failure, now) {
+		return nil
+	}
+	until := now.Add(s.cfg.Duration)
+	if err := s.loginFailureRepo.Lock(key, until); err != nil {
+		return err
+	}
+	logger.Securityf("%d failed sign-ins for %s, locked out until %s", failure.Failures, key, until.Format(time.RFC3339))
+	return nil
+}
+
+// delay returns how long to wait after the last of failures before the next attempt
+func (s *LockoutService) delay(failures int) time.Duration {
+	doublings := failures - s.cfg.BackoffAfter
+	if doublings < 0 {
+		return 0
+	}
+	if doublings >= 30 {
+		return s.cfg.MaxDelay
+	}
+	delay := time.Second << doublings
+	if delay > s.cfg.MaxDelay {
+		return s.cfg.MaxDelay
+	}
+	return delay
+}
+
+// isLocked tells whether a lockout of the failures is still running
+func isLocked(failure *models.LoginFailure, now time.Time) bool {
+	return failure.LockedUntil != nil && now.Before(*failure.LockedUntil)
+}
+
+// userKey returns the key failures of a username are counted under, usernames are compared case-insensitively
+func userKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+// ipKey returns the key failures from an IP are counted under
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"veo/internal/configs"
+	"veo/internal/models"
+	"veo/internal/repository"
+	"veo/internal/utils"
+	"veo/pkg/errors"
+)
+
+// defaultMagicLinkTTL is the lifetime of a sign-in link when none is configured
+const defaultMagicLinkTTL = 15 * time.Minute
+
+// Limits on requesting sign-in links, counted whether or not the address belongs to a user
+const (
+	magicLinksPerEmail   = 3
+	magicLinkEmailWindow = 15 * time.Minute
+	magicLinksPerIP      = 10
+	magicLinkIPWindow    = time.Hour
+)
+
+// MagicLinkService signs users in with single-use links sent to their email address
+type MagicLinkService struct {
+	magicLinkRepo *repository.MagicLinkRepository
+	identityRepo  *repository.IdentityRepository
+	userRepo      *repository.UserRepository
+	rateLimiter   RateLimiter
+	mailer        Mailer
+	cfg           configs.MagicLinkConfig
+	secret        []byte
+}
+
+// NewMagicLinkService creates a new instance of MagicLinkService. secret signs the links and must be shared by every instance.
+func NewMagicLinkService(magicLinkRepo *repository.MagicLinkRepository, identityRepo *repository.IdentityRepository, userRepo *repository.UserRepository, rateLimiter RateLimiter, mailer Mailer, cfg configs.MagicLinkConfig, secret []byte) MagicLinkService {
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaultMagicLinkTTL
+	}
+	return MagicLinkService{magicLinkRepo: magicLinkRepo, identityRepo: identityRepo, userRepo: userRepo, rateLimiter: rateLimiter, mailer: mailer, cfg: cfg, secret: secret}
+}
+
+// Request sends a sign-in link to the address if it belongs to a user or to a domain allowed to sign up.
+// The caller learns nothing about the address: the answer only depends on the rate limits,
+// and the address is looked up and mailed in the background so the response time does not tell either.
+func (s *MagicLinkService) Request(email, ip string) error {
+	address, ok := utils.NormalizeEmail(email)
+	if !ok {
+		return errors.NewInvalidParams("Invalid email address")
+	}
+	if err := s.rateLimiter.Allow("magic:ip:"+ip, magicLinksPerIP, magicLinkIPWindow); err != nil {
+		return err
+	}
+	if err := s.rateLimiter.Allow("magic:email:"+address, magicLinksPerEmail, magicLinkEmailWindow); err != nil {
+		return err
+	}
+
+	go s.send(address)
+	return nil
+}
+
+// Verify consumes the token of a sign-in link and returns the user it signs in as.
+// The first sign-in of an address of an allowed domain creates its user.
+func (s *MagicLinkService) Verify(token string) (*models.User, error) {
+	payload, ok := utils.VerifySignedToken(s.secret, token)
+	if !ok {
+		return nil, invalidMagicLink()
+	}
+	_, expiry, _ := strings.Cut(payload, ".")
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return nil, invalidMagicLink()
+	}
+
+	link, err := s.magicLinkRepo.GetByHash(utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if link == nil || link.UsedAt != nil || time.Now().After(link.ExpiresAt) {
+		return nil, invalidMagicLink()
+	}
+	used, err := s.magicLinkRepo.MarkUsed(link.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, invalidMagicLink()
+	}
+
+	return s.signIn(link.Email)
+}
+
+// send mails a new sign-in link to the address, errors are logged since nobody waits for them
+func (s *MagicLinkService) send(address string) {
+	identity, err := s.identityRepo.GetBySubject(models.IdentityEmail, "", address)
+	if err != nil {
+		logger.Errorf("failed to look up the owner of a sign-in link: %v", err)
+		return
+	}
+	if identity == nil && !s.allowedDomain(address) {
+		return
+	}
+
+	random, err := utils.RandomToken(32)
+	if err != nil {
+		logger.Errorf("failed to create a sign-in link: %v", err)
+		return
+	}
+	expiresAt := time.Now().Add(s.cfg.TTL)
+	token := utils.SignToken(s.secret, random+"."+strconv.FormatInt(expiresAt.Unix(), 10))
+
+	link := &models.MagicLink{TokenHash: utils.HashToken(token), Email: address, ExpiresAt: expiresAt}
+	if err := s.magicLinkRepo.Create(link); err != nil {
+		logger.Errorf("failed to store a sign-in link: %v", err)
+		return
+	}
+
+	mail := &Mail{
+		To:      address,
+		Subject: "Your sign-in link",
+		Body: fmt.Sprintf("Open this link to sign in:\n\n%s\n\nIt expires in %s and works once. If you did not ask to sign in, ignore this mail.\n",
+			linkURL(s.cfg.URL, token), s.cfg.TTL),
+	}
+	if err := s.mailer.Send(mail); err != nil {
+		logger.Errorf("failed to send sign-in link %d: %v", link.ID, err)
+	}
+}
+
+// signIn returns the user owning the address, creating both on the first sign-in of an address of an allowed domain
+func (s *MagicLinkService) signIn(address string) (*models.User, error) {
+	identity, err := s.identityRepo.GetBySubject(models.IdentityEmail, "", address)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if identity != nil {
+		if err := s.identityRepo.Touch(identity.ID, now); err != nil {
+			return nil, err
+		}
+		return &identity.User, nil
+	}
+	if !s.allowedDomain(address) {
+		// The address was removed from its account since the link was sent
+		return nil, invalidMagicLink()
+	}
+
+	local, _, _ := strings.Cut(address, "@")
+	user := &models.User{Username: usernameFrom(local, "user"), Email: &address, EmailVerifiedAt: &now}
+	if err := createUser(s.userRepo, user); err != nil {
+		return nil, err
+	}
+
+	logger.Infof("created user %d on its first sign-in by email", user.ID)
+	return user, nil
+}
+
+// invalidMagicLink is returned for every link that does not sign in, whatever the reason
+func invalidMagicLink() error {
+	return errors.NewAuthFailed("Invalid or expired sign-in link")
+}
+
+// allowedDomain tells whether addresses of the domain of the address get a user on their first sign-in
+func (s *MagicLinkService) allowedDomain(address string) bool {
+	domain := address[strings.LastIndexByte(address, '@')+1:]
+	for _, allowed := range s.cfg.AllowedDomains {
+		if strings.EqualFold(domain, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// linkURL adds the token to the query of the page a link sent by email opens
+func linkURL(page, token string) string {
+	u, err := url.Parse(page)
+	if err != nil {
+		return page + "?token=" + url.QueryEscape(token)
+	}
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"veo/internal/configs"
+	"veo/internal/utils"
+)
+
+// Mail is a plain text message sent to a single recipient
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends mail to users
+type Mailer interface {
+	Send(mail *Mail) error
+}
+
+// NewMailer creates the mailer selected by the configuration: console (default), file or smtp
+func NewMailer(cfg configs.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case "", "console":
+		return NewConsoleMailer(cfg.From), nil
+	case "file":
+		return NewFileMailer(cfg.Dir, cfg.From)
+	case "smtp":
+		return NewSMTPMailer(cfg.SMTP, cfg.From)
+	}
+	return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+}
+
+// SMTPMailer sends mail through an SMTP server, upgrading the connection with STARTTLS when the server offers it
+type SMTPMailer struct {
+	addr     string
+	from     string
+	envelope string // Bare address of the sender
+	auth     smtp.Auth
+}
+
+// NewSMTPMailer creates a mailer sending through the SMTP server. Credentials are only sent over TLS,
+// or to a server on localhost.
+func NewSMTPMailer(cfg configs.SMTPConfig, from string) (*SMTPMailer, error) {
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mail sender %q: %v", from, err)
+	}
+
+	mailer := &SMTPMailer{addr: net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)), from: from, envelope: sender.Address}
+	if cfg.Username != "" {
+		mailer.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return mailer, nil
+}
+
+// Send delivers the mail to the SMTP server
+func (m *SMTPMailer) Send(mail *Mail) error {
+	message, err := formatMail(m.from, mail)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, m.auth, m.envelope, []string{mail.To}, message)
+}
+
+// WriterMailer writes mail to a writer instead of sending it, for local runs
+type WriterMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+// NewConsoleMailer creates a mailer printing mail on the standard output
+func NewConsoleMailer(from string) *WriterMailer {
+	return &WriterMailer{w: os.Stdout, from: from}
+}
+
+// Send writes the mail followed by a blank line
+func (m *WriterMailer) Send(mail *Mail) error {
+	message, err := formatMail(m.from, mail)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err = fmt.Fprintf(m.w, "%s\r\n", message)
+	return err
+}
+
+// FileMailer writes each mail to its own .eml file, which mail clients open
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer creates a mailer writing mail to the directory, creating it if needed
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if dir == "" {
+		dir = "mail"
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+// Send writes the mail to a new file named after the time and recipient
+func (m *FileMailer) Send(mail *Mail) error {
+	message, err := formatMail(m.from, mail)
+	if err != nil {
+		return err
+	}
+	suffix, err := utils.RandomToken(4)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s-%s.eml", time.Now().Format("20060102-150405"), strings.ReplaceAll(mail.To, "@", "_at_"), suffix)
+	return os.WriteFile(filepath.Join(m.dir, filepath.Base(name)), message, 0600)
+}
+
+// formatMail builds the RFC 5322 message of a plain text mail
+func formatMail(from string, mail *Mail) ([]byte, error) {
+	if strings.ContainsAny(mail.To, "\r\n") || strings.ContainsAny(mail.Subject, "\r\n") || strings.ContainsAny(from, "\r\n") {
+		return nil, fmt.Errorf("mail headers must not contain line breaks")
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", mail.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", mail.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(mail.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes(), nil
+}
@@ -0,0 +1,357 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"veo/internal/models"
+	"veo/internal/repository"
+	"veo/internal/utils"
+	"veo/pkg/errors"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// MFAChallengeTTL bounds the time between entering the password and entering the code
+const MFAChallengeTTL = 5 * time.Minute
+
+// defaultMFAIssuer is shown in authenticator apps when no issuer is configured
+const defaultMFAIssuer = "veo"
+
+// Second factor limits
+const (
+	maxMFAAttempts    = 5  // Wrong codes accepted per sign-in before the password must be entered again
+	totpDrift         = 1  // Time steps accepted before and after the current one, for clocks out of sync
+	recoveryCodeCount = 10 // Recovery codes handed out at once
+	qrCodeSize        = 256
+)
+
+// recoveryEncoding writes recovery codes in lowercase letters and digits, easy to copy by hand
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// TOTPEnrollment holds what a user needs to add their account to an authenticator app
+type TOTPEnrollment struct {
+	Secret string `json:"secret"` // Base32 secret, for apps that cannot scan the QR code
+	URI    string `json:"uri"`    // otpauth:// URI encoded in the QR code
+}
+
+// QRCode renders the otpauth URI as a PNG image for authenticator apps to scan
+func (e *TOTPEnrollment) QRCode() ([]byte, error) {
+	return qrcode.Encode(e.URI, qrcode.Medium, qrCodeSize)
+}
+
+// MFAService manages the second factor of users: authenticator apps (TOTP) and recovery codes
+type MFAService struct {
+	mfaRepo *repository.MFARepository
+	issuer  string
+}
+
+// NewMFAService creates a new instance of MFAService. issuer is the name authenticator apps show next to the codes.
+func NewMFAService(mfaRepo *repository.MFARepository, issuer string) MFAService {
+	if issuer == "" {
+		issuer = defaultMFAIssuer
+	}
+	return MFAService{mfaRepo: mfaRepo, issuer: issuer}
+}
+
+// Status tells whether the user has a second factor and how many recovery codes they have left
+func (s *MFAService) Status(userID int) (*models.MFAStatus, error) {
+	enabled, err := s.Enabled(userID)
+	if err != nil {
+		return nil, err
+	}
+	status := &models.MFAStatus{Enabled: enabled}
+	if enabled {
+		if status.RecoveryCodesLeft, err = s.mfaRepo.CountRecoveryCodes(userID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// Enabled reports whether signing in as the user requires a second factor
+func (s *MFAService) Enabled(userID int) (bool, error) {
+	credential, err := s.mfaRepo.GetTOTP(userID)
+	if err != nil {
+		return false, err
+	}
+	return credential != nil && credential.ConfirmedAt != nil, nil
+}
+
+// Enroll starts adding an authenticator app to the account of the user. The second factor is enabled
+// once Confirm receives a first code, until then signing in still only requires the password.
+func (s *MFAService) Enroll(user *models.User) (*TOTPEnrollment, error) {
+	enabled, err := s.Enabled(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, errors.NewInvalidParams("Two-factor authentication is already enabled")
+	}
+
+	secret, err := utils.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.CreateTOTP(&models.TOTPCredential{UserID: user.ID, Secret: secret}); err != nil {
+		return nil, err
+	}
+	return s.enrollment(user, secret), nil
+}
+
+// Enrollment returns the enrollment of the user waiting for confirmation, so its QR code can be shown again
+func (s *MFAService) Enrollment(user *models.User) (*TOTPEnrollment, error) {
+	credential, err := s.mfaRepo.GetTOTP(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if credential == nil || credential.ConfirmedAt != nil {
+		return nil, errors.NewInvalidParams("No authenticator app is waiting for confirmation")
+	}
+	return s.enrollment(user, credential.Secret), nil
+}
+
+// Confirm enables the second factor with a first code of the authenticator app, proving the app was set up.
+// It returns the recovery codes, they are shown only once.
+func (s *MFAService) Confirm(userID int, code string) ([]string, error) {
+	credential, err := s.mfaRepo.GetTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	if credential == nil || credential.ConfirmedAt != nil {
+		return nil, errors.NewInvalidParams("No authenticator app is waiting for confirmation")
+	}
+
+	step, ok := matchTOTP(credential.Secret, normalizeCode(code), time.Now())
+	if !ok {
+		return nil, errors.NewAuthFailed("Invalid authentication code")
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	confirmed, err := s.mfaRepo.ConfirmTOTP(credential.ID, step, userID, hashes)
+	if err != nil {
+		return nil, err
+	}
+	if !confirmed {
+		return nil, errors.NewAuthFailed("Authentication code was already used")
+	}
+
+	logger.Infof("enabled two-factor authentication for user %d", userID)
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, the previous ones stop working
+func (s *MFAService) RegenerateRecoveryCodes(userID int) ([]string, error) {
+	enabled, err := s.Enabled(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, errors.NewInvalidParams("Two-factor authentication is not enabled")
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	logger.Infof("regenerated recovery codes of user %d", userID)
+	return codes, nil
+}
+
+// Verify checks a code of the authenticator app or a recovery code of the user. Each code is accepted once.
+func (s *MFAService) Verify(userID int, code string) error {
+	credential, err := s.mfaRepo.GetTOTP(userID)
+	if err != nil {
+		return err
+	}
+	if credential == nil || credential.ConfirmedAt == nil {
+		return errors.NewInvalidParams("Two-factor authentication is not enabled")
+	}
+
+	code = normalizeCode(code)
+	if isTOTPCode(code) {
+		step, ok := matchTOTP(credential.Secret, code, time.Now())
+		if !ok {
+			return errors.NewAuthFailed("Invalid authentication code")
+		}
+		used, err := s.mfaRepo.UseTOTPStep(credential.ID, step)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return errors.NewAuthFailed("Authentication code was already used")
+		}
+		return nil
+	}
+
+	used, err := s.mfaRepo.UseRecoveryCode(userID, utils.HashToken(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return errors.NewAuthFailed("Invalid authentication code")
+	}
+	logger.Warnf("user %d used a recovery code", userID)
+	return nil
+}
+
+// Disable removes the second factor of the user, who proves they still have it with a code
+func (s *MFAService) Disable(userID int, code string) error {
+	if err := s.Verify(userID, code); err != nil {
+		return err
+	}
+	if err := s.mfaRepo.DeleteByUser(userID); err != nil {
+		return err
+	}
+	logger.Infof("disabled two-factor authentication for user %d", userID)
+	return nil
+}
+
+// Reset removes the second factor of a user who lost their authenticator app and recovery codes.
+// It is meant for administrators, after checking who the user is by other means.
+func (s *MFAService) Reset(userID int) error {
+	return s.mfaRepo.DeleteByUser(userID)
+}
+
+// StartChallenge records that the user entered their password and returns the token
+// the client exchanges, together with a code, for the tokens of the sign-in
+func (s *MFAService) StartChallenge(userID int) (string, error) {
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := &models.MFAChallenge{
+		TokenHash: utils.HashToken(token),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(MFAChallengeTTL),
+	}
+	if err := s.mfaRepo.CreateChallenge(challenge); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ChallengeUser returns the user signing in with the challenge token, without checking any code
+func (s *MFAService) ChallengeUser(token string) (*models.User, error) {
+	challenge, err := s.mfaRepo.GetChallenge(utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if challenge == nil || time.Now().After(challenge.ExpiresAt) {
+		return nil, errors.NewTokenExpired("Sign-in expired, please enter your password again")
+	}
+	return &challenge.User, nil
+}
+
+// CompleteChallenge checks the code entered for a sign-in and returns the user signing in.
+// After too many wrong codes the sign-in is abandoned and the password must be entered again.
+func (s *MFAService) CompleteChallenge(token, code string) (*models.User, error) {
+	challenge, err := s.mfaRepo.GetChallenge(utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if challenge == nil || time.Now().After(challenge.ExpiresAt) {
+		return nil, errors.NewTokenExpired("Sign-in expired, please enter your password again")
+	}
+
+	if err := s.Verify(challenge.UserID, code); err != nil {
+		if e, ok := err.(*errors.Error); !ok || e.Code != errors.CodeAuthFailed {
+			return nil, err
+		}
+		attempts, failErr := s.mfaRepo.FailChallenge(challenge.ID)
+		if failErr != nil {
+			return nil, failErr
+		}
+		if attempts >= maxMFAAttempts {
+			if _, deleteErr := s.mfaRepo.DeleteChallenge(challenge.ID); deleteErr != nil {
+				return nil, deleteErr
+			}
+			logger.Warnf("abandoned sign-in of user %d after %d invalid codes", challenge.UserID, attempts)
+			return nil, errors.NewAuthFailed("Too many invalid codes, please enter your password again")
+		}
+		return nil, err
+	}
+
+	// The sign-in completes once, even if the same code is sent twice at the same time
+	deleted, err := s.mfaRepo.DeleteChallenge(challenge.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !deleted {
+		return nil, errors.NewTokenExpired("Sign-in expired, please enter your password again")
+	}
+	return &challenge.User, nil
+}
+
+// enrollment builds the otpauth URI of the secret, in the format authenticator apps understand
+func (s *MFAService) enrollment(user *models.User, secret string) *TOTPEnrollment {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", s.issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(utils.TOTPDigits))
+	query.Set("period", strconv.Itoa(int(utils.TOTPPeriod/time.Second)))
+
+	uri := url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + s.issuer + ":" + user.Username, RawQuery: query.Encode()}
+	return &TOTPEnrollment{Secret: secret, URI: uri.String()}
+}
+
+// matchTOTP returns the time step of the code if it is valid around now
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	current := utils.TOTPStep(now)
+	for step := current - totpDrift; step <= current+totpDrift; step++ {
+		expected, err := utils.TOTPCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(code), []byte(expected)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// newRecoveryCodes generates recovery codes, formatted for display, and the hashes to store
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := recoveryEncoding.EncodeToString(b)
+		codes = append(codes, code[:4]+"-"+code[4:])
+		hashes = append(hashes, utils.HashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeCode drops the spaces and dashes users type in codes, and the case of recovery codes
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+// isTOTPCode reports whether the code has the form of an authenticator app code rather than a recovery code
+func isTOTPCode(code string) bool {
+	if len(code) != utils.TOTPDigits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,334 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"time"
+	"veo/internal/models"
+	"veo/internal/repository"
+	"veo/internal/utils"
+	"veo/pkg/errors"
+)
+
+// authorizationCodeTTL is the lifetime of authorization codes, they are exchanged right after the redirect
+const authorizationCodeTTL = time.Minute
+
+// PKCE parameters (RFC 7636), only the S256 method is supported
+const (
+	pkceMethodS256                = "S256"
+	minCodeVerifierLength         = 43
+	maxCodeVerifierLength         = 128
+	codeVerifierUnreservedSymbols = "-._~"
+)
+
+// Error codes of the OAuth 2.0 protocol (RFC 6749 section 4.1.2.1 and 5.2)
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthUnauthorizedClient      = "unauthorized_client"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthAccessDenied            = "access_denied"
+	OAuthServerError             = "server_error"
+)
+
+// OAuthError is an error reported to OAuth clients with a protocol error code
+type OAuthError struct {
+	Code        string // Protocol error code, such as invalid_grant
+	Description string // Human readable description
+}
+
+// Error implements the error interface
+func (e *OAuthError) Error() string {
+	return e.Description
+}
+
+// NewOAuthError creates a new OAuth protocol error
+func NewOAuthError(code, description string) error {
+	logger.Error(description)
+	return &OAuthError{Code: code, Description: description}
+}
+
+// OAuthService handles OAuth client registration and the authorization code flow
+type OAuthService struct {
+	clientRepo  *repository.OAuthClientRepository
+	codeRepo    *repository.OAuthCodeRepository
+	sessionRepo *repository.SessionRepository
+	refreshRepo *repository.RefreshTokenRepository
+}
+
+// NewOAuthService creates a new instance of OAuthService
+func NewOAuthService(clientRepo *repository.OAuthClientRepository, codeRepo *repository.OAuthCodeRepository, sessionRepo *repository.SessionRepository, refreshRepo *repository.RefreshTokenRepository) OAuthService {
+	return OAuthService{clientRepo: clientRepo, codeRepo: codeRepo, sessionRepo: sessionRepo, refreshRepo: refreshRepo}
+}
+
+// RegisterClient registers an application. It returns the client and, for confidential clients,
+// the plain client secret, which cannot be retrieved again.
+func (s *OAuthService) RegisterClient(name string, redirectURIs, scopes, grantTypes []string, public bool) (*models.OAuthClient, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", errors.NewInvalidParams("Client name is required")
+	}
+	if len(scopes) == 0 || !subset(scopes, models.OAuthScopes) {
+		return nil, "", errors.NewInvalidParams("Client scopes must be among " + strings.Join(models.OAuthScopes, ", "))
+	}
+	grants := []string{models.GrantAuthorizationCode, models.GrantClientCredentials, models.GrantRefreshToken}
+	if len(grantTypes) == 0 || !subset(grantTypes, grants) {
+		return nil, "", errors.NewInvalidParams("Client grant types must be among " + strings.Join(grants, ", "))
+	}
+	if public && contains(grantTypes, models.GrantClientCredentials) {
+		return nil, "", errors.NewInvalidParams("Public clients cannot use the client credentials grant")
+	}
+	if contains(grantTypes, models.GrantAuthorizationCode) && len(redirectURIs) == 0 {
+		return nil, "", errors.NewInvalidParams("The authorization code grant needs a redirect URI")
+	}
+	for _, uri := range redirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			return nil, "", err
+		}
+	}
+
+	clientID, err := utils.RandomToken(16)
+	if err != nil {
+		return nil, "", NewError(CodeError, "Failed to generate client ID")
+	}
+
+	client := &models.OAuthClient{
+		ClientID:     clientID,
+		Name:         name,
+		RedirectURIs: strings.Join(redirectURIs, " "),
+		Scopes:       strings.Join(scopes, " "),
+		GrantTypes:   strings.Join(grantTypes, " "),
+		Public:       public,
+	}
+
+	var secret string
+	if !public {
+		if secret, err = utils.RandomToken(32); err != nil {
+			return nil, "", NewError(CodeError, "Failed to generate client secret")
+		}
+		client.SecretHash = utils.HashToken(secret)
+	}
+
+	if err := s.clientRepo.Create(client); err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+// ListClients returns every registered client
+func (s *OAuthService) ListClients() ([]models.OAuthClient, error) {
+	return s.clientRepo.List()
+}
+
+// DeleteClient removes a client and ends every session granted to it
+func (s *OAuthService) DeleteClient(clientID string) error {
+	deleted, err := s.clientRepo.Delete(clientID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return errors.NewInvalidParams("Client does not exist")
+	}
+
+	sessions, err := s.sessionRepo.ListByClient(clientID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if err := s.refreshRepo.RevokeSession(session.ID); err != nil {
+			return err
+		}
+		if err := s.sessionRepo.Delete(session.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolveClient looks up the client of an authorization request and the redirect URI to answer on.
+// The redirect URI may be omitted when the client registered only one.
+// Errors must be shown to the user, redirecting to an unverified URI would make us an open redirector.
+func (s *OAuthService) ResolveClient(clientID, redirectURI string) (*models.OAuthClient, string, error) {
+	client, err := s.clientRepo.GetByClientID(clientID)
+	if err != nil {
+		return nil, "", err
+	}
+	if client == nil {
+		return nil, "", NewOAuthError(OAuthInvalidClient, "Unknown client")
+	}
+
+	registered := strings.Fields(client.RedirectURIs)
+	if redirectURI == "" && len(registered) == 1 {
+		redirectURI = registered[0]
+	}
+	if redirectURI == "" || !client.HasRedirectURI(redirectURI) {
+		return nil, "", NewOAuthError(OAuthInvalidRequest, "Redirect URI is not registered for the client")
+	}
+	return client, redirectURI, nil
+}
+
+// ValidateAuthorization checks an authorization request of a resolved client and returns the granted scope.
+// Every client must send a PKCE challenge, public clients have no other protection against stolen codes.
+func (s *OAuthService) ValidateAuthorization(client *models.OAuthClient, responseType, scope, codeChallenge, codeChallengeMethod string) (string, error) {
+	if responseType != "code" {
+		return "", NewOAuthError(OAuthUnsupportedResponseType, "Only the code response type is supported")
+	}
+	if !client.HasGrantType(models.GrantAuthorizationCode) {
+		return "", NewOAuthError(OAuthUnauthorizedClient, "Client may not use the authorization code grant")
+	}
+	if codeChallenge == "" || codeChallengeMethod != pkceMethodS256 {
+		return "", NewOAuthError(OAuthInvalidRequest, "A PKCE code challenge with method S256 is required")
+	}
+	return s.ResolveScope(client, scope)
+}
+
+// ResolveScope returns the scope granted for a request: the requested scopes, all of which the client
+// must be registered for, or every scope of the client when none is requested. Scopes clients can no
+// longer be registered for are not granted to clients registered before.
+func (s *OAuthService) ResolveScope(client *models.OAuthClient, scope string) (string, error) {
+	var allowed []string
+	for _, clientScope := range strings.Fields(client.Scopes) {
+		if contains(models.OAuthScopes, clientScope) {
+			allowed = append(allowed, clientScope)
+		}
+	}
+
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		if len(allowed) == 0 {
+			return "", NewOAuthError(OAuthInvalidScope, "The client is not allowed any scope")
+		}
+		return strings.Join(allowed, " "), nil
+	}
+	if !subset(requested, allowed) {
+		return "", NewOAuthError(OAuthInvalidScope, "Requested scope is not allowed for the client")
+	}
+	return strings.Join(requested, " "), nil
+}
+
+// IssueCode creates the authorization code sent to the client after the user approved the request
+func (s *OAuthService) IssueCode(client *models.OAuthClient, userID int, redirectURI, scope, codeChallenge string) (string, error) {
+	plain, err := utils.RandomToken(32)
+	if err != nil {
+		return "", NewError(CodeError, "Failed to generate authorization code")
+	}
+
+	code := &models.OAuthAuthorizationCode{
+		CodeHash:      utils.HashToken(plain),
+		ClientID:      client.ClientID,
+		UserID:        userID,
+		RedirectURI:   redirectURI,
+		Scope:         scope,
+		CodeChallenge: codeChallenge,
+		ExpiresAt:     time.Now().Add(authorizationCodeTTL),
+	}
+	if err := s.codeRepo.Create(code); err != nil {
+		return "", err
+	}
+	return plain, nil
+}
+
+// ExchangeCode redeems an authorization code of the client. The redirect URI must be the one the code
+// was sent to and the PKCE verifier must match the challenge of the authorization request.
+func (s *OAuthService) ExchangeCode(client *models.OAuthClient, code, redirectURI, codeVerifier string) (*models.OAuthAuthorizationCode, error) {
+	grant, err := s.codeRepo.GetByHash(utils.HashToken(code))
+	if err != nil {
+		return nil, err
+	}
+	if grant == nil || grant.ClientID != client.ClientID || grant.UsedAt != nil || time.Now().After(grant.ExpiresAt) {
+		return nil, NewOAuthError(OAuthInvalidGrant, "Invalid authorization code")
+	}
+	if grant.RedirectURI != redirectURI {
+		return nil, NewOAuthError(OAuthInvalidGrant, "Redirect URI does not match the authorization request")
+	}
+	if !VerifyCodeChallenge(grant.CodeChallenge, codeVerifier) {
+		return nil, NewOAuthError(OAuthInvalidGrant, "Invalid PKCE code verifier")
+	}
+
+	// Claim the code, losing the race against a concurrent exchange counts as reuse
+	used, err := s.codeRepo.MarkUsed(grant.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, NewOAuthError(OAuthInvalidGrant, "Invalid authorization code")
+	}
+	return grant, nil
+}
+
+// AuthenticateClient checks the credentials a client sent to the token endpoint.
+// Public clients only identify themselves, confidential clients must present their secret.
+func (s *OAuthService) AuthenticateClient(clientID, secret string) (*models.OAuthClient, error) {
+	client, err := s.clientRepo.GetByClientID(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, NewOAuthError(OAuthInvalidClient, "Client authentication failed")
+	}
+
+	if client.Public {
+		if secret != "" {
+			return nil, NewOAuthError(OAuthInvalidClient, "Client authentication failed")
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(utils.HashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, NewOAuthError(OAuthInvalidClient, "Client authentication failed")
+	}
+	return client, nil
+}
+
+// VerifyCodeChallenge checks a PKCE code verifier against its S256 challenge (RFC 7636)
+func VerifyCodeChallenge(challenge, verifier string) bool {
+	if len(verifier) < minCodeVerifierLength || len(verifier) > maxCodeVerifierLength {
+		return false
+	}
+	for _, r := range verifier {
+		isAlphanumeric := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+		if !isAlphanumeric && !strings.ContainsRune(codeVerifierUnreservedSymbols, r) {
+			return false
+		}
+	}
+
+	return subtle.ConstantTimeCompare([]byte(codeChallengeS256(verifier)), []byte(challenge)) == 1
+}
+
+// codeChallengeS256 derives the S256 code challenge of a PKCE code verifier
+func codeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// validateRedirectURI accepts absolute URIs without fragment. Plain HTTP is only allowed on
+// the loopback interface, for native apps; custom schemes are allowed for mobile apps.
+func validateRedirectURI(uri string) error {
+	parsed, err := url.Parse(uri)
+	if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+		return errors.NewInvalidParams("Invalid redirect URI " + uri)
+	}
+	if parsed.Scheme == "http" {
+		switch parsed.Hostname() {
+		case "localhost", "127.0.0.1", "::1":
+		default:
+			return errors.NewInvalidParams("Redirect URI " + uri + " must use HTTPS")
+		}
+	}
+	return nil
+}
+
+// subset reports whether every value is one of allowed
+func subset(values, allowed []string) bool {
+	for _, value := range values {
+		if !contains(allowed, value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,468 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"veo/internal/configs"
+	"veo/internal/models"
+	"veo/pkg/errors"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Limits applied when talking to OpenID Connect providers
+const (
+	oidcClockSkew         = time.Minute      // Tolerated difference between the clock of a provider and ours
+	oidcKeysRefreshPeriod = time.Minute      // Minimum time between two downloads of the signing keys of a provider
+	oidcHTTPTimeout       = 10 * time.Second // Timeout of requests to a provider
+	maxOIDCResponseSize   = 1 << 20          // Largest response accepted from a provider
+)
+
+// Protocol values of OpenID Connect
+const (
+	oidcScopeOpenID   = "openid"
+	oidcDiscoveryPath = "/.well-known/openid-configuration"
+)
+
+// oidcSigningMethods are the ID token signature algorithms we accept. Symmetric algorithms are refused,
+// they would let anyone knowing our client secret forge tokens.
+var oidcSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// ExternalIdentity is what an identity provider asserts about the user who signed in.
+type ExternalIdentity struct {
+	Subject           string // Stable ID of the user at the provider
+	Email             string // Email address, if the provider shares it
+	EmailVerified     bool   // Whether the provider verified the email address
+	Name              string // Full name
+	PreferredUsername string // Username the user goes by at the provider
+}
+
+// IdentityProvider is an external login provider users are redirected to.
+// OIDCProvider implements it for OpenID Connect, other protocols can be plugged in the same way.
+type IdentityProvider interface {
+	// AuthorizationURL returns the URL sending the user to the provider. state and nonce bind the
+	// response to this sign-in, codeChallenge binds the authorization code to its verifier (PKCE).
+	AuthorizationURL(ctx context.Context, state, nonce, codeChallenge string) (string, error)
+	// Exchange redeems an authorization code and returns the verified identity of the user.
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*ExternalIdentity, error)
+}
+
+// oidcMetadata is the part of the provider metadata we use (OpenID Connect Discovery section 3)
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcTokenResponse is the response of the token endpoint
+type oidcTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// oidcProfile holds the standard claims describing the user, found in ID tokens and userinfo responses
+type oidcProfile struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// idTokenClaims are the claims of an ID token (OpenID Connect Core section 2)
+type idTokenClaims struct {
+	oidcProfile
+	Issuer          string       `json:"iss"`
+	Audience        oidcAudience `json:"aud"`
+	AuthorizedParty string       `json:"azp"`
+	ExpiresAt       int64        `json:"exp"`
+	IssuedAt        int64        `json:"iat"`
+	Nonce           string       `json:"nonce"`
+}
+
+// Valid satisfies jwt.Claims. The claims are checked by verifyIDToken, which allows for clock skew.
+func (c *idTokenClaims) Valid() error {
+	return nil
+}
+
+// oidcAudience is the aud claim, a single string or an array of strings
+type oidcAudience []string
+
+// UnmarshalJSON decodes either form of the aud claim.
+func (a *oidcAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = oidcAudience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+// jsonWebKey is a public key of the key set of a provider (RFC 7517)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// OIDCProvider is an OpenID Connect provider we are a relying party of. Its metadata is discovered
+// on first use. Its signing keys are cached and downloaded again when a token names an unknown key.
+type OIDCProvider struct {
+	config configs.OIDCProviderConfig
+	client *http.Client
+
+	mu            sync.Mutex
+	metadata      *oidcMetadata
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+// NewOIDCProvider creates a new instance of OIDCProvider. client may be nil to use a default HTTP client.
+func NewOIDCProvider(config configs.OIDCProviderConfig, client *http.Client) *OIDCProvider {
+	if client == nil {
+		client = &http.Client{Timeout: oidcHTTPTimeout}
+	}
+	return &OIDCProvider{config: config, client: client}
+}
+
+// AuthorizationURL returns the URL of the authorization endpoint of the provider for a code flow with PKCE
+func (p *OIDCProvider) AuthorizationURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	endpoint, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", errors.New(errors.CodeError, "Identity provider has an invalid authorization endpoint")
+	}
+
+	scopes := []string{oidcScopeOpenID}
+	for _, scope := range p.config.Scopes {
+		if scope != oidcScopeOpenID {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	query := endpoint.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", pkceMethodS256)
+	endpoint.RawQuery = query.Encode()
+	return endpoint.String(), nil
+}
+
+// Exchange redeems an authorization code at the token endpoint, verifies the ID token and
+// completes the profile of the user from the userinfo endpoint when the provider has one.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*ExternalIdentity, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {models.GrantAuthorizationCode},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if p.config.ClientSecret == "" {
+		form.Set("client_id", p.config.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		// Credentials are form encoded before going into the Basic header (RFC 6749 section 2.3.1)
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	var tokens oidcTokenResponse
+	status, err := p.do(req, &tokens)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK || tokens.IDToken == "" {
+		logger.Warnf("identity provider %s refused the authorization code: %s %s", p.config.Name, tokens.Error, tokens.ErrorDescription)
+		return nil, errors.NewAuthFailed("Identity provider refused the authorization code")
+	}
+
+	claims, err := p.verifyIDToken(ctx, tokens.IDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+	profile := claims.oidcProfile
+
+	if metadata.UserinfoEndpoint != "" && tokens.AccessToken != "" {
+		userinfo, err := p.userinfo(ctx, metadata.UserinfoEndpoint, tokens.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+		// The userinfo response must be about the user of the ID token (OpenID Connect Core section 5.3.2)
+		if userinfo.Subject != claims.Subject {
+			return nil, errors.NewAuthFailed("Identity provider returned the profile of another user")
+		}
+		mergeProfile(&profile, userinfo)
+	}
+
+	return &ExternalIdentity{
+		Subject:           profile.Subject,
+		Email:             profile.Email,
+		EmailVerified:     profile.EmailVerified,
+		Name:              profile.Name,
+		PreferredUsername: profile.PreferredUsername,
+	}, nil
+}
+
+// verifyIDToken checks the signature and claims of an ID token (OpenID Connect Core section 3.1.3.7)
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, rawToken, nonce string) (*idTokenClaims, error) {
+	parser := jwt.Parser{ValidMethods: oidcSigningMethods}
+	claims := &idTokenClaims{}
+	_, err := parser.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, errors.NewAuthFailed("Invalid ID token")
+	}
+
+	now := time.Now()
+	switch {
+	case claims.Issuer != p.config.Issuer:
+		return nil, errors.NewAuthFailed("ID token issuer is not accepted")
+	case !claims.Audience.contains(p.config.ClientID):
+		return nil, errors.NewAuthFailed("ID token was issued to another client")
+	case claims.AuthorizedParty != "" && claims.AuthorizedParty != p.config.ClientID:
+		return nil, errors.NewAuthFailed("ID token was issued to another client")
+	case claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(oidcClockSkew)):
+		return nil, errors.NewAuthFailed("ID token has expired")
+	case time.Unix(claims.IssuedAt, 0).After(now.Add(oidcClockSkew)):
+		return nil, errors.NewAuthFailed("ID token was issued in the future")
+	case nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, errors.NewAuthFailed("ID token was issued for another sign-in")
+	case claims.Subject == "":
+		return nil, errors.NewAuthFailed("ID token has no subject")
+	}
+	return claims, nil
+}
+
+// userinfo retrieves the profile of the user the access token was issued for
+func (p *OIDCProvider) userinfo(ctx context.Context, endpoint, accessToken string) (*oidcProfile, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	var profile oidcProfile
+	status, err := p.do(req, &profile)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, errors.New(errors.CodeError, "Identity provider did not return the user profile")
+	}
+	return &profile, nil
+}
+
+// discover fetches the provider metadata once and checks it belongs to the configured issuer
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.config.Issuer, "/")+oidcDiscoveryPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	var metadata oidcMetadata
+	status, err := p.do(req, &metadata)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK || metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New(errors.CodeError, "Identity provider metadata is unavailable")
+	}
+	// Metadata naming another issuer could send us to an impostor (OpenID Connect Discovery section 4.3)
+	if metadata.Issuer != p.config.Issuer {
+		return nil, errors.New(errors.CodeError, "Identity provider metadata names another issuer")
+	}
+
+	p.metadata = &metadata
+	return p.metadata, nil
+}
+
+// key returns the signing key with the given ID, downloading the key set again when it is unknown.
+// Tokens without a key ID are accepted when the provider has a single key.
+func (p *OIDCProvider) key(ctx context.Context, kid string) (interface{}, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < oidcKeysRefreshPeriod {
+		return nil, errors.NewAuthFailed("ID token was signed with an unknown key")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadata.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	status, err := p.do(req, &set)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, errors.New(errors.CodeError, "Identity provider signing keys are unavailable")
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key := jwk.publicKey(); key != nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, errors.NewAuthFailed("ID token was signed with an unknown key")
+}
+
+// lookupKey finds a cached signing key, the caller holds the lock
+func (p *OIDCProvider) lookupKey(kid string) interface{} {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+// do sends a request to the provider and decodes its JSON response, whatever the status
+func (p *OIDCProvider) do(req *http.Request, out interface{}) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		logger.Errorf("identity provider %s is unreachable: %v", p.config.Name, err)
+		return 0, errors.New(errors.CodeError, "Identity provider is unreachable")
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxOIDCResponseSize)).Decode(out); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, errors.New(errors.CodeError, "Identity provider sent an invalid response")
+	}
+	return resp.StatusCode, nil
+}
+
+// publicKey decodes an RSA or elliptic curve key, returning nil for other keys
+func (k *jsonWebKey) publicKey() interface{} {
+	decode := func(s string) *big.Int {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil
+		}
+		return new(big.Int).SetBytes(b)
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, e := decode(k.N), decode(k.E)
+		if n == nil || e == nil || !e.IsInt64() {
+			return nil
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil
+		}
+		x, y := decode(k.X), decode(k.Y)
+		if x == nil || y == nil || !curve.IsOnCurve(x, y) {
+			return nil
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+	}
+	return nil
+}
+
+// contains reports whether the audience includes the client
+func (a oidcAudience) contains(clientID string) bool {
+	for _, audience := range a {
+		if audience == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeProfile completes the profile from the ID token with the claims of the userinfo response
+func mergeProfile(profile *oidcProfile, userinfo *oidcProfile) {
+	if userinfo.Email != "" {
+		profile.Email = userinfo.Email
+		profile.EmailVerified = userinfo.EmailVerified
+	}
+	if userinfo.Name != "" {
+		profile.Name = userinfo.Name
+	}
+	if userinfo.PreferredUsername != "" {
+		profile.PreferredUsername = userinfo.PreferredUsername
+	}
+}
@@ -0,0 +1,418 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+	"veo/internal/configs"
+	"veo/internal/models"
+	"veo/internal/repository"
+	"veo/internal/utils"
+	"veo/pkg/errors"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// PasskeyCeremonyTTL bounds the time the user has to confirm with their authenticator
+const PasskeyCeremonyTTL = 5 * time.Minute
+
+// Passkey limits
+const (
+	maxCredentialIDLength = 1023 // WebAuthn section 5.8.3
+	maxPasskeyNameLength  = 100
+	defaultPasskeyName    = "Passkey"
+)
+
+// CredentialDescriptor names a passkey in ceremony options (WebAuthn section 5.8.3)
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"` // Base64url credential ID
+	Transports []string `json:"transports,omitempty"`
+}
+
+// CredentialParameters names a key algorithm the authenticator may use (WebAuthn section 5.3)
+type CredentialParameters struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"` // COSE algorithm
+}
+
+// RelyingParty describes us to the authenticator
+type RelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// PasskeyUser describes the user a passkey is created for
+type PasskeyUser struct {
+	ID          string `json:"id"` // Base64url user handle, returned by the authenticator at sign-in
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// AuthenticatorSelection states the authenticators a passkey may be created on (WebAuthn section 5.4.4)
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CredentialCreationOptions starts the registration of a passkey, in the JSON form browsers parse with
+// PublicKeyCredential.parseCreationOptionsFromJSON (WebAuthn section 5.4)
+type CredentialCreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RelyingParty           `json:"rp"`
+	User                   PasskeyUser            `json:"user"`
+	PubKeyCredParams       []CredentialParameters `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"` // Milliseconds
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// CredentialRequestOptions starts a sign-in with a passkey, in the JSON form browsers parse with
+// PublicKeyCredential.parseRequestOptionsFromJSON (WebAuthn section 5.5).
+// No credentials are allowed explicitly: passkeys are discoverable, the user picks one.
+type CredentialRequestOptions struct {
+	Challenge        string `json:"challenge"`
+	Timeout          int    `json:"timeout"` // Milliseconds
+	RPID             string `json:"rpId"`
+	UserVerification string `json:"userVerification"`
+}
+
+// RegistrationCredential is the JSON form of the credential the browser creates (PublicKeyCredential.toJSON)
+type RegistrationCredential struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports"`
+	} `json:"response"`
+}
+
+// AssertionCredential is the JSON form of the assertion the browser returns at sign-in (PublicKeyCredential.toJSON)
+type AssertionCredential struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+// PasskeyService runs the WebAuthn ceremonies registering passkeys and signing in with them
+type PasskeyService struct {
+	passkeyRepo  *repository.PasskeyRepository
+	identityRepo *repository.IdentityRepository
+	rp           RelyingParty
+	origins      []string
+}
+
+// NewPasskeyService creates a new instance of PasskeyService for the configured relying party
+func NewPasskeyService(passkeyRepo *repository.PasskeyRepository, identityRepo *repository.IdentityRepository, cfg configs.WebAuthnConfig) PasskeyService {
+	return PasskeyService{
+		passkeyRepo:  passkeyRepo,
+		identityRepo: identityRepo,
+		rp:           RelyingParty{ID: cfg.RPID, Name: cfg.RPName},
+		origins:      cfg.Origins,
+	}
+}
+
+// List returns the passkeys of the user, oldest first
+func (s *PasskeyService) List(userID int) ([]models.Passkey, error) {
+	return s.passkeyRepo.ListByUser(userID)
+}
+
+// BeginRegistration starts creating a passkey for the user. The passkeys the user already has are excluded,
+// so an authenticator is not registered twice.
+func (s *PasskeyService) BeginRegistration(user *models.User) (*CredentialCreationOptions, error) {
+	challenge, err := s.newChallenge(models.PasskeyRegistration, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys, err := s.passkeyRepo.ListByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	exclude := make([]CredentialDescriptor, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		exclude = append(exclude, CredentialDescriptor{Type: "public-key", ID: passkey.CredentialID, Transports: strings.Fields(passkey.Transports)})
+	}
+
+	params := make([]CredentialParameters, 0, len(passkeyAlgorithms))
+	for _, alg := range passkeyAlgorithms {
+		params = append(params, CredentialParameters{Type: "public-key", Alg: alg})
+	}
+
+	return &CredentialCreationOptions{
+		Challenge:              challenge,
+		RP:                     s.rp,
+		User:                   PasskeyUser{ID: userHandle(user.ID), Name: user.Username, DisplayName: user.Username},
+		PubKeyCredParams:       params,
+		Timeout:                int(PasskeyCeremonyTTL.Milliseconds()),
+		ExcludeCredentials:     exclude,
+		AuthenticatorSelection: AuthenticatorSelection{ResidentKey: "required", RequireResidentKey: true, UserVerification: "required"},
+		Attestation:            "none",
+	}, nil
+}
+
+// FinishRegistration checks the passkey created by the authenticator and stores it for the user
+func (s *PasskeyService) FinishRegistration(userID int, name string, credential *RegistrationCredential) (*models.Passkey, error) {
+	if credential.Type != "public-key" {
+		return nil, errors.NewInvalidParams("Invalid credential type")
+	}
+	clientDataJSON, err := decodeBase64URL(credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, errors.NewInvalidParams("Invalid client data")
+	}
+	challenge, err := s.takeChallenge(clientDataJSON, "webauthn.create", models.PasskeyRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.UserID != userID {
+		return nil, errors.NewAuthFailed("Passkey registration was started by another user")
+	}
+
+	rawAttestation, err := decodeBase64URL(credential.Response.AttestationObject)
+	if err != nil {
+		return nil, errors.NewInvalidParams("Invalid attestation object")
+	}
+	var attestation attestationObject
+	if err := cbor.Unmarshal(rawAttestation, &attestation); err != nil {
+		return nil, errors.NewInvalidParams("Invalid attestation object")
+	}
+	authData, err := s.checkAuthenticatorData(attestation.AuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.Flags&flagAttestedData == 0 {
+		return nil, errors.NewInvalidParams("Attestation carries no credential")
+	}
+
+	rawID, err := decodeBase64URL(credential.RawID)
+	if err != nil || !bytes.Equal(rawID, authData.CredentialID) {
+		return nil, errors.NewInvalidParams("Credential ID does not match the attestation")
+	}
+	if len(rawID) == 0 || len(rawID) > maxCredentialIDLength {
+		return nil, errors.NewInvalidParams("Invalid credential ID")
+	}
+	if _, _, err := parsePublicKey(authData.PublicKey); err != nil {
+		return nil, err
+	}
+
+	credentialID := base64.RawURLEncoding.EncodeToString(rawID)
+	existing, err := s.passkeyRepo.GetByCredentialHash(utils.HashToken(credentialID))
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, errors.NewUserExists("Passkey is already registered")
+	}
+
+	if name = truncate(strings.TrimSpace(name), maxPasskeyNameLength); name == "" {
+		name = defaultPasskeyName
+	}
+	passkey := &models.Passkey{
+		UserID:         userID,
+		Name:           name,
+		CredentialID:   credentialID,
+		CredentialHash: utils.HashToken(credentialID),
+		PublicKey:      authData.PublicKey,
+		SignCount:      authData.SignCount,
+		Transports:     strings.Join(credential.Response.Transports, " "),
+	}
+	if err := s.passkeyRepo.Create(passkey); err != nil {
+		return nil, err
+	}
+
+	logger.Infof("registered passkey %d for user %d", passkey.ID, userID)
+	return passkey, nil
+}
+
+// BeginLogin starts a sign-in with a passkey
+func (s *PasskeyService) BeginLogin() (*CredentialRequestOptions, error) {
+	challenge, err := s.newChallenge(models.PasskeyLogin, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &CredentialRequestOptions{
+		Challenge:        challenge,
+		Timeout:          int(PasskeyCeremonyTTL.Milliseconds()),
+		RPID:             s.rp.ID,
+		UserVerification: "required",
+	}, nil
+}
+
+// FinishLogin checks the assertion of a passkey and returns the user it signs in as
+func (s *PasskeyService) FinishLogin(credential *AssertionCredential) (*models.User, error) {
+	if credential.Type != "public-key" {
+		return nil, errors.NewInvalidParams("Invalid credential type")
+	}
+	clientDataJSON, err := decodeBase64URL(credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, errors.NewInvalidParams("Invalid client data")
+	}
+	if _, err := s.takeChallenge(clientDataJSON, "webauthn.get", models.PasskeyLogin); err != nil {
+		return nil, err
+	}
+
+	rawID, err := decodeBase64URL(credential.RawID)
+	if err != nil {
+		return nil, errors.NewInvalidParams("Invalid credential ID")
+	}
+	passkey, err := s.passkeyRepo.GetByCredentialHash(utils.HashToken(base64.RawURLEncoding.EncodeToString(rawID)))
+	if err != nil {
+		return nil, err
+	}
+	if passkey == nil {
+		return nil, errors.NewAuthFailed("Unknown passkey")
+	}
+	if credential.Response.UserHandle != "" && strings.TrimRight(credential.Response.UserHandle, "=") != userHandle(passkey.UserID) {
+		return nil, errors.NewAuthFailed("Passkey belongs to another user")
+	}
+
+	rawAuthData, err := decodeBase64URL(credential.Response.AuthenticatorData)
+	if err != nil {
+		return nil, errors.NewInvalidParams("Invalid authenticator data")
+	}
+	authData, err := s.checkAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := decodeBase64URL(credential.Response.Signature)
+	if err != nil {
+		return nil, errors.NewInvalidParams("Invalid signature")
+	}
+	key, _, err := parsePublicKey(passkey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if !verifyPasskeySignature(key, rawAuthData, clientDataJSON, signature) {
+		return nil, errors.NewAuthFailed("Invalid passkey signature")
+	}
+
+	// Authenticators keeping a signature counter increase it on every use, a lower one means a copy of the key
+	if (authData.SignCount != 0 || passkey.SignCount != 0) && authData.SignCount <= passkey.SignCount {
+		logger.Warnf("passkey %d of user %d sent counter %d after %d, it may have been cloned", passkey.ID, passkey.UserID, authData.SignCount, passkey.SignCount)
+		return nil, errors.NewAuthFailed("Passkey may have been cloned")
+	}
+	recorded, err := s.passkeyRepo.RecordUse(passkey.ID, passkey.SignCount, authData.SignCount)
+	if err != nil {
+		return nil, err
+	}
+	if !recorded {
+		return nil, errors.NewAuthFailed("Passkey was used by another sign-in")
+	}
+
+	identity, err := s.identityRepo.GetBySubject(models.IdentityPasskey, "", strconv.Itoa(passkey.ID))
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		if err := s.identityRepo.Touch(identity.ID, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	return &passkey.User, nil
+}
+
+// Delete removes a passkey of the user through its identity, the last way to sign in cannot be removed
+func (s *PasskeyService) Delete(userID, passkeyID int) error {
+	identity, err := s.identityRepo.GetBySubject(models.IdentityPasskey, "", strconv.Itoa(passkeyID))
+	if err != nil {
+		return err
+	}
+	if identity == nil || identity.UserID != userID {
+		return errors.NewInvalidParams("Passkey does not exist")
+	}
+
+	if _, err := s.identityRepo.Delete(userID, identity.ID); err != nil {
+		return err
+	}
+	logger.Infof("removed passkey %d of user %d", passkeyID, userID)
+	return nil
+}
+
+// newChallenge hands out the random challenge of a ceremony
+func (s *PasskeyService) newChallenge(purpose string, userID int) (string, error) {
+	challenge, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	record := &models.PasskeyChallenge{
+		ChallengeHash: utils.HashToken(challenge),
+		Purpose:       purpose,
+		UserID:        userID,
+		ExpiresAt:     time.Now().Add(PasskeyCeremonyTTL),
+	}
+	if err := s.passkeyRepo.CreateChallenge(record); err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// takeChallenge checks the client data of a ceremony and consumes the challenge it echoes
+func (s *PasskeyService) takeChallenge(clientDataJSON []byte, ceremony, purpose string) (*models.PasskeyChallenge, error) {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return nil, errors.NewInvalidParams("Invalid client data")
+	}
+	if data.Type != ceremony {
+		return nil, errors.NewInvalidParams("Invalid client data type")
+	}
+	if data.CrossOrigin || !s.allowedOrigin(data.Origin) {
+		return nil, errors.NewAuthFailed("Passkey was used from an unknown origin")
+	}
+
+	challenge, err := s.passkeyRepo.TakeChallenge(utils.HashToken(strings.TrimRight(data.Challenge, "=")), purpose)
+	if err != nil {
+		return nil, err
+	}
+	if challenge == nil || time.Now().After(challenge.ExpiresAt) {
+		return nil, errors.NewTokenExpired("Passkey request expired, please try again")
+	}
+	return challenge, nil
+}
+
+// checkAuthenticatorData parses authenticator data and checks it was produced for us, with the user verified
+func (s *PasskeyService) checkAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	authData, err := parseAuthenticatorData(raw)
+	if err != nil {
+		return nil, err
+	}
+	rpIDHash := sha256.Sum256([]byte(s.rp.ID))
+	if !bytes.Equal(authData.RPIDHash, rpIDHash[:]) {
+		return nil, errors.NewAuthFailed("Passkey belongs to another site")
+	}
+	if authData.Flags&flagUserPresent == 0 || authData.Flags&flagUserVerified == 0 {
+		return nil, errors.NewAuthFailed("The authenticator did not verify the user")
+	}
+	return authData, nil
+}
+
+// allowedOrigin reports whether a ceremony may run on the origin
+func (s *PasskeyService) allowedOrigin(origin string) bool {
+	for _, allowed := range s.origins {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// userHandle returns the base64url user handle stored in the passkeys of a user.
+// It is the user ID, which carries no personal information.
+func userHandle(userID int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(userID)))
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"fmt"
+	"time"
+	"veo/internal/models"
+	"veo/internal/repository"
+	"veo/internal/utils"
+	"veo/pkg/errors"
+)
+
+// PasswordChangeRequired tells whether the user must change its password before doing anything else,
+// because an admin asked for it or the password is older than the maximum age of the password policy.
+// A password set before its age was recorded counts as expired.
+func PasswordChangeRequired(user *models.User) bool {
+	if user.Password == "" {
+		return false
+	}
+	if user.MustChangePassword {
+		return true
+	}
+	maxAge := passwordPolicy.cfg.MaxAge
+	if maxAge <= 0 {
+		return false
+	}
+	return user.PasswordChangedAt == nil || time.Since(*user.PasswordChangedAt) > maxAge
+}
+
+// checkPasswordReuse returns an InvalidParams error when the password is the current one of the user
+// or one of the last ones the password policy remembers
+func checkPasswordReuse(userRepo *repository.UserRepository, user *models.User, field, password string) error {
+	history := passwordPolicy.cfg.History
+	if history <= 0 {
+		return nil
+	}
+	hashes := []string{user.Password}
+	previous, err := userRepo.PasswordHistory(user.ID, history)
+	if err != nil {
+		return err
+	}
+	for _, entry := range previous {
+		hashes = append(hashes, entry.Password)
+	}
+	for _, hash := range hashes {
+		if hash == "" {
+			continue
+		}
+		if ok, _ := utils.VerifyPassword(password, hash); ok {
+			return errors.NewFieldErrors("Password does not meet the password policy", []errors.FieldError{{
+				Field:   field,
+				Rule:    RulePasswordHistory,
+				Message: fmt.Sprintf("Do not reuse any of your last %d passwords", history),
+			}})
+		}
+	}
+	return nil
+}
+
+// recordPassword remembers a password the user just set so it cannot be set again too soon.
+// The password is already set, failures are only logged.
+func recordPassword(userRepo *repository.UserRepository, userID int, hashedPassword string) {
+	history := passwordPolicy.cfg.History
+	if history <= 0 {
+		return
+	}
+	if err := userRepo.AddPasswordHistory(userID, hashedPassword, history); err != nil {
+		logger.Errorf("failed to record the password history of user %d: %v", userID, err)
+	}
+}
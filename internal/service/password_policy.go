@@ -0,0 +1,254 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+	"veo/internal/configs"
+	"veo/pkg/errors"
+)
+
+// Defaults of the password policy settings left empty in the configuration
+const (
+	defaultMinPasswordLength = 8
+	defaultMaxPasswordLength = 72
+)
+
+// Rules of the password policy, named in the field errors of refused passwords
+const (
+	RuleMinLength        = "min_length"
+	RuleMaxLength        = "max_length"
+	RuleCharacterClasses = "character_classes"
+	RuleUsername         = "username"
+	RuleCommonPassword   = "common_password"
+	RuleEntropy          = "entropy"
+	RulePasswordHistory  = "history"
+)
+
+// Character classes a policy can require, with the number of characters each one offers to guess from
+var characterClasses = map[string]float64{
+	"lower":  26,
+	"upper":  26,
+	"digit":  10,
+	"symbol": 33,
+}
+
+// passwordPolicy checks every new password, UsePasswordPolicy replaces it with the configured one
+var passwordPolicy, _ = NewPasswordPolicy(configs.PasswordPolicyConfig{})
+
+// UsePasswordPolicy makes every new password follow the policy: at registration, when changing,
+// resetting or adding a password
+func UsePasswordPolicy(policy PasswordPolicy) {
+	passwordPolicy = policy
+}
+
+// PasswordPolicy checks new passwords against the configured rules
+type PasswordPolicy struct {
+	cfg    configs.PasswordPolicyConfig
+	common map[string]struct{}
+}
+
+// NewPasswordPolicy creates a new instance of PasswordPolicy and loads its list of common passwords.
+// It fails on an unknown character class or a list that cannot be read, the policy could not be enforced as configured.
+func NewPasswordPolicy(cfg configs.PasswordPolicyConfig) (PasswordPolicy, error) {
+	if cfg.MinLength <= 0 {
+		cfg.MinLength = defaultMinPasswordLength
+	}
+	if cfg.MaxLength <= 0 {
+		cfg.MaxLength = defaultMaxPasswordLength
+	}
+	if cfg.MinClasses > len(characterClasses) {
+		cfg.MinClasses = len(characterClasses)
+	}
+	for _, class := range cfg.RequiredClasses {
+		if _, ok := characterClasses[class]; !ok {
+			return PasswordPolicy{}, fmt.Errorf("unknown character class %q, use lower, upper, digit or symbol", class)
+		}
+	}
+
+	policy := PasswordPolicy{cfg: cfg}
+	if cfg.CommonPasswordsFile == "" {
+		return policy, nil
+	}
+	file, err := os.Open(cfg.CommonPasswordsFile)
+	if err != nil {
+		return PasswordPolicy{}, err
+	}
+	defer file.Close()
+
+	common := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		common[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return PasswordPolicy{}, err
+	}
+	policy.common = common
+	return policy, nil
+}
+
+// Check returns an InvalidParams error listing every rule the password breaks, field names the
+// password in the request so clients can show the errors next to it
+func (p *PasswordPolicy) Check(field, password, username string) error {
+	var violations []errors.FieldError
+	violate := func(rule, message string) {
+		violations = append(violations, errors.FieldError{Field: field, Rule: rule, Message: message})
+	}
+
+	if length := len([]rune(password)); length < p.cfg.MinLength {
+		violate(RuleMinLength, fmt.Sprintf("Use at least %d characters", p.cfg.MinLength))
+	}
+	if len(password) > p.cfg.MaxLength {
+		violate(RuleMaxLength, fmt.Sprintf("Use at most %d bytes", p.cfg.MaxLength))
+	}
+
+	classes := passwordClasses(password)
+	var missing []string
+	for _, class := range p.cfg.RequiredClasses {
+		if !classes[class] {
+			missing = append(missing, class)
+		}
+	}
+	if len(missing) > 0 {
+		violate(RuleCharacterClasses, "Add "+describeClasses(missing))
+	} else if len(classes) < p.cfg.MinClasses {
+		violate(RuleCharacterClasses, fmt.Sprintf("Mix at least %d of lower case letters, upper case letters, digits and symbols", p.cfg.MinClasses))
+	}
+
+	if p.cfg.RejectUsername && resemblesUsername(password, username) {
+		violate(RuleUsername, "Do not base the password on the username")
+	}
+	if _, ok := p.common[strings.ToLower(password)]; ok {
+		violate(RuleCommonPassword, "This password is too common or appeared in a data breach")
+	}
+	if p.cfg.MinEntropy > 0 && passwordEntropy(password) < p.cfg.MinEntropy {
+		violate(RuleEntropy, "This password is too easy to guess, make it longer or less repetitive")
+	}
+
+	if len(violations) > 0 {
+		return errors.NewFieldErrors("Password does not meet the password policy", violations)
+	}
+	return nil
+}
+
+// passwordClasses returns the character classes used by the password, characters outside ASCII count as symbols
+func passwordClasses(password string) map[string]bool {
+	classes := make(map[string]bool)
+	for _, r := range password {
+		classes[characterClass(r)] = true
+	}
+	return classes
+}
+
+// characterClass returns the character class of a character
+func characterClass(r rune) string {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return "lower"
+	case r >= 'A' && r <= 'Z':
+		return "upper"
+	case r >= '0' && r <= '9':
+		return "digit"
+	default:
+		return "symbol"
+	}
+}
+
+// describeClasses lists character classes for a message
+func describeClasses(classes []string) string {
+	names := map[string]string{"lower": "a lower case letter", "upper": "an upper case letter", "digit": "a digit", "symbol": "a symbol"}
+	described := make([]string, len(classes))
+	for i, class := range classes {
+		described[i] = names[class]
+	}
+	if len(described) == 1 {
+		return described[0]
+	}
+	return strings.Join(described[:len(described)-1], ", ") + " and " + described[len(described)-1]
+}
+
+// resemblesUsername tells whether the password contains the username, forwards or backwards,
+// is contained in it, or is a few typos away from it. Case and punctuation are ignored.
+func resemblesUsername(password, username string) bool {
+	pw, name := alphanumeric(password), alphanumeric(username)
+	if len(name) < 3 || len(pw) == 0 {
+		return false
+	}
+	if strings.Contains(pw, name) || strings.Contains(reverse(pw), name) || strings.Contains(name, pw) {
+		return true
+	}
+	return editDistance(pw, name) <= len([]rune(name))/4
+}
+
+// alphanumeric returns the letters and digits of s in lower case
+func alphanumeric(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// reverse returns s backwards
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+// passwordEntropy estimates the strength of the password in bits, as if each character was picked at random
+// among the classes it uses. Characters repeating the previous one or following it in a sequence,
+// as in aaa, abc or 321, add nothing.
+func passwordEntropy(password string) float64 {
+	pool := 0.0
+	for class := range passwordClasses(password) {
+		pool += characterClasses[class]
+	}
+
+	characters := 0
+	var previous rune
+	for i, r := range []rune(password) {
+		if i == 0 || (r != previous && r != previous+1 && r != previous-1) {
+			characters++
+		}
+		previous = r
+	}
+	if pool == 0 {
+		return 0
+	}
+	return float64(characters) * math.Log2(pool)
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"fmt"
+	"time"
+	"veo/internal/configs"
+	"veo/internal/models"
+	"veo/internal/repository"
+	"veo/internal/utils"
+	"veo/pkg/errors"
+)
+
+// defaultPasswordResetTTL is the lifetime of a reset link when none is configured
+const defaultPasswordResetTTL = time.Hour
+
+// Limits on requesting reset links, counted whether or not the address belongs to a user
+const (
+	passwordResetsPerEmail   = 3
+	passwordResetEmailWindow = 15 * time.Minute
+	passwordResetsPerIP      = 10
+	passwordResetIPWindow    = time.Hour
+)
+
+// PasswordResetService lets users who forgot their password set a new one with a link sent to their verified address
+type PasswordResetService struct {
+	passwordResetRepo *repository.PasswordResetRepository
+	userRepo          *repository.UserRepository
+	sessionService    SessionService
+	rateLimiter       RateLimiter
+	mailer            Mailer
+	cfg               configs.PasswordResetConfig
+}
+
+// NewPasswordResetService creates a new instance of PasswordResetService
+func NewPasswordResetService(passwordResetRepo *repository.PasswordResetRepository, userRepo *repository.UserRepository, sessionService SessionService, rateLimiter RateLimiter, mailer Mailer, cfg configs.PasswordResetConfig) PasswordResetService {
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaultPasswordResetTTL
+	}
+	return PasswordResetService{passwordResetRepo: passwordResetRepo, userRepo: userRepo, sessionService: sessionService, rateLimiter: rateLimiter, mailer: mailer, cfg: cfg}
+}
+
+// Request sends a reset link to the address if it is the verified address of a user. Like Request of
+// MagicLinkService, the answer only depends on the rate limits and the mail is sent in the background.
+func (s *PasswordResetService) Request(email, ip string) error {
+	address, ok := utils.NormalizeEmail(email)
+	if !ok {
+		return errors.NewInvalidParams("Invalid email address")
+	}
+	if err := s.rateLimiter.Allow("reset:ip:"+ip, passwordResetsPerIP, passwordResetIPWindow); err != nil {
+		return err
+	}
+	if err := s.rateLimiter.Allow("reset:email:"+address, passwordResetsPerEmail, passwordResetEmailWindow); err != nil {
+		return err
+	}
+
+	go s.send(address)
+	return nil
+}
+
+// Reset sets a new password with the token of a reset link. The token is used up, and every session,
+// token and API key of the user is revoked: whoever knew the old password is signed out.
+func (s *PasswordResetService) Reset(token, newPassword string) error {
+	reset, err := s.passwordResetRepo.GetByHash(utils.HashToken(token))
+	if err != nil {
+		return err
+	}
+	if reset == nil || reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+		return errors.NewAuthFailed("Invalid or expired reset link")
+	}
+
+	user, err := s.userRepo.GetUserByID(reset.UserID)
+	if err != nil {
+		return err
+	}
+
+	// Check and hash before using up the token, so a password that cannot be set leaves the link working
+	if err := passwordPolicy.Check("newPassword", newPassword, user.Username); err != nil {
+		return err
+	}
+	if err := checkPasswordReuse(s.userRepo, user, "newPassword", newPassword); err != nil {
+		return err
+	}
+	hashedPassword, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	used, err := s.passwordResetRepo.MarkUsed(reset.ID)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return errors.NewAuthFailed("Invalid or expired reset link")
+	}
+	if user.Password == "" {
+		err = s.userRepo.SetPassword(user.ID, hashedPassword)
+		if err == nil {
+			err = s.userRepo.IncrementTokenVersion(user.ID)
+		}
+	} else {
+		err = s.userRepo.UpdatePassword(user.ID, hashedPassword)
+	}
+	if err == nil {
+		err = s.userRepo.RevokeAPIKeys(user.ID)
+	}
+	if err != nil {
+		return err
+	}
+	recordPassword(s.userRepo, user.ID, hashedPassword)
+
+	if err := s.sessionService.RevokeOthers(user.ID, 0); err != nil {
+		return err
+	}
+	if err := s.passwordResetRepo.DeleteUnusedByUser(user.ID); err != nil {
+		logger.Errorf("failed to delete the other reset links of user %d: %v", user.ID, err)
+	}
+	logger.Warnf("user %d reset its password, every session and API key was revoked", user.ID)
+	return nil
+}
+
+// send mails a new reset link to the owner of the address, errors are logged since nobody waits for them
+func (s *PasswordResetService) send(address string) {
+	user, err := s.userRepo.GetUserByEmail(address)
+	if err != nil {
+		if e, ok := err.(*errors.Error); !ok || e.Code != errors.CodeUserNotFound {
+			logger.Errorf("failed to look up the owner of a reset link: %v", err)
+		}
+		return
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		logger.Errorf("failed to create a reset link: %v", err)
+		return
+	}
+	reset := &models.PasswordReset{TokenHash: utils.HashToken(token), UserID: user.ID, ExpiresAt: time.Now().Add(s.cfg.TTL)}
+	if err := s.passwordResetRepo.Create(reset); err != nil {
+		logger.Errorf("failed to store a reset link: %v", err)
+		return
+	}
+
+	mail := &Mail{
+		To:      address,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Open this link to choose a new password for the account %s:\n\n%s\n\n"+
+			"It expires in %s and works once. If you did not ask for it, ignore this mail: your password stays the same.\n",
+			user.Username, linkURL(s.cfg.URL, token), s.cfg.TTL),
+	}
+	if err := s.mailer.Send(mail); err != nil {
+		logger.Errorf("failed to send reset link %d: %v", reset.ID, err)
+	}
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"math/big"
+	"time"
+	"veo/internal/configs"
+	"veo/internal/models"
+	"veo/internal/repository"
+	"veo/internal/utils"
+	"veo/pkg/errors"
+)
+
+// defaultPhoneCodeTTL is the lifetime of a code sent by text message when none is configured
+const defaultPhoneCodeTTL = 5 * time.Minute
+
+// Limits on sending and entering codes. Sending is limited per number and per IP so numbers cannot
+// be flooded with messages, entering per code and per IP so codes cannot be guessed.
+const (
+	phoneCodesPerNumber   = 3
+	phoneCodeNumberWindow = 15 * time.Minute
+	phoneCodesPerIP       = 10
+	phoneCodeIPWindow     = time.Hour
+	phoneVerifiesPerIP    = 20
+	phoneVerifyIPWindow   = time.Hour
+	maxPhoneCodeAttempts  = 5
+)
+
+// PhoneService signs users in, and up, with one-time codes sent to their phone number by text message
+type PhoneService struct {
+	phoneCodeRepo *repository.PhoneCodeRepository
+	identityRepo  *repository.IdentityRepository
+	userRepo      *repository.UserRepository
+	rateLimiter   RateLimiter
+	sms           SMSProvider
+	cfg           configs.PhoneConfig
+}
+
+// NewPhoneService creates a new instance of PhoneService
+func NewPhoneService(phoneCodeRepo *repository.PhoneCodeRepository, identityRepo *repository.IdentityRepository, userRepo *repository.UserRepository, rateLimiter RateLimiter, sms SMSProvider, cfg configs.PhoneConfig) PhoneService {
+	if cfg.CodeTTL <= 0 {
+		cfg.CodeTTL = defaultPhoneCodeTTL
+	}
+	return PhoneService{phoneCodeRepo: phoneCodeRepo, identityRepo: identityRepo, userRepo: userRepo, rateLimiter: rateLimiter, sms: sms, cfg: cfg}
+}
+
+// Normalize returns the E.164 form of a phone number, with the configured country calling code for national numbers
+func (s *PhoneService) Normalize(phone string) (string, error) {
+	number, ok := utils.NormalizePhone(phone, s.cfg.DefaultCountryCode)
+	if !ok {
+		return "", errors.NewInvalidParams("Invalid phone number")
+	}
+	return number, nil
+}
+
+// SendCode sends a new code to the number, replacing the previous one. Codes are sent whether or not
+// the number belongs to a user, the same code signs in or signs up.
+func (s *PhoneService) SendCode(phone, ip string) error {
+	number, err := s.Normalize(phone)
+	if err != nil {
+		return err
+	}
+	if err := s.rateLimiter.Allow("sms:ip:"+ip, phoneCodesPerIP, phoneCodeIPWindow); err != nil {
+		return err
+	}
+	if err := s.rateLimiter.Allow("sms:phone:"+number, phoneCodesPerNumber, phoneCodeNumberWindow); err != nil {
+		return err
+	}
+
+	code, err := newPhoneCode()
+	if err != nil {
+		return err
+	}
+	if err := s.phoneCodeRepo.Replace(&models.PhoneCode{Phone: number, CodeHash: utils.HashToken(code), ExpiresAt: time.Now().Add(s.cfg.CodeTTL)}); err != nil {
+		return err
+	}
+	return s.sms.Send(number, fmt.Sprintf("Your veo code is %s. It expires in %s, do not share it.", code, s.cfg.CodeTTL))
+}
+
+// Verify checks the code sent to the number and returns the user the number signs in as.
+// The first sign-in of a number creates its user. A code is abandoned after too many wrong attempts.
+func (s *PhoneService) Verify(phone, code, ip string) (*models.User, error) {
+	number, err := s.Normalize(phone)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.rateLimiter.Allow("sms:verify:"+ip, phoneVerifiesPerIP, phoneVerifyIPWindow); err != nil {
+		return nil, err
+	}
+
+	sent, err := s.phoneCodeRepo.GetByPhone(number)
+	if err != nil {
+		return nil, err
+	}
+	if sent == nil || time.Now().After(sent.ExpiresAt) {
+		return nil, errors.NewAuthFailed("Invalid or expired code")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(utils.HashToken(code)), []byte(sent.CodeHash)) != 1 {
+		attempts, err := s.phoneCodeRepo.Fail(sent.ID)
+		if err != nil {
+			return nil, err
+		}
+		if attempts >= maxPhoneCodeAttempts {
+			if _, err := s.phoneCodeRepo.Delete(sent.ID); err != nil {
+				return nil, err
+			}
+			logger.Warnf("code sent to %s abandoned after %d wrong attempts", number, attempts)
+			return nil, errors.NewAuthFailed("Too many wrong codes, please request a new one")
+		}
+		return nil, errors.NewAuthFailed("Invalid or expired code")
+	}
+
+	deleted, err := s.phoneCodeRepo.Delete(sent.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !deleted {
+		return nil, errors.NewAuthFailed("Invalid or expired code")
+	}
+	return s.signIn(number)
+}
+
+// signIn returns the user owning the number, creating it on the first sign-in of the number
+func (s *PhoneService) signIn(number string) (*models.User, error) {
+	identity, err := s.identityRepo.GetBySubject(models.IdentityPhone, "", number)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if identity != nil {
+		if err := s.identityRepo.Touch(identity.ID, now); err != nil {
+			return nil, err
+		}
+		if err := s.userRepo.SetPhoneVerified(identity.UserID, now); err != nil {
+			return nil, err
+		}
+		return &identity.User, nil
+	}
+
+	// Usernames are not derived from the number, which they would disclose
+	suffix, err := utils.RandomToken(6)
+	if err != nil {
+		return nil, err
+	}
+	user := &models.User{Username: "user-" + suffix, Phone: &number, PhoneVerifiedAt: &now}
+	if err := createUser(s.userRepo, user); err != nil {
+		return nil, err
+	}
+	logger.Infof("created user %d on its first sign-in by phone", user.ID)
+	return user, nil
+}
+
+// newPhoneCode returns a random 6-digit code
+func newPhoneCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
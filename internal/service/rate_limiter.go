@@ -0,0 +1,33 @@
+package service
+
+import (
+	"time"
+	"veo/internal/repository"
+	"veo/pkg/errors"
+)
+
+// RateLimiter limits how often something may be done, e.g. requesting codes for an address or from an IP
+type RateLimiter struct {
+	rateLimitRepo *repository.RateLimitRepository
+}
+
+// NewRateLimiter creates a new instance of RateLimiter
+func NewRateLimiter(rateLimitRepo *repository.RateLimitRepository) RateLimiter {
+	return RateLimiter{rateLimitRepo: rateLimitRepo}
+}
+
+// Allow counts a request against the key and returns a TooManyRequests error once more than limit
+// requests were made in the window
+func (l *RateLimiter) Allow(key string, limit int, window time.Duration) error {
+	count, err := l.rateLimitRepo.Hit(key, window)
+	if err != nil {
+		return err
+	}
+	if count > limit {
+		if count == limit+1 {
+			logger.Warnf("rate limit of %d per %s reached for %s", limit, window, key)
+		}
+		return errors.NewTooManyRequests("Too many requests, please try again later")
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"time"
+	"veo/internal/models"
+	"veo/internal/repository"
+	"veo/pkg/errors"
+)
+
+// DefaultMaxSessions is used when no limit of concurrent sessions per user is configured
+const DefaultMaxSessions = 10
+
+// RecentAuthWindow is how long after signing in or confirming their password users may make sensitive changes,
+// such as linking or unlinking a way to sign in
+const RecentAuthWindow = 10 * time.Minute
+
+// Column sizes of the client supplied session details
+const (
+	maxDeviceLength    = 255
+	maxUserAgentLength = 512
+)
+
+// SessionService handles the login sessions of users
+type SessionService struct {
+	sessionRepo *repository.SessionRepository
+	refreshRepo *repository.RefreshTokenRepository
+	ttl         time.Duration
+	maxSessions int
+}
+
+// NewSessionService creates a new instance of SessionService.
+// Sessions last ttl from their last refresh, a user has at most maxSessions of them at once.
+func NewSessionService(sessionRepo *repository.SessionRepository, refreshRepo *repository.RefreshTokenRepository, ttl time.Duration, maxSessions int) SessionService {
+	if ttl <= 0 {
+		ttl = DefaultRefreshTokenTTL
+	}
+	if maxSessions <= 0 {
+		maxSessions = DefaultMaxSessions
+	}
+	return SessionService{sessionRepo: sessionRepo, refreshRepo: refreshRepo, ttl: ttl, maxSessions: maxSessions}
+}
+
+// Start records a new login session of the user. When the user already has the maximum
+// number of sessions, the oldest ones are revoked to make room.
+func (s *SessionService) Start(user *models.User, device, userAgent, ip string) (*models.Session, error) {
+	return s.start(user, &models.Session{Device: device, UserAgent: userAgent, IP: ip})
+}
+
+// StartPasswordChange records a login session of a user who must change its password first.
+// Its tokens only grant changing the password.
+func (s *SessionService) StartPasswordChange(user *models.User, device, userAgent, ip string) (*models.Session, error) {
+	return s.start(user, &models.Session{Scope: models.ScopePasswordChange, Device: device, UserAgent: userAgent, IP: ip})
+}
+
+// StartGrant records the session of an OAuth client acting for the user with the approved scope.
+// It counts towards the sessions of the user and shows up under the name of the client.
+func (s *SessionService) StartGrant(user *models.User, client *models.OAuthClient, scope, userAgent, ip string) (*models.Session, error) {
+	return s.start(user, &models.Session{ClientID: client.ClientID, Scope: scope, Device: client.Name, UserAgent: userAgent, IP: ip})
+}
+
+// StartClient records the session of an OAuth client acting on its own behalf, which lasts ttl.
+func (s *SessionService) StartClient(client *models.OAuthClient, scope string, ttl time.Duration) (*models.Session, error) {
+	if err := s.sessionRepo.DeleteExpiredClientSessions(client.ClientID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &models.Session{
+		ClientID:        client.ClientID,
+		Scope:           scope,
+		Device:          client.Name,
+		ExpiresAt:       now.Add(ttl),
+		LastSeenAt:      now,
+		AuthenticatedAt: now,
+	}
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// start stores the session of the user, evicting the oldest sessions beyond the limit
+func (s *SessionService) start(user *models.User, session *models.Session) (*models.Session, error) {
+	if err := s.sessionRepo.DeleteInactiveByUser(user.ID); err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.sessionRepo.ListActiveByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i <= len(sessions)-s.maxSessions; i++ {
+		logger.Infof("user %d reached %d sessions, revoking session %d", user.ID, s.maxSessions, sessions[i].ID)
+		if err := s.end(sessions[i].ID); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	session.UserID = user.ID
+	session.TokenVersion = user.TokenVersion
+	session.Device = truncate(session.Device, maxDeviceLength)
+	session.UserAgent = truncate(session.UserAgent, maxUserAgentLength)
+	session.ExpiresAt = now.Add(s.ttl)
+	session.LastSeenAt = now
+	session.AuthenticatedAt = now
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Reauthenticate records that the user of the session just confirmed who they are
+func (s *SessionService) Reauthenticate(sessionID int) error {
+	return s.sessionRepo.SetAuthenticatedAt(sessionID, time.Now())
+}
+
+// RequireRecentAuth fails unless the user of the session signed in or confirmed who they are within RecentAuthWindow
+func (s *SessionService) RequireRecentAuth(sessionID int) error {
+	session, err := s.sessionRepo.GetByID(sessionID)
+	if err != nil {
+		return err
+	}
+	if session == nil || time.Since(session.AuthenticatedAt) > RecentAuthWindow {
+		return errors.NewReauthRequired("Please confirm your password or sign in again")
+	}
+	return nil
+}
+
+// RecentSession returns the interactive session of a user who signed in or confirmed their password recently,
+// for sensitive changes completed by a request that carries none of its tokens, such as the redirect back
+// from an identity provider. Revoked, expired and signed out sessions, and those of OAuth clients, are refused.
+func (s *SessionService) RecentSession(sessionID int) (*models.Session, error) {
+	session, err := s.sessionRepo.GetByID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.ClientID != "" || session.Scope != "" || time.Now().After(session.ExpiresAt) ||
+		session.TokenVersion != session.User.TokenVersion {
+		return nil, errors.NewTokenExpired("Session has been revoked")
+	}
+	if time.Since(session.AuthenticatedAt) > RecentAuthWindow {
+		return nil, errors.NewReauthRequired("Please confirm your password or sign in again")
+	}
+	return session, nil
+}
+
+// Extend pushes back the expiry of a session after its tokens were refreshed
+func (s *SessionService) Extend(session *models.Session) error {
+	now := time.Now()
+	session.LastSeenAt = now
+	session.ExpiresAt = now.Add(s.ttl)
+	return s.sessionRepo.Touch(session.ID, session.LastSeenAt, session.ExpiresAt)
+}
+
+// List returns the active sessions of the user, oldest first
+func (s *SessionService) List(userID int) ([]models.Session, error) {
+	return s.sessionRepo.ListActiveByUser(userID)
+}
+
+// Revoke ends a session of the user, along with its access and refresh tokens
+func (s *SessionService) Revoke(userID, sessionID int) error {
+	session, err := s.sessionRepo.GetByID(sessionID)
+	if err != nil {
+		return err
+	}
+	if session == nil || session.UserID != userID {
+		return errors.NewInvalidParams("Session does not exist")
+	}
+	return s.end(sessionID)
+}
+
+// RevokeOthers ends every session of the user except the current one
+func (s *SessionService) RevokeOthers(userID, currentID int) error {
+	sessions, err := s.sessionRepo.ListActiveByUser(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if session.ID == currentID {
+			continue
+		}
+		if err := s.end(session.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// end deletes a session and revokes the refresh tokens issued for it
+func (s *SessionService) end(sessionID int) error {
+	if err := s.refreshRepo.RevokeSession(sessionID); err != nil {
+		return err
+	}
+	return s.sessionRepo.Delete(sessionID)
+}
+
+// truncate cuts s to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"fmt"
+	"veo/internal/configs"
+)
+
+// SMSProvider sends text messages to phone numbers
+type SMSProvider interface {
+	Send(to, message string) error
+}
+
+// NewSMSProvider creates the SMS provider selected by the configuration
+func NewSMSProvider(cfg configs.PhoneConfig) (SMSProvider, error) {
+	switch cfg.Provider {
+	case "", "log":
+		return LogSMSProvider{}, nil
+	}
+	return nil, fmt.Errorf("unknown SMS provider %q", cfg.Provider)
+}
+
+// LogSMSProvider writes text messages to the log instead of sending them, for development
+type LogSMSProvider struct{}
+
+// Send logs the message and its recipient
+func (LogSMSProvider) Send(to, message string) error {
+	logger.Infof("SMS to %s: %s", to, message)
+	return nil
+}
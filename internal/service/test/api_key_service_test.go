@@ -0,0 +1,80 @@
+package service_test
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"veo/internal/configs"
+	"veo/internal/database"
+	"veo/internal/models"
+	"veo/internal/repository"
+	"veo/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Initializes the test database and returns an APIKeyService instance.
+func setupTestAPIKeyService(t *testing.T) service.APIKeyService {
+	cfg, err := configs.Load("../../../config/config.yaml")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := database.Init(cfg.Database); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	return service.NewAPIKeyService(repository.NewAPIKeyRepository(database.GetDB()))
+}
+
+// Test creating, listing and revoking API keys.
+func TestAPIKeyLifecycle(t *testing.T) {
+	service := setupTestAPIKeyService(t)
+
+	// Scopes are checked and the key is only returned once
+	_, _, err := service.Create(1, "ci", []string{models.ScopeAccount}, nil)
+	assert.Error(t, err, "Account scope was granted to an API key")
+	_, _, err = service.Create(1, "ci", nil, nil)
+	assert.Error(t, err, "API key without scope was created")
+	past := time.Now().Add(-time.Hour)
+	_, _, err = service.Create(1, "ci", []string{models.ScopeProfile}, &past)
+	assert.Error(t, err, "API key expiring in the past was created")
+
+	key, plain, err := service.Create(1, "ci", []string{models.ScopeProfile, models.ScopeProfile}, nil)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(plain, models.APIKeyPrefix))
+	assert.True(t, strings.HasPrefix(plain, key.Prefix))
+	assert.Equal(t, models.ScopeProfile, key.Scopes)
+	assert.NotContains(t, key.KeyHash, plain)
+
+	keys, err := service.List(1)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, key.ID, keys[0].ID)
+
+	// Keys can only be revoked by their owner, once
+	assert.Error(t, service.Revoke(2, key.ID))
+	assert.NoError(t, service.Revoke(1, key.ID))
+	assert.Error(t, service.Revoke(1, key.ID))
+}
+
+// Test that signing out everywhere revokes the API keys of the user.
+func TestSignOutEverywhereRevokesAPIKeys(t *testing.T) {
+	service := setupTestAPIKeyService(t)
+	users := setupTestUserService(t)
+	user, err := users.Register(fmt.Sprintf("keys-%d", time.Now().UnixNano()), "Str0ng!Passw0rd")
+	require.NoError(t, err)
+	defer users.DeleteUser(user.ID)
+
+	_, _, err = service.Create(user.ID, "ci", []string{models.ScopeProfile}, nil)
+	require.NoError(t, err)
+	assert.NoError(t, users.SignOutEverywhere(user.ID))
+
+	keys, err := service.List(user.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, keys, "API key survived sign out everywhere")
+}
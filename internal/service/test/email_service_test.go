@@ -0,0 +1,87 @@
+package service_test
+
+import (
+	"fmt"
+	"log"
+	"testing"
+	"time"
+
+	"veo/internal/configs"
+	"veo/internal/database"
+	"veo/internal/repository"
+	"veo/internal/service"
+	"veo/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Initializes the test database and returns an EmailService sending mail to the capture mailer, and a UserService.
+func setupTestEmailService(t *testing.T, mailer service.Mailer) (service.EmailService, service.UserService) {
+	cfg, err := configs.Load("../../../config/config.yaml")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := database.Init(cfg.Database); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := database.GetDB()
+	emails := service.NewEmailService(repository.NewUserRepository(db), service.NewRateLimiter(repository.NewRateLimitRepository(db)), mailer,
+		configs.EmailConfig{VerifyURL: "http://localhost:8080/email/verify", RequireVerified: true}, []byte("secret"))
+	return emails, service.NewUserService(repository.NewUserRepository(db))
+}
+
+// Test verifying the address given at registration, then changing it.
+func TestEmailVerification(t *testing.T) {
+	mailer := make(captureMailer, 10)
+	emails, users := setupTestEmailService(t, mailer)
+
+	user, err := users.Register(fmt.Sprintf("email-%d", time.Now().UnixNano()), "password")
+	require.NoError(t, err)
+	defer users.DeleteUser(user.ID)
+	first := fmt.Sprintf("first-%d@example.test", time.Now().UnixNano())
+	second := fmt.Sprintf("second-%d@example.test", time.Now().UnixNano())
+
+	assert.NoError(t, emails.ChangeEmail(user, first))
+	link := mailer.receive()
+	if !assert.NotNil(t, link, "No verification link was sent") {
+		return
+	}
+	assert.Equal(t, first, link.To)
+
+	// Signing in is refused until the address is verified
+	err = emails.CheckVerified(user)
+	if e, ok := err.(*errors.Error); assert.True(t, ok) {
+		assert.Equal(t, errors.CodeEmailNotVerified, e.Code)
+	}
+	mailer.receive()
+
+	verified, err := emails.Verify(linkToken(t, link))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, first, *verified.Email)
+	assert.Empty(t, verified.PendingEmail)
+	assert.NoError(t, emails.CheckVerified(verified))
+
+	_, err = emails.Verify(linkToken(t, link))
+	assert.Error(t, err, "Link verified twice")
+
+	// Changing the address tells the current one, which stays in use until the new one is verified
+	assert.NoError(t, emails.ChangeEmail(verified, second))
+	link, notice := mailer.receive(), mailer.receive()
+	if !assert.NotNil(t, link) || !assert.NotNil(t, notice) {
+		return
+	}
+	assert.Equal(t, second, link.To)
+	assert.Equal(t, first, notice.To)
+	current, _ := users.GetUserByID(user.ID)
+	assert.Equal(t, first, *current.Email)
+
+	verified, err = emails.Verify(linkToken(t, link))
+	if assert.NoError(t, err) {
+		assert.Equal(t, second, *verified.Email)
+	}
+}
@@ -0,0 +1,164 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"veo/internal/api/common"
+	v1 "veo/internal/api/v1"
+	"veo/internal/configs"
+	"veo/internal/database"
+	"veo/internal/models"
+	"veo/internal/repository"
+	"veo/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Initializes the test database and returns a FederationService signing in with the fake provider.
+func setupTestFederationService(t *testing.T, idp *fakeIdP) service.FederationService {
+	cfg, err := configs.Load("../../../config/config.yaml")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := database.Init(cfg.Database); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := database.GetDB()
+	providers := map[string]service.IdentityProvider{"corp": service.NewOIDCProvider(idp.config(), nil)}
+	return service.NewFederationService(providers, repository.NewIdentityRepository(db), repository.NewUserRepository(db), []byte(cfg.OIDC.LinkSecret))
+}
+
+// Test that users are created on their first sign-in and found again afterwards.
+func TestFederatedSignIn(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.subject = fmt.Sprintf("federated-%d", time.Now().UnixNano())
+	federation := setupTestFederationService(t, idp)
+	ctx := context.Background()
+
+	signIn := func() (*service.FederationRequest, string) {
+		request, authorizationURL, err := federation.Begin(ctx, "corp", 0)
+		require.NoError(t, err)
+		return request, idp.authorize(t, authorizationURL)
+	}
+
+	request, code := signIn()
+	first, err := federation.Complete(ctx, "corp", request, request.State, code)
+	require.NoError(t, err)
+	assert.NotZero(t, first.ID)
+	assert.Contains(t, first.Username, "jane")
+
+	request, code = signIn()
+	second, err := federation.Complete(ctx, "corp", request, request.State, code)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, second.ID, "Identity signed in as another user")
+
+	// The callback must come back to the browser that started the sign-in
+	request, code = signIn()
+	_, err = federation.Complete(ctx, "corp", request, "forged", code)
+	assert.Error(t, err, "Forged state accepted")
+	_, err = federation.Complete(ctx, "corp", nil, request.State, code)
+	assert.Error(t, err, "Sign-in completed without its request")
+	_, _, err = federation.Begin(ctx, "unknown", 0)
+	assert.Error(t, err, "Unknown provider accepted")
+
+	users := setupTestUserService(t)
+	assert.NoError(t, users.DeleteUser(first.ID))
+}
+
+// Test that a user signed in with a Bearer token links an identity through the callback,
+// which the browser follows with the sign-in cookie only.
+func TestLinkFromCallback(t *testing.T) {
+	cfg, err := configs.Load("../../../config/config.yaml")
+	require.NoError(t, err)
+	require.NoError(t, database.Init(cfg.Database))
+	require.NoError(t, common.InitJWT(cfg.JWT))
+	db := database.GetDB()
+
+	idp := newFakeIdP(t)
+	idp.subject = fmt.Sprintf("linked-%d", time.Now().UnixNano())
+	federation := setupTestFederationService(t, idp)
+	sessionRepo := repository.NewSessionRepository(db)
+	refreshRepo := repository.NewRefreshTokenRepository(db)
+	sessions := service.NewSessionService(sessionRepo, refreshRepo, cfg.JWT.RefreshTokenTTL, 3)
+	issuer := v1.NewTokenIssuer(service.NewTokenService(refreshRepo, sessionRepo, cfg.JWT.RefreshTokenTTL), sessions)
+	users := setupTestUserService(t)
+	common.UseSessionStrategy(common.NewJWTStrategy(sessionRepo))
+	common.UseTokenVersionSource(&users)
+	defer common.UseTokenVersionSource(nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	v1.SetupFederationRouter(router, v1.NewFederationAPI(federation, service.NewMFAService(repository.NewMFARepository(db), ""), issuer))
+	identities := service.NewIdentityService(repository.NewIdentityRepository(db), repository.NewUserRepository(db))
+	v1.SetupIdentityRouter(router, v1.NewIdentityAPI(identities, federation, users, sessions, setupTestLockoutService(t, cfg.Lockout)))
+
+	user, err := users.Register(fmt.Sprintf("linker%d", time.Now().UnixNano()), "Str0ng!Passw0rd")
+	require.NoError(t, err)
+	defer users.DeleteUser(user.ID)
+	session, err := sessions.Start(user, "test", "", "")
+	require.NoError(t, err)
+	token, err := common.IssueAccessToken(user, session)
+	require.NoError(t, err)
+
+	do := func(method, target, token string, cookie *http.Cookie) (*httptest.ResponseRecorder, common.Response) {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp common.Response
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+	// begin starts linking with the Bearer token and returns the sign-in cookie and the callback of the provider
+	begin := func() (*http.Cookie, string) {
+		w, resp := do(http.MethodPost, "/api/identities/oidc/corp", token, nil)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Message)
+		var link v1.ProviderLink
+		data, _ := json.Marshal(resp.Data)
+		require.NoError(t, json.Unmarshal(data, &link))
+		require.NotEmpty(t, w.Result().Cookies())
+		state := mustQuery(t, link.AuthorizationURL).Get("state")
+		code := idp.authorize(t, link.AuthorizationURL)
+		return w.Result().Cookies()[0], "/api/oidc/corp/callback?" + url.Values{"state": {state}, "code": {code}}.Encode()
+	}
+
+	// The cookie cannot be moved to another session
+	cookie, callback := begin()
+	parts := strings.Split(cookie.Value, ".")
+	parts[3] = fmt.Sprint(session.ID + 1)
+	_, resp := do(http.MethodGet, callback, "", &http.Cookie{Name: cookie.Name, Value: strings.Join(parts, ".")})
+	assert.NotEqual(t, http.StatusOK, resp.Code, "Edited session accepted")
+
+	// A session that has not confirmed the password since linking started cannot finish it
+	cookie, callback = begin()
+	assert.NoError(t, db.Model(&models.Session{}).Where("id = ?", session.ID).Update("authenticated_at", time.Now().Add(-time.Hour)).Error)
+	_, resp = do(http.MethodGet, callback, "", cookie)
+	assert.NotEqual(t, http.StatusOK, resp.Code, "Stale session linked an identity")
+	assert.NoError(t, sessions.Reauthenticate(session.ID))
+
+	// The callback carries the cookie but no token
+	cookie, callback = begin()
+	_, resp = do(http.MethodGet, callback, "", cookie)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Message)
+	linked, err := identities.List(user.ID)
+	require.NoError(t, err)
+	assert.Len(t, linked, 2, "Identity was not linked")
+}
@@ -0,0 +1,52 @@
+package service_test
+
+import (
+	"fmt"
+	"log"
+	"testing"
+	"time"
+
+	"veo/internal/configs"
+	"veo/internal/database"
+	"veo/internal/models"
+	"veo/internal/repository"
+	"veo/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Initializes the test database and returns IdentityService and UserService instances.
+func setupTestIdentityService(t *testing.T) (service.IdentityService, service.UserService) {
+	cfg, err := configs.Load("../../../config/config.yaml")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := database.Init(cfg.Database); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := database.GetDB()
+	userRepo := repository.NewUserRepository(db)
+	return service.NewIdentityService(repository.NewIdentityRepository(db), userRepo), service.NewUserService(userRepo)
+}
+
+// Test that registering links a password identity, which cannot be removed while it is the only one.
+func TestUnlinkLastIdentity(t *testing.T) {
+	identities, users := setupTestIdentityService(t)
+
+	user, err := users.Register(fmt.Sprintf("identity-%d", time.Now().UnixNano()), "password")
+	require.NoError(t, err)
+	defer users.DeleteUser(user.ID)
+
+	linked, err := identities.List(user.ID)
+	require.NoError(t, err)
+	if assert.Len(t, linked, 1) {
+		assert.Equal(t, models.IdentityPassword, linked[0].Type)
+		assert.Error(t, identities.Unlink(user.ID, linked[0].ID), "Last identity was removed")
+		assert.Error(t, identities.Unlink(user.ID+1, linked[0].ID), "Identity of another user was removed")
+	}
+
+	assert.Error(t, identities.SetPassword(user.ID, "other"), "Password was replaced without the old one")
+}
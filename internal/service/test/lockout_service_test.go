@@ -0,0 +1,85 @@
+package service_test
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"veo/internal/configs"
+	"veo/internal/database"
+	"veo/internal/repository"
+	"veo/internal/service"
+	"veo/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Initializes the test database and returns a LockoutService with the given settings.
+func setupTestLockoutService(t *testing.T, lockout configs.LockoutConfig) service.LockoutService {
+	cfg, err := configs.Load("../../../config/config.yaml")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := database.Init(cfg.Database); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	return service.NewLockoutService(repository.NewLoginFailureRepository(database.GetDB()), lockout)
+}
+
+// wrongPassword is a password check that always fails
+func wrongPassword() error {
+	return errors.NewAuthFailed("Invalid password")
+}
+
+// errorCode returns the code of an error from the errors package, or 0
+func errorCode(err error) errors.ErrorCode {
+	if e, ok := err.(*errors.Error); ok {
+		return e.Code
+	}
+	return 0
+}
+
+// Test that failures delay the next attempt, then lock the username out until it is unlocked.
+func TestLockout(t *testing.T) {
+	lockout := setupTestLockoutService(t, configs.LockoutConfig{BackoffAfter: 2, MaxFailures: 3, IPMaxFailures: 100})
+	username := fmt.Sprintf("lockout-%d", time.Now().UnixNano())
+	ip := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	defer lockout.Unlock(username)
+
+	assert.Equal(t, errors.CodeAuthFailed, errorCode(lockout.Attempt(username, ip, wrongPassword)))
+	assert.Equal(t, errors.CodeAuthFailed, errorCode(lockout.Attempt(username, ip, wrongPassword)))
+
+	// The next attempt must wait, and does not run the check
+	checked := false
+	err := lockout.Attempt(username, ip, func() error { checked = true; return nil })
+	assert.Equal(t, errors.CodeTooManyRequests, errorCode(err))
+	assert.False(t, checked)
+
+	time.Sleep(1100 * time.Millisecond)
+	assert.Equal(t, errors.CodeAuthFailed, errorCode(lockout.Attempt(username, ip, wrongPassword)))
+
+	// Locked out, whatever the case of the username and even from another IP
+	err = lockout.Attempt(" "+strings.ToUpper(username)+" ", "other-"+ip, func() error { return nil })
+	assert.Equal(t, errors.CodeAccountLocked, errorCode(err))
+
+	assert.NoError(t, lockout.Unlock(username))
+	assert.NoError(t, lockout.Attempt(username, "other-"+ip, func() error { return nil }))
+}
+
+// Test that a correct password followed by wrong second factor codes does not forget earlier failures.
+func TestLockoutFirstFactor(t *testing.T) {
+	lockout := setupTestLockoutService(t, configs.LockoutConfig{BackoffAfter: 10, MaxFailures: 3, IPMaxFailures: 100})
+	username := fmt.Sprintf("lockout-mfa-%d", time.Now().UnixNano())
+	ip := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	defer lockout.Unlock(username)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, lockout.AttemptFirstFactor(username, ip, func() error { return nil }))
+		assert.Equal(t, errors.CodeAuthFailed, errorCode(lockout.Attempt(username, ip, wrongPassword)), "Wrong code %d", i+1)
+	}
+	assert.Equal(t, errors.CodeAccountLocked, errorCode(lockout.AttemptFirstFactor(username, ip, func() error { return nil })))
+}
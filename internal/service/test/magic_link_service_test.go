@@ -0,0 +1,134 @@
+package service_test
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"veo/internal/configs"
+	"veo/internal/database"
+	"veo/internal/repository"
+	"veo/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureMailer hands the mail it is asked to send to the test
+type captureMailer chan *service.Mail
+
+func (m captureMailer) Send(mail *service.Mail) error {
+	m <- mail
+	return nil
+}
+
+// receive waits for the next mail, returning nil if none is sent in time
+func (m captureMailer) receive() *service.Mail {
+	select {
+	case mail := <-m:
+		return mail
+	case <-time.After(2 * time.Second):
+		return nil
+	}
+}
+
+// linkPattern finds the link in a mail
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+// linkToken returns the token of the link in the mail
+func linkToken(t *testing.T, mail *service.Mail) string {
+	link, err := url.Parse(linkPattern.FindString(mail.Body))
+	if err != nil {
+		t.Fatalf("Failed to parse link: %v", err)
+	}
+	return link.Query().Get("token")
+}
+
+// Initializes the test database and returns a MagicLinkService sending mail to the capture mailer, and a UserService.
+func setupTestMagicLinkService(t *testing.T, mailer service.Mailer) (service.MagicLinkService, service.UserService) {
+	cfg, err := configs.Load("../../../config/config.yaml")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := database.Init(cfg.Database); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := database.GetDB()
+	magicLinks := service.NewMagicLinkService(repository.NewMagicLinkRepository(db), repository.NewIdentityRepository(db),
+		repository.NewUserRepository(db), service.NewRateLimiter(repository.NewRateLimitRepository(db)), mailer,
+		configs.MagicLinkConfig{URL: "http://localhost:8080/login/magic", AllowedDomains: []string{"example.test"}}, []byte("secret"))
+	return magicLinks, service.NewUserService(repository.NewUserRepository(db))
+}
+
+// Test that the file mailer writes a message with encoded headers and refuses header injection.
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer, err := service.NewMailer(configs.MailConfig{Driver: "file", Dir: dir, From: "veo <no-reply@example.test>"})
+	require.NoError(t, err)
+
+	assert.NoError(t, mailer.Send(&service.Mail{To: "bob@example.test", Subject: "Connexion à veo", Body: "line one\nline two"}))
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if !assert.Len(t, files, 1) {
+		return
+	}
+	message, _ := os.ReadFile(files[0])
+	assert.Contains(t, string(message), "To: bob@example.test\r\n")
+	assert.Contains(t, string(message), "Subject: =?utf-8?q?Connexion_=C3=A0_veo?=\r\n")
+	assert.Contains(t, string(message), "\r\n\r\nline one\r\nline two")
+
+	err = mailer.Send(&service.Mail{To: "bob@example.test\r\nBcc: eve@example.test", Subject: "Hello"})
+	assert.Error(t, err, "Header injection was accepted")
+}
+
+// Test signing up and signing in with links, and that links are single-use and rate limited.
+func TestMagicLinkSignIn(t *testing.T) {
+	mailer := make(captureMailer, 10)
+	magicLinks, users := setupTestMagicLinkService(t, mailer)
+	ip := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	address := fmt.Sprintf("magic-%d@example.test", time.Now().UnixNano())
+
+	// The first sign-in of an address of an allowed domain creates its user
+	assert.NoError(t, magicLinks.Request(address, ip))
+	mail := mailer.receive()
+	if !assert.NotNil(t, mail, "No link was sent") {
+		return
+	}
+	assert.Equal(t, address, mail.To)
+	token := linkToken(t, mail)
+	user, err := magicLinks.Verify(token)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer users.DeleteUser(user.ID)
+
+	_, err = magicLinks.Verify(token)
+	assert.Error(t, err, "Link signed in twice")
+	_, err = magicLinks.Verify("x" + token)
+	assert.Error(t, err, "Tampered link was accepted")
+
+	// Addresses are matched case-insensitively
+	assert.NoError(t, magicLinks.Request("  "+strings.ToUpper(address), ip))
+	mail = mailer.receive()
+	if assert.NotNil(t, mail, "No link was sent") {
+		signedIn, err := magicLinks.Verify(linkToken(t, mail))
+		if assert.NoError(t, err) {
+			assert.Equal(t, user.ID, signedIn.ID)
+		}
+	}
+
+	// Unknown addresses get the same answer but no mail
+	assert.NoError(t, magicLinks.Request(fmt.Sprintf("nobody-%d@example.org", time.Now().UnixNano()), ip))
+	assert.Nil(t, mailer.receive(), "A link was sent to an unknown address")
+
+	assert.NoError(t, magicLinks.Request(address, ip))
+	mailer.receive()
+	assert.Error(t, magicLinks.Request(address, ip), "Rate limit was not applied")
+}
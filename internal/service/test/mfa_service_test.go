@@ -0,0 +1,104 @@
+package service_test
+
+import (
+	"fmt"
+	"log"
+	"testing"
+	"time"
+
+	"veo/internal/configs"
+	"veo/internal/database"
+	"veo/internal/repository"
+	"veo/internal/service"
+	"veo/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Initializes the test database and returns MFAService and UserService instances.
+func setupTestMFAService(t *testing.T) (service.MFAService, service.UserService) {
+	cfg, err := configs.Load("../../../config/config.yaml")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := database.Init(cfg.Database); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := database.GetDB()
+	return service.NewMFAService(repository.NewMFARepository(db), "veo"), service.NewUserService(repository.NewUserRepository(db))
+}
+
+// Test TOTP codes against the SHA-1 test vectors of RFC 6238 appendix B, truncated to 6 digits.
+func TestTOTPCode(t *testing.T) {
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // "12345678901234567890"
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, expected := range vectors {
+		code, err := utils.TOTPCode(secret, utils.TOTPStep(time.Unix(unix, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, code, "Wrong code at %d", unix)
+	}
+}
+
+// Test enrolling an authenticator app and completing sign-ins with its codes and a recovery code.
+func TestMFAChallenge(t *testing.T) {
+	mfa, users := setupTestMFAService(t)
+
+	user, err := users.Register(fmt.Sprintf("mfa-%d", time.Now().UnixNano()), "password")
+	require.NoError(t, err)
+	defer users.DeleteUser(user.ID)
+
+	enrollment, err := mfa.Enroll(user)
+	require.NoError(t, err)
+	assert.Contains(t, enrollment.URI, "secret="+enrollment.Secret)
+
+	step := utils.TOTPStep(time.Now())
+	code, _ := utils.TOTPCode(enrollment.Secret, step)
+	recoveryCodes, err := mfa.Confirm(user.ID, code)
+	require.NoError(t, err)
+	require.Len(t, recoveryCodes, 10)
+
+	enabled, err := mfa.Enabled(user.ID)
+	assert.NoError(t, err)
+	assert.True(t, enabled)
+
+	// The code used to confirm the app cannot sign in
+	token, err := mfa.StartChallenge(user.ID)
+	assert.NoError(t, err)
+	_, err = mfa.CompleteChallenge(token, code)
+	assert.Error(t, err, "Code was accepted twice")
+
+	next, _ := utils.TOTPCode(enrollment.Secret, step+1)
+	signedIn, err := mfa.CompleteChallenge(token, next)
+	if assert.NoError(t, err) {
+		assert.Equal(t, user.ID, signedIn.ID)
+	}
+	_, err = mfa.CompleteChallenge(token, next)
+	assert.Error(t, err, "Challenge was completed twice")
+
+	// Recovery codes work once, whatever the case and dashes
+	token, _ = mfa.StartChallenge(user.ID)
+	_, err = mfa.CompleteChallenge(token, recoveryCodes[0])
+	assert.NoError(t, err)
+	token, _ = mfa.StartChallenge(user.ID)
+	_, err = mfa.CompleteChallenge(token, recoveryCodes[0])
+	assert.Error(t, err, "Recovery code was accepted twice")
+
+	// Too many wrong codes abandon the sign-in
+	for i := 0; i < 4; i++ {
+		_, _ = mfa.CompleteChallenge(token, "000000")
+	}
+	_, err = mfa.CompleteChallenge(token, recoveryCodes[1])
+	assert.Error(t, err, "Challenge survived too many wrong codes")
+
+	assert.NoError(t, mfa.Reset(user.ID))
+	enabled, _ = mfa.Enabled(user.ID)
+	assert.False(t, enabled)
+}
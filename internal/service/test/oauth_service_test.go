@@ -0,0 +1,167 @@
+package service_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"veo/internal/api/common"
+	v1 "veo/internal/api/v1"
+	"veo/internal/configs"
+	"veo/internal/database"
+	"veo/internal/models"
+	"veo/internal/repository"
+	"veo/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Initializes the test database and returns an OAuthService instance.
+func setupTestOAuthService(t *testing.T) service.OAuthService {
+	cfg, err := configs.Load("../../../config/config.yaml")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := database.Init(cfg.Database); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := database.GetDB()
+	return service.NewOAuthService(repository.NewOAuthClientRepository(db), repository.NewOAuthCodeRepository(db),
+		repository.NewSessionRepository(db), repository.NewRefreshTokenRepository(db))
+}
+
+// Test PKCE verification with the example of RFC 7636 appendix B.
+func TestVerifyCodeChallenge(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	assert.True(t, service.VerifyCodeChallenge(challenge, verifier))
+	assert.False(t, service.VerifyCodeChallenge(challenge, verifier[1:]+"a"), "Wrong verifier accepted")
+	assert.False(t, service.VerifyCodeChallenge(challenge, "short"), "Short verifier accepted")
+	assert.False(t, service.VerifyCodeChallenge(verifier, verifier), "Plain method accepted")
+}
+
+// Test the authorization code flow of a public client.
+func TestAuthorizationCode(t *testing.T) {
+	service := setupTestOAuthService(t)
+
+	_, _, err := service.RegisterClient("app", []string{"http://evil.example/cb"}, []string{models.ScopeProfile}, []string{models.GrantAuthorizationCode}, true)
+	assert.Error(t, err, "Plain HTTP redirect URI was accepted")
+	_, _, err = service.RegisterClient("app", nil, []string{models.ScopeProfile}, []string{models.GrantClientCredentials}, true)
+	assert.Error(t, err, "Public client was allowed the client credentials grant")
+	_, _, err = service.RegisterClient("app", []string{"https://app.example/cb"}, []string{models.ScopeProfile, models.ScopeAccount}, []string{models.GrantAuthorizationCode}, true)
+	assert.Error(t, err, "Client was registered for the account scope")
+
+	client, secret, err := service.RegisterClient("app", []string{"https://app.example/cb"}, []string{models.ScopeProfile}, []string{models.GrantAuthorizationCode}, true)
+	require.NoError(t, err)
+	assert.Empty(t, secret, "Public client got a secret")
+
+	// The only redirect URI is used when omitted, others are refused
+	_, redirectURI, err := service.ResolveClient(client.ClientID, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://app.example/cb", redirectURI)
+	_, _, err = service.ResolveClient(client.ClientID, "https://evil.example/cb")
+	assert.Error(t, err)
+
+	// PKCE is required and scopes are limited to the client's
+	_, err = service.ValidateAuthorization(client, "code", "", "", "")
+	assert.Error(t, err)
+	_, err = service.ValidateAuthorization(client, "code", models.ScopeAccount, "challenge", "S256")
+	assert.Error(t, err)
+	scope, err := service.ValidateAuthorization(client, "code", "", "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", "S256")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ScopeProfile, scope)
+
+	code, err := service.IssueCode(client, 1, redirectURI, scope, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM")
+	assert.NoError(t, err)
+
+	_, err = service.ExchangeCode(client, code, redirectURI, "wrong-verifier-wrong-verifier-wrong-verifier")
+	assert.Error(t, err, "Wrong verifier accepted")
+	grant, err := service.ExchangeCode(client, code, redirectURI, "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	require.NoError(t, err)
+	assert.Equal(t, 1, grant.UserID)
+
+	// Codes are single use
+	_, err = service.ExchangeCode(client, code, redirectURI, "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	assert.Error(t, err, "Code was exchanged twice")
+
+	assert.NoError(t, service.DeleteClient(client.ClientID))
+}
+
+// Test that a wrong token_type_hint only changes which lookup runs first at the introspection and revocation endpoints.
+func TestTokenTypeHint(t *testing.T) {
+	cfg, err := configs.Load("../../../config/config.yaml")
+	require.NoError(t, err)
+	require.NoError(t, common.InitJWT(cfg.JWT))
+	oauth := setupTestOAuthService(t)
+	db := database.GetDB()
+	sessionRepo := repository.NewSessionRepository(db)
+	refreshRepo := repository.NewRefreshTokenRepository(db)
+	sessions := service.NewSessionService(sessionRepo, refreshRepo, cfg.JWT.RefreshTokenTTL, 3)
+	tokens := service.NewTokenService(refreshRepo, sessionRepo, cfg.JWT.RefreshTokenTTL)
+	users := setupTestUserService(t)
+	common.UseSessionStrategy(common.NewJWTStrategy(sessionRepo))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	v1.SetupOAuthRouter(router, v1.NewOAuthAPI(users, oauth, service.NewAPIKeyService(repository.NewAPIKeyRepository(db)),
+		service.NewMFAService(repository.NewMFARepository(db), ""), service.EmailService{}, setupTestLockoutService(t, cfg.Lockout),
+		v1.NewTokenIssuer(tokens, sessions)))
+
+	client, secret, err := oauth.RegisterClient("resource", []string{"https://app.example/cb"}, []string{models.ScopeProfile},
+		[]string{models.GrantAuthorizationCode, models.GrantRefreshToken}, false)
+	require.NoError(t, err)
+	user, err := users.Register(fmt.Sprintf("hint%d", time.Now().UnixNano()), "Str0ng!Passw0rd")
+	require.NoError(t, err)
+	defer users.DeleteUser(user.ID)
+	session, err := sessions.StartGrant(user, client, models.ScopeProfile, "", "")
+	require.NoError(t, err)
+	accessToken, err := common.IssueAccessToken(user, session)
+	require.NoError(t, err)
+	refreshToken, err := tokens.IssueRefreshToken(user, session.ID)
+	require.NoError(t, err)
+
+	post := func(endpoint, token, hint string) *httptest.ResponseRecorder {
+		form := url.Values{"token": {token}, "token_type_hint": {hint}, "client_id": {client.ClientID}, "client_secret": {secret}}
+		req := httptest.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	introspect := func(token, hint string) v1.IntrospectionResponse {
+		var resp v1.IntrospectionResponse
+		w := post("/oauth/introspect", token, hint)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	assert.True(t, introspect(accessToken, "refresh_token").Active, "Access token hidden by the hint")
+	described := introspect(refreshToken, "access_token")
+	assert.True(t, described.Active, "Refresh token hidden by the hint")
+	assert.Equal(t, "refresh_token", described.TokenType)
+
+	// Revoking the refresh token with the hint of an access token ends the grant
+	assert.Equal(t, http.StatusOK, post("/oauth/revoke", refreshToken, "access_token").Code)
+	assert.False(t, introspect(refreshToken, "refresh_token").Active, "Refresh token survived its revocation")
+	assert.False(t, introspect(accessToken, "access_token").Active, "Access token survived the end of its grant")
+
+	// Revoking an access token with the hint of a refresh token revokes it too
+	session, err = sessions.StartGrant(user, client, models.ScopeProfile, "", "")
+	require.NoError(t, err)
+	accessToken, err = common.IssueAccessToken(user, session)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, post("/oauth/revoke", accessToken, "refresh_token").Code)
+	assert.False(t, introspect(accessToken, "access_token").Active, "Access token survived its revocation")
+}
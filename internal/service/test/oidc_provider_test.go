@@ -0,0 +1,158 @@
+package service_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"veo/internal/configs"
+	"veo/internal/service"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeIdP is a local OpenID Connect provider issuing ID tokens for a single user.
+type fakeIdP struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	kid      string
+	subject  string
+	email    string
+	username string
+	codes    map[string]url.Values // Authorization requests by code
+	claims   jwt.MapClaims         // Overrides the claims of the next ID token
+}
+
+// newFakeIdP starts a fake provider, which is stopped when the test ends.
+func newFakeIdP(t *testing.T) *fakeIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	idp := &fakeIdP{key: key, kid: "k1", subject: "248289761001", email: "jane@example.com", username: "jane", codes: map[string]url.Values{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"userinfo_endpoint":      idp.server.URL + "/userinfo",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": idp.kid, "use": "sig", "alg": "RS256",
+			"n": base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, _ := r.BasicAuth()
+		request, ok := idp.codes[r.PostFormValue("code")]
+		delete(idp.codes, r.PostFormValue("code"))
+		if !ok || clientID != "veo" || secret != "s3cret" || r.PostFormValue("redirect_uri") != request.Get("redirect_uri") ||
+			!service.VerifyCodeChallenge(request.Get("code_challenge"), r.PostFormValue("code_verifier")) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "at-" + idp.subject, "token_type": "Bearer", "id_token": idp.idToken(request.Get("nonce"))})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer at-"+idp.subject {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"sub": idp.subject, "email": idp.email, "email_verified": true, "preferred_username": idp.username})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// config returns our registration at the provider.
+func (idp *fakeIdP) config() configs.OIDCProviderConfig {
+	return configs.OIDCProviderConfig{Name: "corp", Issuer: idp.server.URL, ClientID: "veo", ClientSecret: "s3cret", RedirectURL: "https://veo.example/api/oidc/corp/callback", Scopes: []string{"email"}}
+}
+
+// authorize plays the user signing in at the provider and returns the authorization code.
+func (idp *fakeIdP) authorize(t *testing.T, authorizationURL string) string {
+	u, err := url.Parse(authorizationURL)
+	require.NoError(t, err)
+	code := "code-" + u.Query().Get("state")
+	idp.codes[code] = u.Query()
+	return code
+}
+
+// idToken signs an ID token for the user.
+func (idp *fakeIdP) idToken(nonce string) string {
+	claims := jwt.MapClaims{"iss": idp.server.URL, "sub": idp.subject, "aud": "veo", "nonce": nonce, "iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix()}
+	for name, value := range idp.claims {
+		claims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = idp.kid
+	signed, _ := token.SignedString(idp.key)
+	return signed
+}
+
+// Test the code flow with PKCE and the checks of the ID token.
+func TestOIDCProvider(t *testing.T) {
+	idp := newFakeIdP(t)
+	provider := service.NewOIDCProvider(idp.config(), nil)
+	ctx := context.Background()
+
+	authorizationURL, err := provider.AuthorizationURL(ctx, "state1", "nonce1", "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM")
+	assert.NoError(t, err)
+	query := mustQuery(t, authorizationURL)
+	assert.Equal(t, "openid email", query.Get("scope"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	identity, err := provider.Exchange(ctx, idp.authorize(t, authorizationURL), verifier, "nonce1")
+	require.NoError(t, err)
+	assert.Equal(t, idp.subject, identity.Subject)
+	assert.Equal(t, "jane@example.com", identity.Email, "Profile completed from userinfo")
+	assert.True(t, identity.EmailVerified)
+
+	// The code is bound to the verifier, the ID token to the nonce
+	_, err = provider.Exchange(ctx, idp.authorize(t, authorizationURL), verifier[1:]+"a", "nonce1")
+	assert.Error(t, err, "Wrong code verifier accepted")
+	_, err = provider.Exchange(ctx, idp.authorize(t, authorizationURL), verifier, "nonce2")
+	assert.Error(t, err, "ID token of another sign-in accepted")
+
+	// ID tokens of other clients, issuers or past their expiry are refused
+	for _, claims := range []jwt.MapClaims{
+		{"aud": "other"},
+		{"aud": []string{"veo", "other"}, "azp": "other"},
+		{"iss": "https://impostor.example"},
+		{"exp": time.Now().Add(-time.Hour).Unix()},
+	} {
+		idp.claims = claims
+		_, err = provider.Exchange(ctx, idp.authorize(t, authorizationURL), verifier, "nonce1")
+		assert.Error(t, err, "ID token with %v accepted", claims)
+	}
+	idp.claims = nil
+
+	// Tokens signed by another key are refused
+	idp.key, _ = rsa.GenerateKey(rand.Reader, 2048)
+	_, err = provider.Exchange(ctx, idp.authorize(t, authorizationURL), verifier, "nonce1")
+	assert.Error(t, err, "ID token with a forged signature accepted")
+}
+
+// mustQuery returns the query parameters of a URL.
+func mustQuery(t *testing.T, rawURL string) url.Values {
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	return u.Query()
+}
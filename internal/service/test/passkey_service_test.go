@@ -0,0 +1,180 @@
+package service_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"testing"
+	"time"
+
+	"veo/internal/configs"
+	"veo/internal/database"
+	"veo/internal/repository"
+	"veo/internal/service"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testWebAuthn is the relying party the software authenticator talks to
+var testWebAuthn = configs.WebAuthnConfig{RPID: "localhost", RPName: "veo", Origins: []string{"http://localhost:8080"}}
+
+// softAuthenticator is a software WebAuthn authenticator holding a single ES256 passkey,
+// standing in for the browser and the authenticator in tests
+type softAuthenticator struct {
+	origin       string
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   string
+	signCount    uint32
+}
+
+// newSoftAuthenticator creates an authenticator running ceremonies on the origin
+func newSoftAuthenticator(t *testing.T, origin string) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	credentialID := make([]byte, 32)
+	rand.Read(credentialID)
+	return &softAuthenticator{origin: origin, key: key, credentialID: credentialID}
+}
+
+// create answers navigator.credentials.create with the options of a registration
+func (a *softAuthenticator) create(t *testing.T, options *service.CredentialCreationOptions) *service.RegistrationCredential {
+	a.userHandle = options.User.ID
+	coseKey, err := cbor.Marshal(map[int]interface{}{1: 2, 3: -7, -1: 1, -2: a.key.X.FillBytes(make([]byte, 32)), -3: a.key.Y.FillBytes(make([]byte, 32))})
+	if err != nil {
+		t.Fatalf("Failed to encode key: %v", err)
+	}
+
+	// Attested credential data: AAGUID, credential ID length, credential ID and public key
+	attested := make([]byte, 16, 18+len(a.credentialID)+len(coseKey))
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(append(attested, a.credentialID...), coseKey...)
+	authData := a.authenticatorData(options.RP.ID, 0x45, attested)
+
+	attestation, err := cbor.Marshal(map[string]interface{}{"fmt": "none", "attStmt": map[string]interface{}{}, "authData": authData})
+	if err != nil {
+		t.Fatalf("Failed to encode attestation: %v", err)
+	}
+
+	credential := &service.RegistrationCredential{ID: encode(a.credentialID), RawID: encode(a.credentialID), Type: "public-key"}
+	credential.Response.ClientDataJSON = encode(a.clientData("webauthn.create", options.Challenge))
+	credential.Response.AttestationObject = encode(attestation)
+	credential.Response.Transports = []string{"internal"}
+	return credential
+}
+
+// get answers navigator.credentials.get with the options of a sign-in
+func (a *softAuthenticator) get(t *testing.T, options *service.CredentialRequestOptions) *service.AssertionCredential {
+	a.signCount++
+	authData := a.authenticatorData(options.RPID, 0x05, nil)
+	clientDataJSON := a.clientData("webauthn.get", options.Challenge)
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign assertion: %v", err)
+	}
+
+	credential := &service.AssertionCredential{ID: encode(a.credentialID), RawID: encode(a.credentialID), Type: "public-key"}
+	credential.Response.ClientDataJSON = encode(clientDataJSON)
+	credential.Response.AuthenticatorData = encode(authData)
+	credential.Response.Signature = encode(signature)
+	credential.Response.UserHandle = a.userHandle
+	return credential
+}
+
+// authenticatorData builds authenticator data for the relying party with the flags and signature counter
+func (a *softAuthenticator) authenticatorData(rpID string, flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+// clientData builds the client data the browser passes to the authenticator
+func (a *softAuthenticator) clientData(ceremony, challenge string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{"type": ceremony, "challenge": challenge, "origin": a.origin, "crossOrigin": false})
+	return data
+}
+
+// encode encodes bytes like PublicKeyCredential.toJSON does
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Initializes the test database and returns PasskeyService and UserService instances.
+func setupTestPasskeyService(t *testing.T) (service.PasskeyService, service.UserService) {
+	cfg, err := configs.Load("../../../config/config.yaml")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := database.Init(cfg.Database); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := database.GetDB()
+	passkeys := service.NewPasskeyService(repository.NewPasskeyRepository(db), repository.NewIdentityRepository(db), testWebAuthn)
+	return passkeys, service.NewUserService(repository.NewUserRepository(db))
+}
+
+// Test registering a passkey with a software authenticator and signing in with it.
+func TestPasskeyCeremonies(t *testing.T) {
+	passkeys, users := setupTestPasskeyService(t)
+
+	user, err := users.Register(fmt.Sprintf("passkey-%d", time.Now().UnixNano()), "password")
+	require.NoError(t, err)
+	defer users.DeleteUser(user.ID)
+
+	authenticator := newSoftAuthenticator(t, testWebAuthn.Origins[0])
+	creation, err := passkeys.BeginRegistration(user)
+	assert.NoError(t, err)
+	registration := authenticator.create(t, creation)
+	passkey, err := passkeys.FinishRegistration(user.ID, "Laptop", registration)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Laptop", passkey.Name)
+
+	_, err = passkeys.FinishRegistration(user.ID, "Laptop", registration)
+	assert.Error(t, err, "Registration was completed twice")
+
+	request, err := passkeys.BeginLogin()
+	assert.NoError(t, err)
+	assertion := authenticator.get(t, request)
+	signedIn, err := passkeys.FinishLogin(assertion)
+	if assert.NoError(t, err) {
+		assert.Equal(t, user.ID, signedIn.ID)
+	}
+	_, err = passkeys.FinishLogin(assertion)
+	assert.Error(t, err, "Assertion was accepted twice")
+
+	// A copy of the passkey replays an old signature counter
+	request, _ = passkeys.BeginLogin()
+	authenticator.signCount = 0
+	_, err = passkeys.FinishLogin(authenticator.get(t, request))
+	assert.Error(t, err, "Cloned passkey was accepted")
+
+	// Assertions made for another site are rejected
+	phishing := newSoftAuthenticator(t, "https://evil.example")
+	phishing.key, phishing.credentialID, phishing.signCount = authenticator.key, authenticator.credentialID, 10
+	request, _ = passkeys.BeginLogin()
+	_, err = passkeys.FinishLogin(phishing.get(t, request))
+	assert.Error(t, err, "Assertion from another origin was accepted")
+
+	assert.NoError(t, passkeys.Delete(user.ID, passkey.ID))
+	list, err := passkeys.List(user.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+}
@@ -0,0 +1,129 @@
+package service_test
+
+import (
+	"strings"
+	"testing"
+
+	"veo/internal/configs"
+	"veo/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Small parameters, so the test runs fast
+var testHashConfig = configs.PasswordHashConfig{
+	Argon2id: configs.Argon2idConfig{Memory: 1024, Iterations: 1, Parallelism: 1},
+	Bcrypt:   configs.BcryptConfig{Cost: bcrypt.MinCost},
+	Scrypt:   configs.ScryptConfig{N: 1024},
+}
+
+// Test hashing with each algorithm, and that hashes of other algorithms or parameters verify but ask for a rehash.
+func TestPasswordHashers(t *testing.T) {
+	prefixes := map[string]string{"argon2id": "$argon2id$v=19$m=1024,t=1,p=1$", "bcrypt": "$2a$04$", "scrypt": "$scrypt$ln=10,r=8,p=1$"}
+	hashes := make(map[string]string)
+	for algorithm, prefix := range prefixes {
+		cfg := testHashConfig
+		cfg.Algorithm = algorithm
+		hashers, err := utils.NewPasswordHashers(cfg)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		hash, err := hashers.Hash("correct horse")
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(hash, prefix), hash)
+		hashes[algorithm] = hash
+
+		ok, rehash := hashers.Verify("correct horse", hash)
+		assert.True(t, ok, algorithm)
+		assert.False(t, rehash, algorithm)
+		ok, _ = hashers.Verify("wrong horse", hash)
+		assert.False(t, ok, algorithm)
+	}
+
+	// Every algorithm verifies the hashes of the others, which need a rehash
+	hashers, _ := utils.NewPasswordHashers(testHashConfig)
+	for algorithm, hash := range hashes {
+		ok, rehash := hashers.Verify("correct horse", hash)
+		assert.True(t, ok, algorithm)
+		assert.Equal(t, algorithm != "argon2id", rehash, algorithm)
+	}
+
+	// So do hashes made with other parameters
+	stronger := testHashConfig
+	stronger.Argon2id.Iterations = 2
+	hashers, _ = utils.NewPasswordHashers(stronger)
+	ok, rehash := hashers.Verify("correct horse", hashes["argon2id"])
+	assert.True(t, ok)
+	assert.True(t, rehash)
+
+	for _, hash := range []string{"", "plain", "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$", "$argon2id$v=18$m=1024,t=1,p=1$c2FsdA$aGFzaA", "$unknown$x=1$c2FsdA$aGFzaA"} {
+		ok, _ := hashers.Verify("correct horse", hash)
+		assert.False(t, ok, hash)
+	}
+
+	_, err := utils.NewPasswordHashers(configs.PasswordHashConfig{Algorithm: "md5"})
+	assert.Error(t, err)
+	_, err = utils.NewPasswordHashers(configs.PasswordHashConfig{Scrypt: configs.ScryptConfig{N: 1000}})
+	assert.Error(t, err)
+}
+
+// withPeppers returns the test configuration with the peppers
+func withPeppers(peppers ...configs.PepperConfig) configs.PasswordHashConfig {
+	cfg := testHashConfig
+	cfg.Peppers = peppers
+	return cfg
+}
+
+// Test that hashes record their pepper, need the pepper to verify, and move to the active pepper when rotated.
+func TestPasswordPepper(t *testing.T) {
+	first := configs.PepperConfig{Version: 1, Secret: "first pepper", Status: utils.PepperActive}
+	hashers, err := utils.NewPasswordHashers(withPeppers(first))
+	if !assert.NoError(t, err) {
+		return
+	}
+	hash, err := hashers.Hash("correct horse")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$pepper$v=1$argon2id$"), hash)
+	ok, rehash := hashers.Verify("correct horse", hash)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	// Without the pepper, or with another secret, the hash is useless
+	unpeppered, _ := utils.NewPasswordHashers(testHashConfig)
+	ok, _ = unpeppered.Verify("correct horse", hash)
+	assert.False(t, ok)
+	stolen, _ := utils.NewPasswordHashers(withPeppers(configs.PepperConfig{Version: 1, Secret: "guess", Status: utils.PepperActive}))
+	ok, _ = stolen.Verify("correct horse", hash)
+	assert.False(t, ok)
+
+	// Rotated: the retired pepper still verifies, and asks for a rehash
+	first.Status = utils.PepperRetired
+	rotated, err := utils.NewPasswordHashers(withPeppers(first, configs.PepperConfig{Version: 2, Secret: "second pepper", Status: utils.PepperActive}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	ok, rehash = rotated.Verify("correct horse", hash)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+	hash, _ = rotated.Hash("correct horse")
+	assert.True(t, strings.HasPrefix(hash, "$pepper$v=2$"), hash)
+
+	// Hashes made before peppering verify and get peppered
+	plain, _ := unpeppered.Hash("correct horse")
+	ok, rehash = rotated.Verify("correct horse", plain)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+
+	for _, cfg := range []configs.PasswordHashConfig{
+		withPeppers(configs.PepperConfig{Version: 1, Secret: "a", Status: utils.PepperActive}, configs.PepperConfig{Version: 2, Secret: "b", Status: utils.PepperActive}),
+		withPeppers(configs.PepperConfig{Version: 1, Secret: "a", Status: utils.PepperActive}, configs.PepperConfig{Version: 1, Secret: "b", Status: utils.PepperRetired}),
+		withPeppers(configs.PepperConfig{Version: 0, Secret: "a", Status: utils.PepperActive}),
+		withPeppers(configs.PepperConfig{Version: 1, Status: utils.PepperActive}),
+		withPeppers(configs.PepperConfig{Version: 1, Secret: "a", Status: "pending"}),
+	} {
+		_, err := utils.NewPasswordHashers(cfg)
+		assert.Error(t, err, "%+v", cfg.Peppers)
+	}
+}
@@ -0,0 +1,41 @@
+package service_test
+
+import (
+	"testing"
+	"time"
+
+	"veo/internal/configs"
+	"veo/internal/models"
+	"veo/internal/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that a password must be changed when an admin asks for it or once it is older than the maximum age.
+func TestPasswordChangeRequired(t *testing.T) {
+	policy, err := service.NewPasswordPolicy(configs.PasswordPolicyConfig{MaxAge: 90 * 24 * time.Hour})
+	assert.NoError(t, err)
+	service.UsePasswordPolicy(policy)
+	defer func() {
+		policy, _ := service.NewPasswordPolicy(configs.PasswordPolicyConfig{})
+		service.UsePasswordPolicy(policy)
+	}()
+
+	recent := time.Now().Add(-time.Hour)
+	old := time.Now().Add(-100 * 24 * time.Hour)
+
+	assert.False(t, service.PasswordChangeRequired(&models.User{Password: "hash", PasswordChangedAt: &recent}))
+	assert.True(t, service.PasswordChangeRequired(&models.User{Password: "hash", PasswordChangedAt: &recent, MustChangePassword: true}))
+	assert.True(t, service.PasswordChangeRequired(&models.User{Password: "hash", PasswordChangedAt: &old}))
+	assert.True(t, service.PasswordChangeRequired(&models.User{Password: "hash"}), "A password of unknown age counts as expired")
+
+	// Users signing in with an identity provider only have no password to change
+	assert.False(t, service.PasswordChangeRequired(&models.User{MustChangePassword: true}))
+
+	// Without a maximum age only the flag counts
+	policy, err = service.NewPasswordPolicy(configs.PasswordPolicyConfig{})
+	assert.NoError(t, err)
+	service.UsePasswordPolicy(policy)
+	assert.False(t, service.PasswordChangeRequired(&models.User{Password: "hash", PasswordChangedAt: &old}))
+	assert.True(t, service.PasswordChangeRequired(&models.User{Password: "hash", MustChangePassword: true}))
+}
@@ -0,0 +1,72 @@
+package service_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"veo/internal/configs"
+	"veo/internal/service"
+	"veo/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// brokenRules returns the rules a password check reports as broken
+func brokenRules(t *testing.T, err error) []string {
+	e, ok := err.(*errors.Error)
+	if !assert.True(t, ok, "Not a field error: %v", err) {
+		return nil
+	}
+	rules := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		assert.Equal(t, "password", field.Field)
+		rules = append(rules, field.Rule)
+	}
+	return rules
+}
+
+// Test that each rule of the policy refuses the passwords it is meant to, and only those.
+func TestPasswordPolicy(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "common.txt")
+	assert.NoError(t, os.WriteFile(list, []byte("# common\nletmein123\nSunshine99\n"), 0o600))
+	policy, err := service.NewPasswordPolicy(configs.PasswordPolicyConfig{
+		MinLength:           10,
+		RequiredClasses:     []string{"digit"},
+		MinClasses:          3,
+		RejectUsername:      true,
+		CommonPasswordsFile: list,
+		MinEntropy:          40,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, policy.Check("password", "tangerine-Bus-41", "alice"))
+
+	refused := map[string][]string{
+		"":                 {service.RuleMinLength, service.RuleCharacterClasses, service.RuleEntropy},
+		"Short-1":          {service.RuleMinLength},
+		"no-digits-Here":   {service.RuleCharacterClasses},
+		"alllowercase123":  {service.RuleCharacterClasses},
+		"Alice-Rocks-2024": {service.RuleUsername},
+		"ecila-Backw4rds!": {service.RuleUsername},
+		"SUNSHINE99x":      {},
+		"LETMEIN123":       {service.RuleCharacterClasses, service.RuleCommonPassword},
+		"Aaaaaaaaaaa1":     {service.RuleEntropy},
+		"Abcdefghijk1":     {service.RuleEntropy},
+	}
+	for password, rules := range refused {
+		err := policy.Check("password", password, "alice")
+		if len(rules) == 0 {
+			assert.NoError(t, err, password)
+			continue
+		}
+		assert.ElementsMatch(t, rules, brokenRules(t, err), password)
+	}
+
+	_, err = service.NewPasswordPolicy(configs.PasswordPolicyConfig{RequiredClasses: []string{"emoji"}})
+	assert.Error(t, err, "Unknown character class was accepted")
+	_, err = service.NewPasswordPolicy(configs.PasswordPolicyConfig{CommonPasswordsFile: filepath.Join(t.TempDir(), "missing.txt")})
+	assert.Error(t, err, "Missing list of common passwords was accepted")
+}
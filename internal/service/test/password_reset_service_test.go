@@ -0,0 +1,82 @@
+package service_test
+
+import (
+	"fmt"
+	"log"
+	"testing"
+	"time"
+
+	"veo/internal/configs"
+	"veo/internal/database"
+	"veo/internal/models"
+	"veo/internal/repository"
+	"veo/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Initializes the test database and returns a PasswordResetService sending mail to the capture mailer,
+// with the UserService and SessionService it works with.
+func setupTestPasswordResetService(t *testing.T, mailer service.Mailer) (service.PasswordResetService, service.UserService, service.SessionService) {
+	cfg, err := configs.Load("../../../config/config.yaml")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := database.Init(cfg.Database); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := database.GetDB()
+	sessions := service.NewSessionService(repository.NewSessionRepository(db), repository.NewRefreshTokenRepository(db), time.Hour, 10)
+	resets := service.NewPasswordResetService(repository.NewPasswordResetRepository(db), repository.NewUserRepository(db), sessions,
+		service.NewRateLimiter(repository.NewRateLimitRepository(db)), mailer, configs.PasswordResetConfig{URL: "http://localhost:8080/password/reset"})
+	return resets, service.NewUserService(repository.NewUserRepository(db)), sessions
+}
+
+// Test resetting a forgotten password with a mailed link, which signs the user out everywhere.
+func TestPasswordReset(t *testing.T) {
+	mailer := make(captureMailer, 10)
+	resets, users, sessions := setupTestPasswordResetService(t, mailer)
+
+	username := fmt.Sprintf("reset-%d", time.Now().UnixNano())
+	user, err := users.Register(username, "old password")
+	require.NoError(t, err)
+	defer users.DeleteUser(user.ID)
+	address := username + "@example.test"
+	userRepo := repository.NewUserRepository(database.GetDB())
+	assert.NoError(t, userRepo.SetPendingEmail(user.ID, address))
+	_, err = userRepo.ConfirmEmail(user.ID, address, time.Now())
+	assert.NoError(t, err)
+	_, err = sessions.Start(user, "laptop", "", "")
+	assert.NoError(t, err)
+	apiKeys := service.NewAPIKeyService(repository.NewAPIKeyRepository(database.GetDB()))
+	_, _, err = apiKeys.Create(user.ID, "ci", []string{models.ScopeProfile}, nil)
+	assert.NoError(t, err)
+
+	assert.NoError(t, resets.Request(address, "test"))
+	link := mailer.receive()
+	if !assert.NotNil(t, link, "No reset link was sent") {
+		return
+	}
+	token := linkToken(t, link)
+
+	assert.NoError(t, resets.Reset(token, "new password"))
+	_, err = users.Login(username, "old password")
+	assert.Error(t, err, "Old password still works")
+	_, err = users.Login(username, "new password")
+	assert.NoError(t, err)
+
+	active, err := sessions.List(user.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, active, "Sessions survived the reset")
+	version, err := users.TokenVersion(user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, user.TokenVersion+1, version, "Tokens survived the reset")
+	keys, err := apiKeys.List(user.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, keys, "API keys survived the reset")
+
+	assert.Error(t, resets.Reset(token, "another password"), "Reset link worked twice")
+}
@@ -0,0 +1,110 @@
+package service_test
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"testing"
+	"time"
+
+	"veo/internal/configs"
+	"veo/internal/database"
+	"veo/internal/repository"
+	"veo/internal/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// captureSMS keeps the last text message sent to each number
+type captureSMS map[string]string
+
+func (p captureSMS) Send(to, message string) error {
+	p[to] = message
+	return nil
+}
+
+// codePattern finds the code in a text message
+var codePattern = regexp.MustCompile(`\d{6}`)
+
+// Initializes the test database and returns a PhoneService sending text messages to the capture provider, and a UserService.
+func setupTestPhoneService(t *testing.T, sms service.SMSProvider) (service.PhoneService, service.UserService) {
+	cfg, err := configs.Load("../../../config/config.yaml")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := database.Init(cfg.Database); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	db := database.GetDB()
+	phones := service.NewPhoneService(repository.NewPhoneCodeRepository(db), repository.NewIdentityRepository(db),
+		repository.NewUserRepository(db), service.NewRateLimiter(repository.NewRateLimitRepository(db)), sms,
+		configs.PhoneConfig{DefaultCountryCode: "44"})
+	return phones, service.NewUserService(repository.NewUserRepository(db))
+}
+
+// Test normalizing phone numbers to E.164.
+func TestNormalizePhone(t *testing.T) {
+	phones := service.NewPhoneService(nil, nil, nil, service.RateLimiter{}, nil, configs.PhoneConfig{DefaultCountryCode: "44"})
+	valid := map[string]string{
+		"+1 (415) 555-0123":  "+14155550123",
+		"0033 1 23 45 67 89": "+33123456789",
+		"020 7946 0018":      "+442079460018",
+		"7700.900123":        "+447700900123",
+	}
+	for input, expected := range valid {
+		number, err := phones.Normalize(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected, number, input)
+	}
+
+	for _, input := range []string{"", "+0123456789", "+1234", "+1234567890123456", "+1 415 555 O123", "1+4155550123"} {
+		_, err := phones.Normalize(input)
+		assert.Error(t, err, "Accepted %q", input)
+	}
+}
+
+// Test signing up and signing in with codes, and that codes are single-use and abandoned after wrong attempts.
+func TestPhoneSignIn(t *testing.T) {
+	sms := captureSMS{}
+	phones, users := setupTestPhoneService(t, sms)
+	ip := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	number := fmt.Sprintf("+1555%07d", time.Now().UnixNano()%10_000_000)
+
+	// The first sign-in of a number creates its user
+	assert.NoError(t, phones.SendCode(number, ip))
+	code := codePattern.FindString(sms[number])
+	user, err := phones.Verify(number, code, ip)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer users.DeleteUser(user.ID)
+	assert.Equal(t, number, *user.Phone)
+
+	_, err = phones.Verify(number, code, ip)
+	assert.Error(t, err, "Code signed in twice")
+
+	// Signing in again with the number, entered differently, finds the same user
+	assert.NoError(t, phones.SendCode(number[:2]+" "+number[2:], ip))
+	signedIn, err := phones.Verify(number, codePattern.FindString(sms[number]), ip)
+	if assert.NoError(t, err) {
+		assert.Equal(t, user.ID, signedIn.ID)
+	}
+
+	// Wrong codes abandon the code
+	assert.NoError(t, phones.SendCode(number, ip))
+	code = codePattern.FindString(sms[number])
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	for i := 0; i < 5; i++ {
+		_, err = phones.Verify(number, wrong, ip)
+		assert.Error(t, err)
+	}
+	_, err = phones.Verify(number, code, ip)
+	assert.Error(t, err, "Code was accepted after too many wrong attempts")
+
+	assert.Error(t, phones.SendCode(number, ip), "Rate limit was not applied")
+}
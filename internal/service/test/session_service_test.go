@@ -0,0 +1,61 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that the session cap revokes the oldest sessions and their refresh tokens.
+func TestSessionLimit(t *testing.T) {
+	tokenService, sessionService, userService := setupTestTokenService(t)
+	user, err := userService.GetUserByID(1)
+	require.NoError(t, err)
+	assert.NoError(t, userService.SignOutEverywhere(user.ID))
+	user, err = userService.GetUserByID(1)
+	require.NoError(t, err)
+
+	oldest, err := sessionService.Start(user, "first", "", "")
+	require.NoError(t, err)
+	token, err := tokenService.IssueRefreshToken(user, oldest.ID)
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := sessionService.Start(user, "next", "", "")
+		assert.NoError(t, err)
+	}
+
+	sessions, err := sessionService.List(user.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 3)
+	assert.NotEqual(t, oldest.ID, sessions[0].ID, "Oldest session was not evicted")
+
+	_, _, err = tokenService.RotateRefreshToken(token, "")
+	assert.Error(t, err, "Refresh token survived its session")
+}
+
+// Test revoking a single session and every other session.
+func TestRevokeSessions(t *testing.T) {
+	_, sessionService, userService := setupTestTokenService(t)
+	user, err := userService.GetUserByID(1)
+	require.NoError(t, err)
+
+	current, err := sessionService.Start(user, "current", "", "")
+	require.NoError(t, err)
+	other, err := sessionService.Start(user, "other", "", "")
+	require.NoError(t, err)
+
+	// Sessions of other users cannot be revoked
+	assert.Error(t, sessionService.Revoke(user.ID+1, other.ID))
+	assert.NoError(t, sessionService.Revoke(user.ID, other.ID))
+
+	_, err = sessionService.Start(user, "another", "", "")
+	assert.NoError(t, err)
+	assert.NoError(t, sessionService.RevokeOthers(user.ID, current.ID))
+
+	sessions, err := sessionService.List(user.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, current.ID, sessions[0].ID)
+}
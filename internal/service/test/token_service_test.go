@@ -0,0 +1,83 @@
+package service_test
+
+import (
+	"log"
+	"testing"
+
+	"veo/internal/configs"
+	"veo/internal/database"
+	"veo/internal/repository"
+	"veo/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Initializes the test database and returns a TokenService, a SessionService and a UserService instance.
+func setupTestTokenService(t *testing.T) (service.TokenService, service.SessionService, service.UserService) {
+	cfg, err := configs.Load("../../../config/config.yaml")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := database.Init(cfg.Database); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	userRepo := repository.NewUserRepository(database.GetDB())
+	refreshRepo := repository.NewRefreshTokenRepository(database.GetDB())
+	sessionRepo := repository.NewSessionRepository(database.GetDB())
+	return service.NewTokenService(refreshRepo, sessionRepo, cfg.JWT.RefreshTokenTTL),
+		service.NewSessionService(sessionRepo, refreshRepo, cfg.JWT.RefreshTokenTTL, 3),
+		service.NewUserService(userRepo)
+}
+
+// Test refresh token rotation and reuse detection.
+func TestRotateRefreshToken(t *testing.T) {
+	service, sessionService, userService := setupTestTokenService(t)
+	user, err := userService.GetUserByID(1)
+	require.NoError(t, err)
+	session, err := sessionService.Start(user, "test", "", "")
+	require.NoError(t, err)
+
+	// Issue a token and rotate it twice
+	first, err := service.IssueRefreshToken(user, session.ID)
+	assert.NoError(t, err)
+
+	rotatedSession, second, err := service.RotateRefreshToken(first, "")
+	require.NoError(t, err)
+	assert.Equal(t, session.ID, rotatedSession.ID)
+	assert.Equal(t, user.ID, rotatedSession.User.ID)
+	assert.NotEqual(t, first, second)
+
+	_, third, err := service.RotateRefreshToken(second, "")
+	assert.NoError(t, err)
+
+	// Presenting an already rotated token revokes the whole family
+	_, _, err = service.RotateRefreshToken(first, "")
+	assert.Error(t, err, "Rotated token was accepted again")
+
+	_, _, err = service.RotateRefreshToken(third, "")
+	assert.Error(t, err, "Token family was not revoked")
+
+	// Unknown tokens are rejected
+	_, _, err = service.RotateRefreshToken("unknown", "")
+	assert.Error(t, err)
+}
+
+// Test that signing out everywhere revokes existing refresh tokens.
+func TestSignOutEverywhereRevokesRefreshTokens(t *testing.T) {
+	service, sessionService, userService := setupTestTokenService(t)
+	user, err := userService.GetUserByID(1)
+	require.NoError(t, err)
+	session, err := sessionService.Start(user, "test", "", "")
+	require.NoError(t, err)
+
+	token, err := service.IssueRefreshToken(user, session.ID)
+	assert.NoError(t, err)
+
+	assert.NoError(t, userService.SignOutEverywhere(user.ID))
+
+	_, _, err = service.RotateRefreshToken(token, "")
+	assert.Error(t, err, "Refresh token survived sign out everywhere")
+}
@@ -42,8 +42,8 @@ func setupTestUserService(t *testing.T) service.UserService {
 func TestRegister(t *testing.T) {
 	service := setupTestUserService(t)
 	username := "testregist"
-	password := "123456"
-	newPassword := "abc123"
+	password := "plum-Violet-83"
+	newPassword := "copper.Tide.19"
 
 	// Register a new user
 	user, err := service.Register(username, password)
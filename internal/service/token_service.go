@@ -0,0 +1,161 @@
+package service
+
+import (
+	"time"
+	"veo/internal/models"
+	"veo/internal/repository"
+	"veo/internal/utils"
+)
+
+// DefaultRefreshTokenTTL is used when no refresh token lifetime is configured
+const DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+var logger = utils.GetLogger()
+
+// TokenService handles refresh token issuance and rotation
+type TokenService struct {
+	refreshRepo *repository.RefreshTokenRepository
+	sessionRepo *repository.SessionRepository
+	refreshTTL  time.Duration
+}
+
+// NewTokenService creates a new instance of TokenService
+func NewTokenService(refreshRepo *repository.RefreshTokenRepository, sessionRepo *repository.SessionRepository, refreshTTL time.Duration) TokenService {
+	if refreshTTL <= 0 {
+		refreshTTL = DefaultRefreshTokenTTL
+	}
+	return TokenService{refreshRepo: refreshRepo, sessionRepo: sessionRepo, refreshTTL: refreshTTL}
+}
+
+// RefreshTokenTTL returns the lifetime of newly issued refresh tokens
+func (s *TokenService) RefreshTokenTTL() time.Duration {
+	return s.refreshTTL
+}
+
+// IssueRefreshToken starts a new token family for the user's login session and returns the plain refresh token
+func (s *TokenService) IssueRefreshToken(user *models.User, sessionID int) (string, error) {
+	familyID, err := utils.RandomToken(16)
+	if err != nil {
+		return "", NewError(CodeError, "Failed to generate refresh token")
+	}
+	return s.issue(user.ID, sessionID, user.TokenVersion, familyID)
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one in the same family.
+// It returns the login session of the token, with its owner, and the new plain refresh token.
+// Tokens are only accepted from the OAuth client they were issued to, clientID is empty for direct sign-ins.
+// Presenting a token that was already rotated revokes the whole family and ends the session.
+func (s *TokenService) RotateRefreshToken(refreshToken, clientID string) (*models.Session, string, error) {
+	token, err := s.refreshRepo.GetByHash(utils.HashToken(refreshToken))
+	if err != nil {
+		return nil, "", err
+	}
+	if token == nil || token.RevokedAt != nil {
+		return nil, "", NewAuthFailed("Invalid refresh token")
+	}
+	if token.RotatedAt != nil {
+		return nil, "", s.revokeReusedFamily(token)
+	}
+	if time.Now().After(token.ExpiresAt) {
+		return nil, "", NewTokenExpired("Refresh token expired")
+	}
+
+	// The family dies with its session
+	session, err := s.sessionRepo.GetByID(token.SessionID)
+	if err != nil {
+		return nil, "", err
+	}
+	if session == nil || time.Now().After(session.ExpiresAt) {
+		return nil, "", NewTokenExpired("Session expired")
+	}
+	if session.ClientID != clientID {
+		return nil, "", NewAuthFailed("Invalid refresh token")
+	}
+
+	// And with the account, a password change or a sign out everywhere
+	if session.User.ID != token.UserID || session.User.TokenVersion != token.TokenVersion {
+		return nil, "", NewTokenExpired("Refresh token has been revoked")
+	}
+
+	// Claim the token, losing the race against a concurrent refresh counts as reuse
+	rotated, err := s.refreshRepo.MarkRotated(token.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	if !rotated {
+		return nil, "", s.revokeReusedFamily(token)
+	}
+
+	newToken, err := s.issue(token.UserID, token.SessionID, token.TokenVersion, token.FamilyID)
+	if err != nil {
+		return nil, "", err
+	}
+	return session, newToken, nil
+}
+
+// IntrospectRefreshToken returns a refresh token and its session if the token is active,
+// or nil if it is unknown, used, revoked or expired
+func (s *TokenService) IntrospectRefreshToken(refreshToken string) (*models.RefreshToken, *models.Session, error) {
+	token, err := s.refreshRepo.GetByHash(utils.HashToken(refreshToken))
+	if err != nil || token == nil {
+		return nil, nil, err
+	}
+	if token.RevokedAt != nil || token.RotatedAt != nil || time.Now().After(token.ExpiresAt) {
+		return nil, nil, nil
+	}
+
+	session, err := s.sessionRepo.GetByID(token.SessionID)
+	if err != nil || session == nil {
+		return nil, nil, err
+	}
+	if time.Now().After(session.ExpiresAt) || session.User.ID != token.UserID || session.User.TokenVersion != token.TokenVersion {
+		return nil, nil, nil
+	}
+	return token, session, nil
+}
+
+// RevokeRefreshToken revokes the family of a refresh token, provided it belongs to the user
+func (s *TokenService) RevokeRefreshToken(userID int, refreshToken string) error {
+	token, err := s.refreshRepo.GetByHash(utils.HashToken(refreshToken))
+	if err != nil {
+		return err
+	}
+	if token == nil || token.UserID != userID {
+		return NewAuthFailed("Invalid refresh token")
+	}
+	return s.refreshRepo.RevokeFamily(token.FamilyID)
+}
+
+// issue stores a new refresh token in the given family and returns its plain value
+func (s *TokenService) issue(userID, sessionID, tokenVersion int, familyID string) (string, error) {
+	plain, err := utils.RandomToken(32)
+	if err != nil {
+		return "", NewError(CodeError, "Failed to generate refresh token")
+	}
+
+	token := &models.RefreshToken{
+		UserID:       userID,
+		SessionID:    sessionID,
+		FamilyID:     familyID,
+		TokenHash:    utils.HashToken(plain),
+		TokenVersion: tokenVersion,
+		ExpiresAt:    time.Now().Add(s.refreshTTL),
+	}
+	if err := s.refreshRepo.Create(token); err != nil {
+		return "", err
+	}
+
+	return plain, nil
+}
+
+// revokeReusedFamily revokes a token family and its session after one of its rotated tokens was presented again
+func (s *TokenService) revokeReusedFamily(token *models.RefreshToken) error {
+	logger.Warnf("refresh token reuse detected for user %d, revoking family %s", token.UserID, token.FamilyID)
+	if err := s.refreshRepo.RevokeFamily(token.FamilyID); err != nil {
+		return err
+	}
+	if err := s.sessionRepo.Delete(token.SessionID); err != nil {
+		return err
+	}
+	return NewAuthFailed("Refresh token reuse detected")
+}
@@ -1,11 +1,11 @@
 package service
 
 import (
+	"time"
 	"veo/internal/models"
 	"veo/internal/repository"
+	"veo/internal/utils"
 	"veo/pkg/errors"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 // import func on errors
@@ -15,6 +15,7 @@ var (
 	NewUserExists   = errors.NewUserExists
 	NewUserNotFound = errors.NewUserNotFound
 	NewAuthFailed   = errors.NewAuthFailed
+	NewTokenExpired = errors.NewTokenExpired
 )
 
 // UserService handles user-related business logic
@@ -27,24 +28,34 @@ func NewUserService(userRepo *repository.UserRepository) UserService {
 	return UserService{userRepo: userRepo}
 }
 
-// Register creates a new user account
+// Register creates a new user account, its password must follow the password policy
 func (s *UserService) Register(username, password string) (*models.User, error) {
+	if err := passwordPolicy.Check("password", password, username); err != nil {
+		return nil, err
+	}
+
 	// Hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(password)
 	if err != nil {
-		return nil, NewError(CodeError, "Failed to hash password")
+		return nil, err
 	}
 
 	// Create new user
+	now := time.Now()
 	user := &models.User{
-		Username: username,
-		Password: string(hashedPassword),
+		Username:          username,
+		Password:          hashedPassword,
+		PasswordChangedAt: &now,
 	}
-
-	return user, s.userRepo.CreateUser(user)
+	if err := s.userRepo.CreateUser(user); err != nil {
+		return user, err
+	}
+	recordPassword(s.userRepo, user.ID, hashedPassword)
+	return user, nil
 }
 
-// Login authenticates a user and returns user information
+// Login authenticates a user and returns user information. A password hashed with an outdated
+// algorithm or parameters is hashed again with the configured ones.
 func (s *UserService) Login(username, password string) (*models.User, error) {
 	// Get user by username
 	user, err := s.userRepo.GetUserByUsername(username)
@@ -53,14 +64,36 @@ func (s *UserService) Login(username, password string) (*models.User, error) {
 	}
 
 	// Verify password
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
-	if err != nil {
+	ok, rehash := utils.VerifyPassword(password, user.Password)
+	if !ok {
 		return nil, NewAuthFailed("Invalid password")
 	}
+	if rehash {
+		s.rehash(user, password)
+	}
 
 	return user, nil
 }
 
+// rehash replaces the hash of the password of a user by one made with the configured algorithm and parameters.
+// Signing in does not depend on it, failures are only logged.
+func (s *UserService) rehash(user *models.User, password string) {
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		logger.Errorf("failed to rehash the password of user %d: %v", user.ID, err)
+		return
+	}
+	replaced, err := s.userRepo.ReplacePasswordHash(user.ID, user.Password, hashedPassword)
+	if err != nil {
+		logger.Errorf("failed to rehash the password of user %d: %v", user.ID, err)
+		return
+	}
+	if replaced {
+		user.Password = hashedPassword
+		logger.Infof("rehashed the password of user %d", user.ID)
+	}
+}
+
 // GetUserByID retrieves a user by their ID
 func (s *UserService) GetUserByID(id int) (*models.User, error) {
 	return s.userRepo.GetUserByID(id)
@@ -71,7 +104,8 @@ func (s *UserService) GetUserByUsername(username string) (*models.User, error) {
 	return s.userRepo.GetUserByUsername(username)
 }
 
-// UpdatePassword changes a user's password
+// UpdatePassword changes a user's password, which also invalidates every token issued to the user.
+// The new password must follow the password policy and differ from the last ones it remembers.
 func (s *UserService) UpdatePassword(userID int, oldPassword, newPassword string) error {
 	// Get user by ID
 	user, err := s.userRepo.GetUserByID(userID)
@@ -80,22 +114,61 @@ func (s *UserService) UpdatePassword(userID int, oldPassword, newPassword string
 	}
 
 	// Verify old password
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(oldPassword))
-	if err != nil {
+	if !user.CheckPassword(oldPassword) {
 		return NewAuthFailed("Invalid old password")
 	}
+	if err := passwordPolicy.Check("newPassword", newPassword, user.Username); err != nil {
+		return err
+	}
+	if err := checkPasswordReuse(s.userRepo, user, "newPassword", newPassword); err != nil {
+		return err
+	}
 
 	// Hash new password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(newPassword)
 	if err != nil {
-		return NewError(CodeError, "Failed to hash new password")
+		return err
 	}
 
 	// Update password
-	return s.userRepo.UpdatePassword(userID, string(hashedPassword))
+	if err := s.userRepo.UpdatePassword(userID, hashedPassword); err != nil {
+		return err
+	}
+	recordPassword(s.userRepo, userID, hashedPassword)
+	return nil
+}
+
+// hashPassword hashes a new password with the configured algorithm, shared by every way of setting a password
+func hashPassword(password string) (string, error) {
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return "", NewError(CodeError, "Failed to hash new password")
+	}
+	return hashedPassword, nil
 }
 
 // DeleteUser removes a user account by ID.
+// Its tokens stop working because TokenVersion no longer finds the user.
 func (s *UserService) DeleteUser(id int) error {
 	return s.userRepo.DeleteUser(id)
 }
+
+// SetMustChangePassword sets or clears the flag making the user change its password at its next sign-in.
+// Setting it also signs the user out everywhere.
+func (s *UserService) SetMustChangePassword(userID int, mustChange bool) error {
+	return s.userRepo.SetMustChangePassword(userID, mustChange)
+}
+
+// SignOutEverywhere invalidates every access and refresh token issued to the user, and revokes its API keys
+func (s *UserService) SignOutEverywhere(userID int) error {
+	return s.userRepo.SignOutEverywhere(userID)
+}
+
+// TokenVersion returns the token version tokens of the user must carry to be accepted
+func (s *UserService) TokenVersion(userID int) (int, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return 0, err
+	}
+	return user.TokenVersion, nil
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"math/big"
+	"strings"
+	"veo/pkg/errors"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// COSE algorithms accepted for passkeys (RFC 9053), in order of preference
+const (
+	coseAlgES256 = -7
+	coseAlgEdDSA = -8
+	coseAlgRS256 = -257
+)
+
+// passkeyAlgorithms are offered to authenticators when a passkey is registered
+var passkeyAlgorithms = []int{coseAlgES256, coseAlgEdDSA, coseAlgRS256}
+
+// COSE key parameters (RFC 9052 section 7, RFC 9053 section 7)
+const (
+	coseKeyType   = 1
+	coseKeyAlg    = 3
+	coseCurve     = -1 // Curve of EC2 and OKP keys
+	coseX         = -2 // X coordinate of EC2 keys, public key of OKP keys
+	coseY         = -3 // Y coordinate of EC2 keys
+	coseRSAModulo = -1 // Modulus of RSA keys
+	coseRSAExp    = -2 // Exponent of RSA keys
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+	coseCurveP256  = 1
+	coseCurveEd    = 6
+)
+
+// Flags of the authenticator data (WebAuthn section 6.1)
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+// clientData is the JSON the browser signs with the challenge (WebAuthn section 5.8.1)
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// attestationObject is returned by the authenticator when a passkey is created (WebAuthn section 6.5).
+// The attestation statement is not checked: attestation is requested as none, the authenticator model is not trusted.
+type attestationObject struct {
+	Format   string          `cbor:"fmt"`
+	AttStmt  cbor.RawMessage `cbor:"attStmt"`
+	AuthData []byte          `cbor:"authData"`
+}
+
+// authenticatorData is the data the authenticator signs (WebAuthn section 6.1)
+type authenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	CredentialID []byte // Only in the authenticator data of a new passkey
+	PublicKey    []byte // COSE key, only in the authenticator data of a new passkey
+}
+
+// parseAuthenticatorData decodes authenticator data, with the attested credential data when its flag is set
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.NewInvalidParams("Invalid authenticator data")
+	}
+	authData := &authenticatorData{RPIDHash: data[:32], Flags: data[32], SignCount: binary.BigEndian.Uint32(data[33:37])}
+	if authData.Flags&flagAttestedData == 0 {
+		return authData, nil
+	}
+
+	// AAGUID, credential ID length, credential ID, then the COSE key
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, errors.NewInvalidParams("Invalid attested credential data")
+	}
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLength {
+		return nil, errors.NewInvalidParams("Invalid attested credential data")
+	}
+	authData.CredentialID, rest = rest[:idLength], rest[idLength:]
+
+	var key cbor.RawMessage
+	if _, err := cbor.UnmarshalFirst(rest, &key); err != nil {
+		return nil, errors.NewInvalidParams("Invalid credential public key")
+	}
+	authData.PublicKey = key
+	return authData, nil
+}
+
+// parsePublicKey decodes a COSE key and returns it with its algorithm
+func parsePublicKey(coseKey []byte) (crypto.PublicKey, int, error) {
+	var params map[int]interface{}
+	if err := cbor.Unmarshal(coseKey, &params); err != nil {
+		return nil, 0, errors.NewInvalidParams("Invalid credential public key")
+	}
+	keyType, _ := coseInt(params[coseKeyType])
+	alg, _ := coseInt(params[coseKeyAlg])
+
+	switch {
+	case keyType == coseKeyTypeEC2 && alg == coseAlgES256:
+		curve, _ := coseInt(params[coseCurve])
+		x, _ := params[coseX].([]byte)
+		y, _ := params[coseY].([]byte)
+		if curve != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			break
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			break
+		}
+		return key, alg, nil
+	case keyType == coseKeyTypeOKP && alg == coseAlgEdDSA:
+		curve, _ := coseInt(params[coseCurve])
+		x, _ := params[coseX].([]byte)
+		if curve != coseCurveEd || len(x) != ed25519.PublicKeySize {
+			break
+		}
+		return ed25519.PublicKey(x), alg, nil
+	case keyType == coseKeyTypeRSA && alg == coseAlgRS256:
+		n, _ := params[coseRSAModulo].([]byte)
+		e, _ := params[coseRSAExp].([]byte)
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) < 256 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			break
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, alg, nil
+	}
+	return nil, 0, errors.NewInvalidParams("Unsupported credential public key")
+}
+
+// verifyPasskeySignature checks the signature of an assertion over the authenticator data and the client data hash
+func verifyPasskeySignature(key crypto.PublicKey, authData, clientDataJSON, signature []byte) bool {
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+	digest := sha256.Sum256(signed)
+
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, signed, signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
+
+// coseInt returns an integer of a decoded COSE map, CBOR decodes them as uint64 or int64
+func coseInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case uint64:
+		return int(v), v <= 1<<31
+	case int64:
+		return int(v), v >= -1<<31
+	}
+	return 0, false
+}
+
+// decodeBase64URL decodes the base64url fields of WebAuthn responses, with or without padding
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// NormalizeEmail returns the lower case form of a bare email address, false if it is not one.
+// Display names such as "Bob <bob@example.com>" are rejected.
+func NormalizeEmail(address string) (string, bool) {
+	address = strings.ToLower(strings.TrimSpace(address))
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Name != "" || parsed.Address != address || len(address) > 254 {
+		return "", false
+	}
+	return address, true
+}
@@ -117,6 +117,16 @@ func (l *Logger) Errorf(format string, args ...interface{}) {
 	l.logToFile("ERROR", fmt.Sprintf(format, args...))
 }
 
+// Security logs a security event, e.g. an account lockout
+func (l *Logger) Security(msg string) {
+	l.logToFile("SECURITY", msg)
+}
+
+// Securityf logs a formatted security event
+func (l *Logger) Securityf(format string, args ...interface{}) {
+	l.logToFile("SECURITY", fmt.Sprintf(format, args...))
+}
+
 // Close closes the log file
 func (l *Logger) Close() {
 	l.mutex.Lock()
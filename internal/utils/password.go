@@ -0,0 +1,431 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"veo/internal/configs"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Defaults of the password hash parameters left empty in the configuration
+const (
+	defaultHashAlgorithm     = "argon2id"
+	defaultArgon2idMemory    = 64 * 1024
+	defaultArgon2idTime      = 3
+	defaultArgon2idThreads   = 2
+	defaultScryptN           = 1 << 15
+	defaultScryptR           = 8
+	defaultScryptP           = 1
+	defaultHashSaltLength    = 16
+	defaultHashKeyLength     = 32
+	argon2idVersionParameter = "v=19"
+)
+
+// pepperPrefix starts peppered hashes, followed by the version of the pepper and the hash itself,
+// e.g. $pepper$v=2$argon2id$v=19$m=65536,t=3,p=2$salt$hash
+const pepperPrefix = "$pepper$v="
+
+// Statuses of a pepper
+const (
+	PepperActive  = "active"
+	PepperRetired = "retired"
+)
+
+// PasswordHasher hashes passwords with one algorithm, as strings in PHC format
+type PasswordHasher interface {
+	// Hash returns a hash of the password made with the configured parameters
+	Hash(password string) (string, error)
+	// Verify tells whether the password matches a hash made by this algorithm
+	Verify(password, hash string) bool
+	// Outdated tells whether a hash made by this algorithm uses other parameters than Hash does
+	Outdated(hash string) bool
+}
+
+// PasswordHashers hashes new passwords with the configured algorithm and pepper, and verifies the hashes
+// of every registered algorithm and configured pepper so passwords hashed before a change keep working
+type PasswordHashers struct {
+	algorithm string
+	hashers   map[string]PasswordHasher
+	peppers   map[int][]byte // Secrets of the configured peppers by version
+	pepper    int            // Version of the pepper of new hashes, 0 when passwords are not peppered
+}
+
+// passwordHashers hashes and verifies every password, UsePasswordHashers replaces it with the configured one
+var passwordHashers, _ = NewPasswordHashers(configs.PasswordHashConfig{})
+
+// UsePasswordHashers makes HashPassword and VerifyPassword use the hashers
+func UsePasswordHashers(hashers *PasswordHashers) {
+	passwordHashers = hashers
+}
+
+// HashPassword hashes a new password with the configured algorithm and pepper
+func HashPassword(password string) (string, error) {
+	return passwordHashers.Hash(password)
+}
+
+// VerifyPassword tells whether the password matches the hash, and whether the hash should be replaced
+// by a new one since it uses another algorithm, other parameters or another pepper than the configured ones
+func VerifyPassword(password, hash string) (ok bool, rehash bool) {
+	return passwordHashers.Verify(password, hash)
+}
+
+// NewPasswordHashers creates a new instance of PasswordHashers with argon2id, bcrypt and scrypt registered
+// and the configured peppers, at most one of them active
+func NewPasswordHashers(cfg configs.PasswordHashConfig) (*PasswordHashers, error) {
+	h := &PasswordHashers{algorithm: cfg.Algorithm, hashers: make(map[string]PasswordHasher), peppers: make(map[int][]byte)}
+	if h.algorithm == "" {
+		h.algorithm = defaultHashAlgorithm
+	}
+
+	for _, pepper := range cfg.Peppers {
+		if pepper.Version <= 0 {
+			return nil, fmt.Errorf("pepper version must be positive, got %d", pepper.Version)
+		}
+		if pepper.Secret == "" {
+			return nil, fmt.Errorf("pepper %d has no secret", pepper.Version)
+		}
+		if _, ok := h.peppers[pepper.Version]; ok {
+			return nil, fmt.Errorf("pepper version %d is used twice", pepper.Version)
+		}
+		switch pepper.Status {
+		case PepperActive:
+			if h.pepper != 0 {
+				return nil, fmt.Errorf("peppers %d and %d are both active", h.pepper, pepper.Version)
+			}
+			h.pepper = pepper.Version
+		case PepperRetired:
+		default:
+			return nil, fmt.Errorf("pepper %d has unknown status %q, use active or retired", pepper.Version, pepper.Status)
+		}
+		h.peppers[pepper.Version] = []byte(pepper.Secret)
+	}
+
+	scryptHasher, err := NewScryptHasher(cfg.Scrypt)
+	if err != nil {
+		return nil, err
+	}
+	h.Register("argon2id", NewArgon2idHasher(cfg.Argon2id))
+	h.Register("bcrypt", NewBcryptHasher(cfg.Bcrypt))
+	h.Register("scrypt", scryptHasher)
+
+	if _, ok := h.hashers[h.algorithm]; !ok {
+		return nil, fmt.Errorf("unknown password hash algorithm %q, use argon2id, bcrypt or scrypt", h.algorithm)
+	}
+	return h, nil
+}
+
+// Register adds or replaces the hasher of an algorithm, named as in the identifier of its PHC strings
+func (h *PasswordHashers) Register(algorithm string, hasher PasswordHasher) {
+	h.hashers[algorithm] = hasher
+}
+
+// Hash hashes a new password with the configured algorithm, after the active pepper if any
+func (h *PasswordHashers) Hash(password string) (string, error) {
+	hash, err := h.hashers[h.algorithm].Hash(h.peppered(password, h.pepper))
+	if err != nil || h.pepper == 0 {
+		return hash, err
+	}
+	return pepperPrefix + strconv.Itoa(h.pepper) + hash, nil
+}
+
+// Verify tells whether the password matches the hash, and whether the hash should be replaced
+func (h *PasswordHashers) Verify(password, hash string) (ok bool, rehash bool) {
+	version, hash := splitPepper(hash)
+	if _, found := h.peppers[version]; version != 0 && !found {
+		return false, false
+	}
+	algorithm := hashAlgorithm(hash)
+	hasher, found := h.hashers[algorithm]
+	if !found || !hasher.Verify(h.peppered(password, version), hash) {
+		return false, false
+	}
+	return true, algorithm != h.algorithm || version != h.pepper || hasher.Outdated(hash)
+}
+
+// peppered returns the password to hash with the pepper of the version, 0 for none. The HMAC is
+// base64 encoded, so bcrypt gets neither NUL bytes nor more than its 72 bytes.
+func (h *PasswordHashers) peppered(password string, version int) string {
+	if version == 0 {
+		return password
+	}
+	mac := hmac.New(sha256.New, h.peppers[version])
+	mac.Write([]byte(password))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// splitPepper returns the version of the pepper of a hash, 0 if it has none and -1 if the version
+// cannot be read, and the hash made by the algorithm
+func splitPepper(hash string) (int, string) {
+	if !strings.HasPrefix(hash, pepperPrefix) {
+		return 0, hash
+	}
+	version, rest, _ := strings.Cut(hash[len(pepperPrefix):], "$")
+	number, err := strconv.Atoi(version)
+	if err != nil || number <= 0 {
+		return -1, hash
+	}
+	return number, "$" + rest
+}
+
+// hashAlgorithm returns the algorithm of a hash from its identifier, bcrypt hashes use one per revision
+func hashAlgorithm(hash string) string {
+	parts := strings.SplitN(hash, "$", 3)
+	if len(parts) < 3 || parts[0] != "" {
+		return ""
+	}
+	switch parts[1] {
+	case "2a", "2b", "2y":
+		return "bcrypt"
+	}
+	return parts[1]
+}
+
+// phcHash is a hash in PHC string format: $id[$v=version][$param=value,...]$salt$hash
+type phcHash struct {
+	id      string
+	version string
+	params  map[string]string
+	salt    []byte
+	hash    []byte
+}
+
+// parsePHC decodes a hash in PHC string format, salt and hash in unpadded standard base64
+func parsePHC(encoded string) (*phcHash, bool) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) < 5 || len(parts) > 6 || parts[0] != "" {
+		return nil, false
+	}
+	phc := &phcHash{id: parts[1], params: make(map[string]string)}
+	rest := parts[2:]
+	if len(rest) == 4 {
+		phc.version, rest = rest[0], rest[1:]
+	}
+	for _, param := range strings.Split(rest[0], ",") {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return nil, false
+		}
+		phc.params[name] = value
+	}
+
+	var err error
+	if phc.salt, err = base64.RawStdEncoding.DecodeString(rest[1]); err != nil {
+		return nil, false
+	}
+	if phc.hash, err = base64.RawStdEncoding.DecodeString(rest[2]); err != nil || len(phc.hash) == 0 {
+		return nil, false
+	}
+	return phc, true
+}
+
+// param returns a numeric parameter of the hash, or false if it is missing or does not fit in size bits
+func (p *phcHash) param(name string, size int) (uint64, bool) {
+	value, err := strconv.ParseUint(p.params[name], 10, size)
+	return value, err == nil
+}
+
+// encodePHC formats a hash in PHC string format
+func encodePHC(id, params string, salt, hash []byte) string {
+	return fmt.Sprintf("$%s$%s$%s$%s", id, params,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash))
+}
+
+// randomSalt returns size random bytes
+func randomSalt(size int) ([]byte, error) {
+	salt := make([]byte, size)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// Argon2idHasher hashes passwords with argon2id, the default
+type Argon2idHasher struct {
+	memory     uint32
+	time       uint32
+	threads    uint8
+	saltLength int
+	keyLength  int
+}
+
+// NewArgon2idHasher creates a new instance of Argon2idHasher
+func NewArgon2idHasher(cfg configs.Argon2idConfig) *Argon2idHasher {
+	h := &Argon2idHasher{memory: uint32(cfg.Memory), time: uint32(cfg.Iterations), threads: uint8(cfg.Parallelism),
+		saltLength: cfg.SaltLength, keyLength: cfg.KeyLength}
+	if cfg.Memory <= 0 {
+		h.memory = defaultArgon2idMemory
+	}
+	if cfg.Iterations <= 0 {
+		h.time = defaultArgon2idTime
+	}
+	if cfg.Parallelism <= 0 || cfg.Parallelism > 255 {
+		h.threads = defaultArgon2idThreads
+	}
+	if cfg.SaltLength <= 0 {
+		h.saltLength = defaultHashSaltLength
+	}
+	if cfg.KeyLength <= 0 {
+		h.keyLength = defaultHashKeyLength
+	}
+	return h
+}
+
+// Hash returns a hash such as $argon2id$v=19$m=65536,t=3,p=2$salt$hash
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt, err := randomSalt(h.saltLength)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.time, h.memory, h.threads, uint32(h.keyLength))
+	return encodePHC("argon2id", fmt.Sprintf("%s$m=%d,t=%d,p=%d", argon2idVersionParameter, h.memory, h.time, h.threads), salt, key), nil
+}
+
+// Verify tells whether the password matches an argon2id hash
+func (h *Argon2idHasher) Verify(password, hash string) bool {
+	phc, memory, time, threads, ok := h.parse(hash)
+	if !ok {
+		return false
+	}
+	key := argon2.IDKey([]byte(password), phc.salt, time, memory, threads, uint32(len(phc.hash)))
+	return subtle.ConstantTimeCompare(key, phc.hash) == 1
+}
+
+// Outdated tells whether an argon2id hash uses other parameters than Hash does
+func (h *Argon2idHasher) Outdated(hash string) bool {
+	phc, memory, time, threads, ok := h.parse(hash)
+	return !ok || memory != h.memory || time != h.time || threads != h.threads ||
+		len(phc.salt) != h.saltLength || len(phc.hash) != h.keyLength
+}
+
+// parse decodes an argon2id hash of the only version argon2 implements, and its parameters
+func (h *Argon2idHasher) parse(hash string) (phc *phcHash, memory, time uint32, threads uint8, ok bool) {
+	phc, ok = parsePHC(hash)
+	if !ok || phc.id != "argon2id" || phc.version != argon2idVersionParameter {
+		return nil, 0, 0, 0, false
+	}
+	m, okM := phc.param("m", 32)
+	t, okT := phc.param("t", 32)
+	p, okP := phc.param("p", 8)
+	if !okM || !okT || !okP || t == 0 || p == 0 {
+		return nil, 0, 0, 0, false
+	}
+	return phc, uint32(m), uint32(t), uint8(p), true
+}
+
+// BcryptHasher hashes passwords with bcrypt, in its own modular crypt format $2a$cost$saltandhash
+type BcryptHasher struct {
+	cost int
+}
+
+// NewBcryptHasher creates a new instance of BcryptHasher
+func NewBcryptHasher(cfg configs.BcryptConfig) *BcryptHasher {
+	if cfg.Cost <= 0 {
+		cfg.Cost = bcrypt.DefaultCost
+	}
+	return &BcryptHasher{cost: cfg.Cost}
+}
+
+// Hash returns a bcrypt hash of the password, which must not be longer than 72 bytes
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	return string(hash), err
+}
+
+// Verify tells whether the password matches a bcrypt hash
+func (h *BcryptHasher) Verify(password, hash string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// Outdated tells whether a bcrypt hash uses another cost than Hash does
+func (h *BcryptHasher) Outdated(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.cost
+}
+
+// ScryptHasher hashes passwords with scrypt
+type ScryptHasher struct {
+	logN       int
+	r          int
+	p          int
+	saltLength int
+	keyLength  int
+}
+
+// NewScryptHasher creates a new instance of ScryptHasher, N must be a power of two
+func NewScryptHasher(cfg configs.ScryptConfig) (*ScryptHasher, error) {
+	if cfg.N <= 0 {
+		cfg.N = defaultScryptN
+	}
+	if cfg.N < 2 || cfg.N&(cfg.N-1) != 0 {
+		return nil, fmt.Errorf("scrypt N must be a power of two greater than 1, got %d", cfg.N)
+	}
+	h := &ScryptHasher{logN: bits.Len(uint(cfg.N)) - 1, r: cfg.R, p: cfg.P, saltLength: cfg.SaltLength, keyLength: cfg.KeyLength}
+	if h.r <= 0 {
+		h.r = defaultScryptR
+	}
+	if h.p <= 0 {
+		h.p = defaultScryptP
+	}
+	if h.saltLength <= 0 {
+		h.saltLength = defaultHashSaltLength
+	}
+	if h.keyLength <= 0 {
+		h.keyLength = defaultHashKeyLength
+	}
+	return h, nil
+}
+
+// Hash returns a hash such as $scrypt$ln=15,r=8,p=1$salt$hash
+func (h *ScryptHasher) Hash(password string) (string, error) {
+	salt, err := randomSalt(h.saltLength)
+	if err != nil {
+		return "", err
+	}
+	key, err := scrypt.Key([]byte(password), salt, 1<<h.logN, h.r, h.p, h.keyLength)
+	if err != nil {
+		return "", err
+	}
+	return encodePHC("scrypt", fmt.Sprintf("ln=%d,r=%d,p=%d", h.logN, h.r, h.p), salt, key), nil
+}
+
+// Verify tells whether the password matches a scrypt hash
+func (h *ScryptHasher) Verify(password, hash string) bool {
+	phc, logN, r, p, ok := h.parse(hash)
+	if !ok {
+		return false
+	}
+	key, err := scrypt.Key([]byte(password), phc.salt, 1<<logN, r, p, len(phc.hash))
+	return err == nil && subtle.ConstantTimeCompare(key, phc.hash) == 1
+}
+
+// Outdated tells whether a scrypt hash uses other parameters than Hash does
+func (h *ScryptHasher) Outdated(hash string) bool {
+	phc, logN, r, p, ok := h.parse(hash)
+	return !ok || logN != h.logN || r != h.r || p != h.p ||
+		len(phc.salt) != h.saltLength || len(phc.hash) != h.keyLength
+}
+
+// parse decodes a scrypt hash and its parameters
+func (h *ScryptHasher) parse(hash string) (phc *phcHash, logN, r, p int, ok bool) {
+	phc, ok = parsePHC(hash)
+	if !ok || phc.id != "scrypt" || phc.version != "" {
+		return nil, 0, 0, 0, false
+	}
+	ln, okN := phc.param("ln", 6)
+	rr, okR := phc.param("r", 30)
+	pp, okP := phc.param("p", 30)
+	if !okN || !okR || !okP || ln == 0 || ln > 31 {
+		return nil, 0, 0, 0, false
+	}
+	return phc, int(ln), int(rr), int(pp), true
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"strings"
+)
+
+// NormalizePhone returns the E.164 form of a phone number, e.g. +14155550123, false if it is not one.
+// Spaces, dashes, dots and parentheses are ignored. Numbers without a + or 00 prefix get the default
+// country calling code, after dropping the leading 0 of the national trunk prefix.
+func NormalizePhone(number, defaultCountryCode string) (string, bool) {
+	var digits strings.Builder
+	international := false
+	for i, r := range strings.TrimSpace(number) {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+			international = true
+		case strings.ContainsRune(" -.()", r):
+		default:
+			return "", false
+		}
+	}
+
+	national := digits.String()
+	switch {
+	case international:
+	case strings.HasPrefix(national, "00"):
+		national = national[2:]
+	case defaultCountryCode != "":
+		national = strings.TrimPrefix(defaultCountryCode, "+") + strings.TrimPrefix(national, "0")
+	default:
+		return "", false
+	}
+
+	// Country calling codes never start with 0, and E.164 numbers have at most 15 digits
+	if len(national) < 8 || len(national) > 15 || national[0] == '0' {
+		return "", false
+	}
+	return "+" + national, true
+}
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+// SignToken appends an HMAC-SHA256 signature of the payload made with the secret: payload.signature
+func SignToken(secret []byte, payload string) string {
+	return payload + "." + signature(secret, payload)
+}
+
+// VerifySignedToken checks the signature of a token made by SignToken and returns its payload
+func VerifySignedToken(secret []byte, token string) (string, bool) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return "", false
+	}
+	payload, sig := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, payload))) {
+		return "", false
+	}
+	return payload, true
+}
+
+// signature returns the base64url HMAC-SHA256 of the payload
+func signature(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
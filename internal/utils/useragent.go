@@ -0,0 +1,52 @@
+package utils
+
+import "strings"
+
+// Browsers and operating systems recognized by DeviceFromUserAgent, in matching order.
+// Order matters: Edge and Opera also announce Chrome, Chrome also announces Safari.
+var (
+	userAgentBrowsers = [][2]string{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+	userAgentSystems = [][2]string{
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// DeviceFromUserAgent derives a readable device label such as "Chrome on macOS" from a User-Agent header.
+func DeviceFromUserAgent(userAgent string) string {
+	browser := matchUserAgent(userAgent, userAgentBrowsers)
+	system := matchUserAgent(userAgent, userAgentSystems)
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	default:
+		return "Unknown device"
+	}
+}
+
+// matchUserAgent returns the name of the first token found in the user agent
+func matchUserAgent(userAgent string, tokens [][2]string) string {
+	for _, token := range tokens {
+		if strings.Contains(userAgent, token[0]) {
+			return token[1]
+		}
+	}
+	return ""
+}
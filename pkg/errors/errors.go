@@ -19,6 +19,10 @@ const (
 	CodeAuthFailed                               // 认证失败
 	CodeTokenExpired                             // Token 过期
 	CodePermissionDenied                         // 权限不足
+	CodeReauthRequired                           // 需要重新验证身份
+	CodeTooManyRequests                          // 请求过于频繁
+	CodeEmailNotVerified                         // 邮箱未验证
+	CodeAccountLocked                            // 账户暂时锁定
 )
 
 var logger = utils.GetLogger()
@@ -27,6 +31,14 @@ var logger = utils.GetLogger()
 type Error struct {
 	Code    ErrorCode
 	Message string
+	Fields  []FieldError // Fields of the request that were refused, and why
+}
+
+// FieldError tells which rule a field of a request breaks
+type FieldError struct {
+	Field   string `json:"field"`   // Name of the field in the request
+	Rule    string `json:"rule"`    // Rule the value breaks, e.g. min_length
+	Message string `json:"message"` // What to change, for display
 }
 
 // Error implements the error interface
@@ -50,6 +62,12 @@ func NewInvalidParams(message string) error {
 	return New(CodeInvalidParams, message)
 }
 
+// NewFieldErrors creates a new invalid parameters error listing the rules broken by fields of the request
+func NewFieldErrors(message string, fields []FieldError) error {
+	logger.Error(message)
+	return &Error{Code: CodeInvalidParams, Message: message, Fields: fields}
+}
+
 // NewUserNotFound creates a new user not found error
 func NewUserNotFound(message string) error {
 	return New(CodeUserNotFound, message)
@@ -70,6 +88,26 @@ func NewPermissionDenied(message string) error {
 	return New(CodePermissionDenied, message)
 }
 
+// NewReauthRequired creates a new error asking the user to confirm who they are before a sensitive change
+func NewReauthRequired(message string) error {
+	return New(CodeReauthRequired, message)
+}
+
+// NewTooManyRequests creates a new error asking the caller to slow down
+func NewTooManyRequests(message string) error {
+	return New(CodeTooManyRequests, message)
+}
+
+// NewEmailNotVerified creates a new error telling the user to verify their email address before signing in
+func NewEmailNotVerified(message string) error {
+	return New(CodeEmailNotVerified, message)
+}
+
+// NewAccountLocked creates a new error telling the user that sign-ins are refused until a lockout ends
+func NewAccountLocked(message string) error {
+	return New(CodeAccountLocked, message)
+}
+
 // NewUserExists creates a new permission denied error
 func NewUserExists(message string) error {
 	return New(CodeUserExists, message)